@@ -0,0 +1,257 @@
+package flashdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTimeout = errors.New("timeout")
+)
+
+// waiter is a client blocked on one or more lists by BLPop, BRPop or BLMove.
+type waiter struct {
+	keys []string
+	from ListDirection
+	dst  string // destination of BLMove, empty for a pop.
+	to   ListDirection
+
+	// set before done is closed.
+	key string
+	val string
+	err error
+
+	done chan struct{}
+}
+
+// finish hands the result to the blocked client.
+func (w *waiter) finish(key, val string, err error) {
+	w.key, w.val, w.err = key, val, err
+	close(w.done)
+}
+
+// serve pops the element for w from the list stored at key, as part of tx.
+func (w *waiter) serve(tx *Tx, key string) (string, error) {
+	if w.dst == "" {
+		if w.from == Left {
+			return tx.LPop(key)
+		}
+		return tx.RPop(key)
+	}
+	return tx.LMove(key, w.dst, w.from, w.to)
+}
+
+// blockedClients holds the clients blocked on each list key, in the order
+// they started waiting.
+type blockedClients struct {
+	mu   sync.Mutex
+	keys map[string][]*waiter
+}
+
+func newBlockedClients() *blockedClients {
+	return &blockedClients{keys: make(map[string][]*waiter)}
+}
+
+func (b *blockedClients) add(w *waiter) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range w.keys {
+		b.keys[key] = append(b.keys[key], w)
+	}
+}
+
+// remove removes w from all the keys it waits on. It returns false if w has
+// already been removed, i.e. it is being served.
+func (b *blockedClients) remove(w *waiter) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.removeLocked(w)
+}
+
+func (b *blockedClients) removeLocked(w *waiter) bool {
+	found := false
+	for _, key := range w.keys {
+		queue := b.keys[key]
+		for i, qw := range queue {
+			if qw == w {
+				queue = append(queue[:i], queue[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(b.keys, key)
+		} else {
+			b.keys[key] = queue
+		}
+	}
+	return found
+}
+
+// next removes and returns the client that has been waiting the longest on
+// key, or nil if there is none.
+func (b *blockedClients) next(key string) *waiter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queue := b.keys[key]
+	if len(queue) == 0 {
+		return nil
+	}
+	w := queue[0]
+	b.removeLocked(w)
+	return w
+}
+
+// closeAll fails every blocked client with err.
+func (b *blockedClients) closeAll(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	seen := make(map[*waiter]bool)
+	for _, queue := range b.keys {
+		for _, w := range queue {
+			if !seen[w] {
+				seen[w] = true
+				w.finish("", "", err)
+			}
+		}
+	}
+	b.keys = make(map[string][]*waiter)
+}
+
+// BLPop removes and returns the first element of the first non-empty list
+// among keys, along with its key. If all lists are empty, it blocks until a
+// write transaction pushes to one of them, the timeout expires or ctx is
+// done. A zero timeout blocks indefinitely. Clients blocked on the same key
+// are served in the order they started waiting. It returns ErrTimeout if the
+// timeout expires.
+func (db *FlashDB) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (key, val string, err error) {
+	return db.block(ctx, timeout, &waiter{keys: keys, from: Left})
+}
+
+// BRPop is like BLPop, but removes the last element of the list.
+func (db *FlashDB) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (key, val string, err error) {
+	return db.block(ctx, timeout, &waiter{keys: keys, from: Right})
+}
+
+// BLMove is the blocking variant of Tx.LMove. It blocks like BLPop until the
+// src list has an element to move.
+func (db *FlashDB) BLMove(ctx context.Context, timeout time.Duration, src, dst string, from, to ListDirection) (string, error) {
+	_, val, err := db.block(ctx, timeout, &waiter{keys: []string{src}, from: from, dst: dst, to: to})
+	return val, err
+}
+
+func (db *FlashDB) block(ctx context.Context, timeout time.Duration, w *waiter) (string, string, error) {
+	if timeout < 0 {
+		return "", "", ErrInvalidTTL
+	}
+	w.done = make(chan struct{})
+
+	// The lists are checked and the client registered in the same
+	// transaction, so a push cannot be missed in between.
+	err := db.Update(func(tx *Tx) error {
+		if err := tx.CheckType(List, w.keys...); err != nil {
+			return err
+		}
+		if w.dst != "" {
+			if err := tx.CheckType(List, w.dst); err != nil {
+				return err
+			}
+		}
+		for _, key := range w.keys {
+			if tx.LLen(key) == 0 {
+				continue
+			}
+			val, err := w.serve(tx, key)
+			if err != nil {
+				return err
+			}
+			w.key, w.val = key, val
+			close(w.done)
+			return nil
+		}
+		db.blocked.add(w)
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-w.done:
+		return w.key, w.val, w.err
+	case <-expired:
+		err = ErrTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if !db.blocked.remove(w) {
+		// served while timing out
+		<-w.done
+		return w.key, w.val, w.err
+	}
+	return "", "", err
+}
+
+// serveBlocked serves the clients blocked on the lists pushed to by recs. It
+// is called by Commit once recs are written to the log and applied, while the
+// database is still locked. Each client is served in its own transaction, so
+// that the pop is durable before the client gets the element. It returns the
+// records of these transactions, for the subscribers to be told about them.
+func (db *FlashDB) serveBlocked(recs []*record) (served []*record) {
+	var ready []string
+	for _, r := range recs {
+		if r.getType() == ListRecord && isListPush(r.getMark()) {
+			ready = append(ready, string(r.meta.key))
+		}
+	}
+
+	for len(ready) > 0 {
+		key := ready[0]
+		ready = ready[1:]
+
+		for {
+			tx := &Tx{db: db, writable: true, wc: &txWriteContext{}}
+			if tx.LLen(key) == 0 {
+				break
+			}
+			w := db.blocked.next(key)
+			if w == nil {
+				break
+			}
+
+			val, err := w.serve(tx, key)
+			if err == nil {
+				err = tx.commit()
+			}
+			if err != nil {
+				w.finish("", "", err)
+				break
+			}
+			w.finish(key, val, nil)
+			served = append(served, tx.wc.commitItems...)
+
+			if w.dst != "" {
+				ready = append(ready, w.dst)
+			}
+		}
+	}
+	return
+}
+
+func isListPush(mark uint16) bool {
+	switch mark {
+	case ListLPush, ListRPush, ListLInsertBefore, ListLInsertAfter:
+		return true
+	}
+	return false
+}
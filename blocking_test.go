@@ -0,0 +1,194 @@
+package flashdb
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type popResult struct {
+	key, val string
+	err      error
+}
+
+// waitBlocked waits until n clients are blocked on key.
+func waitBlocked(t *testing.T, db *FlashDB, key string, n int) {
+	assert.Eventually(t, func() bool {
+		db.blocked.mu.Lock()
+		defer db.blocked.mu.Unlock()
+		return len(db.blocked.keys[key]) == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestFlashDB_BLPopReady(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.RPush("b", "1", "2")
+		return err
+	})
+	assert.NoError(t, err)
+
+	key, val, err := db.BLPop(context.Background(), time.Second, "a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", key)
+	assert.Equal(t, "1", val)
+
+	key, val, err = db.BRPop(context.Background(), time.Second, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", key)
+	assert.Equal(t, "2", val)
+}
+
+func TestFlashDB_BLPopTimeout(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	_, _, err := db.BLPop(context.Background(), 10*time.Millisecond, "a")
+	assert.Equal(t, ErrTimeout, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = db.BLPop(ctx, 0, "a")
+	assert.Equal(t, context.Canceled, err)
+
+	_, _, err = db.BLPop(context.Background(), -1, "a")
+	assert.Equal(t, ErrInvalidTTL, err)
+
+	// timed out clients are not left behind
+	waitBlocked(t, db, "a", 0)
+}
+
+func TestFlashDB_BLPopWakesInOrder(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	results := make([]chan popResult, 3)
+	for i := range results {
+		results[i] = make(chan popResult, 1)
+		go func(c chan popResult) {
+			key, val, err := db.BLPop(context.Background(), 0, "q")
+			c <- popResult{key, val, err}
+		}(results[i])
+		waitBlocked(t, db, "q", i+1)
+	}
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.RPush("q", "a", "b", "c", "d")
+		return err
+	})
+	assert.NoError(t, err)
+
+	for i, want := range []string{"a", "b", "c"} {
+		res := <-results[i]
+		assert.NoError(t, res.err)
+		assert.Equal(t, "q", res.key)
+		assert.Equal(t, want, res.val)
+	}
+
+	// the pops are in the log
+	assert.NoError(t, db.Close())
+	db = getTestDB()
+	defer db.Close()
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"d"}, tx.LRange("q", 0, -1))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_BLMove(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	moved := make(chan popResult, 1)
+	go func() {
+		val, err := db.BLMove(context.Background(), 0, "src", "dst", Left, Right)
+		moved <- popResult{"dst", val, err}
+	}()
+	waitBlocked(t, db, "src", 1)
+
+	// the moved element wakes up the client blocked on dst
+	popped := make(chan popResult, 1)
+	go func() {
+		key, val, err := db.BRPop(context.Background(), 0, "dst")
+		popped <- popResult{key, val, err}
+	}()
+	waitBlocked(t, db, "dst", 1)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.LPush("src", "job")
+		return err
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, popResult{"dst", "job", nil}, <-moved)
+	assert.Equal(t, popResult{"dst", "job", nil}, <-popped)
+
+	err = db.View(func(tx *Tx) error {
+		assert.False(t, tx.LKeyExists("src"))
+		assert.False(t, tx.LKeyExists("dst"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_BLPopClose(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	result := make(chan popResult, 1)
+	go func() {
+		key, val, err := db.BLPop(context.Background(), 0, "q")
+		result <- popResult{key, val, err}
+	}()
+	waitBlocked(t, db, "q", 1)
+
+	assert.NoError(t, db.Close())
+	assert.Equal(t, ErrDatabaseClosed, (<-result).err)
+}
+
+func TestFlashDB_BLMoveNotify(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	sub := db.Subscribe(EventFilter{Types: []DataType{List}})
+	defer sub.Close()
+
+	moved := make(chan popResult, 1)
+	go func() {
+		val, err := db.BLMove(context.Background(), 0, "src", "dst", Left, Right)
+		moved <- popResult{"dst", val, err}
+	}()
+	waitBlocked(t, db, "src", 1)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.LPush("src", "job")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, popResult{"dst", "job", nil}, <-moved)
+
+	// the push is followed by the pop and the push served to the client
+	for _, want := range []Event{
+		{Key: "src", Member: "job", Mark: ListLPush},
+		{Key: "src", Mark: ListLPop},
+		{Key: "dst", Member: "job", Mark: ListRPush},
+	} {
+		e := receive(t, sub)
+		assert.Equal(t, want.Key, e.Key)
+		assert.Equal(t, want.Mark, e.Mark)
+		if want.Member != "" {
+			assert.Equal(t, want.Member, e.Member)
+		}
+	}
+	assert.Len(t, sub.C, 0)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/arriqaaq/flashdb"
+	"github.com/arriqaaq/flashdb/server"
+	"github.com/gomodule/redigo/redis"
+	"github.com/tidwall/redcon"
+)
+
+// client runs commands against a database. Replies are normalized to status,
+// string, int64, nil or []interface{} of those, so that they print the same
+// way regardless of where the database lives.
+type client interface {
+	do(args []string) (interface{}, error)
+	close() error
+}
+
+// status is a simple string reply such as OK.
+type status string
+
+// embedded runs commands against a database opened in this process.
+type embedded struct {
+	db *flashdb.FlashDB
+}
+
+func openEmbedded(path string) (client, error) {
+	config := flashdb.DefaultConfig()
+	config.Path = path
+
+	db, err := flashdb.New(config)
+	if err != nil {
+		return nil, err
+	}
+	return &embedded{db: db}, nil
+}
+
+func (e *embedded) do(args []string) (interface{}, error) {
+	res, err := server.Exec(e.db, args)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeEmbedded(res), nil
+}
+
+func (e *embedded) close() error {
+	return e.db.Close()
+}
+
+func normalizeEmbedded(v interface{}) interface{} {
+	switch v := v.(type) {
+	case redcon.SimpleString:
+		return status(v)
+	case redcon.SimpleInt:
+		return int64(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []string:
+		vals := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			vals = append(vals, s)
+		}
+		return vals
+	case []interface{}:
+		vals := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			vals = append(vals, normalizeEmbedded(e))
+		}
+		return vals
+	}
+	return v
+}
+
+// remote runs commands against a flashdb server over RESP.
+type remote struct {
+	conn redis.Conn
+}
+
+func dialRemote(addr string) (client, error) {
+	conn, err := redis.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &remote{conn: conn}, nil
+}
+
+func (r *remote) do(args []string) (interface{}, error) {
+	cmdArgs := make([]interface{}, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		cmdArgs = append(cmdArgs, arg)
+	}
+
+	res, err := r.conn.Do(args[0], cmdArgs...)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeRemote(res), nil
+}
+
+func (r *remote) close() error {
+	return r.conn.Close()
+}
+
+func normalizeRemote(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return status(v)
+	case []byte:
+		return string(v)
+	case []interface{}:
+		vals := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			vals = append(vals, normalizeRemote(e))
+		}
+		return vals
+	}
+	return v
+}
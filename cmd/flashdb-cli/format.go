@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errUnbalancedQuotes = errors.New("unbalanced quotes")
+
+// splitArgs splits an input line into arguments. Arguments are separated by
+// whitespace, and can be wrapped in single or double quotes to hold spaces.
+func splitArgs(line string) (args []string, err error) {
+	var (
+		arg    strings.Builder
+		quote  rune
+		inWord bool
+	)
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, arg.String())
+				arg.Reset()
+				inWord = false
+			}
+		default:
+			arg.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errUnbalancedQuotes
+	}
+	if inWord {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// replyKind tells how the elements of an array reply are laid out.
+type replyKind int
+
+const (
+	listReply   replyKind = iota // one element per line
+	pairReply                    // field and value pairs, as in a hash
+	scoreReply                   // member and score pairs, as in a sorted set
+	memberReply                  // unordered members, as in a set
+)
+
+func kindOf(args []string) replyKind {
+	name := strings.ToLower(args[0])
+	switch name {
+	case "hgetall":
+		return pairReply
+	case "smembers", "sunion", "sdiff", "srandmember":
+		return memberReply
+	case "zgetbyrank", "zrevgetbyrank", "zscorerange", "zrevscorerange":
+		return scoreReply
+	case "zrange", "zrevrange":
+		if strings.EqualFold(args[len(args)-1], "withscores") {
+			return scoreReply
+		}
+	}
+	return listReply
+}
+
+// format renders a normalized reply to the command in args in the style of
+// redis-cli.
+func format(args []string, v interface{}) string {
+	vals, ok := v.([]interface{})
+	if !ok {
+		return formatValue(v)
+	}
+	if len(vals) == 0 {
+		return "(empty array)"
+	}
+
+	var b strings.Builder
+	switch kind := kindOf(args); kind {
+	case pairReply, scoreReply:
+		width := len(strconv.Itoa(len(vals) / 2))
+		for i := 0; i+1 < len(vals); i += 2 {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "%*d) %s", width, i/2+1, formatValue(vals[i]))
+			if kind == pairReply {
+				fmt.Fprintf(&b, " => %s", formatValue(vals[i+1]))
+			} else {
+				fmt.Fprintf(&b, " (score: %v)", vals[i+1])
+			}
+		}
+	case memberReply:
+		b.WriteString("{")
+		for i, val := range vals {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(formatValue(val))
+		}
+		b.WriteString("}")
+	default:
+		width := len(strconv.Itoa(len(vals)))
+		for i, val := range vals {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "%*d) %s", width, i+1, formatValue(val))
+		}
+	}
+	return b.String()
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "(nil)"
+	case status:
+		return string(v)
+	case int64:
+		return fmt.Sprintf("(integer) %d", v)
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		return format([]string{""}, v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`set  key "hello world" 'it''s'`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"set", "key", "hello world", "its"}, args)
+
+	args, err = splitArgs(`hset h f ""`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hset", "h", "f", ""}, args)
+
+	_, err = splitArgs(`get "key`)
+	assert.Equal(t, errUnbalancedQuotes, err)
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "OK", format([]string{"set"}, status("OK")))
+	assert.Equal(t, `"bar"`, format([]string{"get"}, "bar"))
+	assert.Equal(t, "(nil)", format([]string{"get"}, nil))
+	assert.Equal(t, "(integer) 3", format([]string{"scard"}, int64(3)))
+	assert.Equal(t, "(empty array)", format([]string{"hkeys"}, []interface{}{}))
+
+	assert.Equal(t, "1) \"a\"\n2) \"b\"", format([]string{"hkeys"}, []interface{}{"a", "b"}))
+
+	assert.Equal(t, "1) \"a\" => \"1\"\n2) \"b\" => \"2\"",
+		format([]string{"hgetall", "h"}, []interface{}{"a", "1", "b", "2"}))
+
+	assert.Equal(t, `{"a", "b"}`, format([]string{"smembers", "s"}, []interface{}{"a", "b"}))
+
+	assert.Equal(t, "1) \"a\" (score: 1)\n2) \"b\" (score: 2.5)",
+		format([]string{"zrange", "z", "0", "-1", "WITHSCORES"}, []interface{}{"a", "1", "b", "2.5"}))
+	assert.Equal(t, "1) \"a\"", format([]string{"zrange", "z", "0", "-1"}, []interface{}{"a"}))
+}
+
+func TestComplete(t *testing.T) {
+	assert.Equal(t, []string{"zrevrange", "zrevrank"}, complete("zrevr"))
+	assert.Contains(t, complete("HG"), "HGETALL")
+	assert.Nil(t, complete("get "))
+}
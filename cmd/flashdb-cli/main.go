@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arriqaaq/flashdb/server"
+	"github.com/peterh/liner"
+)
+
+var (
+	addr = flag.String("addr", "", "address of a flashdb server to connect to")
+	path = flag.String("path", "", "dir path of a database to open in embedded mode")
+)
+
+const historyFile = ".flashdb_history"
+
+func main() {
+	flag.Parse()
+
+	var (
+		c      client
+		prompt string
+		err    error
+	)
+	switch {
+	case *addr != "" && *path != "":
+		log.Fatal("only one of -addr and -path can be set")
+	case *path != "":
+		c, err = openEmbedded(*path)
+		prompt = *path + "> "
+	default:
+		if *addr == "" {
+			*addr = "127.0.0.1:8000"
+		}
+		c, err = dialRemote(*addr)
+		prompt = *addr + "> "
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.close()
+
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetCompleter(complete)
+
+	history := filepath.Join(os.Getenv("HOME"), historyFile)
+	if f, err := os.Open(history); err == nil {
+		line.ReadHistory(f)
+		f.Close()
+	}
+	defer func() {
+		if f, err := os.Create(history); err == nil {
+			line.WriteHistory(f)
+			f.Close()
+		}
+	}()
+
+	for {
+		input, err := line.Prompt(prompt)
+		if err == liner.ErrPromptAborted || err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Print(err)
+			return
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		line.AppendHistory(input)
+
+		args, err := splitArgs(input)
+		if err != nil {
+			fmt.Printf("(error) %v\n", err)
+			continue
+		}
+		if name := strings.ToLower(args[0]); name == "quit" || name == "exit" {
+			return
+		}
+
+		res, err := c.do(args)
+		if err != nil {
+			fmt.Printf("(error) %v\n", err)
+			continue
+		}
+		fmt.Println(format(args, res))
+	}
+}
+
+// complete returns the command names starting with the word being typed.
+func complete(line string) (c []string) {
+	if strings.Contains(line, " ") {
+		return nil
+	}
+	lower := strings.ToLower(line)
+	for _, name := range server.Commands() {
+		if strings.HasPrefix(name, lower) {
+			if line != "" && line == strings.ToUpper(line) {
+				name = strings.ToUpper(name)
+			}
+			c = append(c, name)
+		}
+	}
+	return
+}
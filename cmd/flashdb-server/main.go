@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/arriqaaq/flashdb"
+	"github.com/arriqaaq/flashdb/server"
+)
+
+var (
+	configPath       = flag.String("config", "", "path of a TOML or JSON config file")
+	addr             = flag.String("addr", flashdb.DefaultAddr, "address to listen on")
+	path             = flag.String("path", "/tmp/flashdb", "dir path for append-only logs, empty to keep everything in memory")
+	evictionInterval = flag.Int("eviction-interval", 10, "interval in seconds between sweeps for expired keys")
+	noSync           = flag.Bool("nosync", false, "disable fsync after writes")
+	maxMemory        = flag.Uint64("maxmemory", 0, "memory limit in bytes for the keys, 0 for no limit")
+	evictionPolicy   = flag.String("eviction-policy", string(flashdb.NoEviction), "how keys are evicted over maxmemory: noeviction, allkeys-lru, allkeys-lfu, volatile-lru, volatile-ttl or random")
+	strictTypes      = flag.Bool("strict-types", false, "allow a single data type per key name")
+)
+
+func main() {
+	flag.Parse()
+
+	config := flashdb.DefaultConfig()
+	if *configPath != "" {
+		var err error
+		if config, err = flashdb.LoadConfig(*configPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// flags set on the command line take precedence over the config file
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			config.Addr = *addr
+		case "path":
+			config.Path = *path
+		case "eviction-interval":
+			config.EvictionInterval = *evictionInterval
+		case "nosync":
+			config.NoSync = *noSync
+		case "maxmemory":
+			config.MaxMemory = *maxMemory
+		case "eviction-policy":
+			config.EvictionPolicy = flashdb.EvictionPolicy(*evictionPolicy)
+		case "strict-types":
+			config.StrictTypes = *strictTypes
+		}
+	})
+	config.OnEvictionError = func(err error) {
+		log.Printf("evicting expired keys: %v", err)
+	}
+	config.OnTypeConflict = func(c flashdb.TypeConflict) {
+		log.Printf("key %q holds several data types: %v", c.Key, c.Types)
+	}
+
+	db, err := flashdb.New(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := server.New(db, config.Addr)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		s.Close()
+	}()
+
+	log.Printf("flashdb server listening on %s", config.Addr)
+	err = s.ListenAndServe()
+	if cerr := db.Close(); cerr != nil {
+		log.Print(cerr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,14 +1,54 @@
 package flashdb
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/pelletier/go-toml"
 )
 
 const (
-	DefaultAddr         = "127.0.0.1:8000"
-	DefaultMaxKeySize   = uint32(1 * 1024)
-	DefaultMaxValueSize = uint32(8 * 1024)
+	DefaultAddr          = "127.0.0.1:8000"
+	DefaultMaxKeySize    = uint32(1 * 1024)
+	DefaultMaxMemberSize = uint32(1 * 1024)
+	DefaultMaxValueSize  = uint32(8 * 1024)
+	DefaultEventBuffer   = 1024
+
+	// EnvPrefix is prepended to the upper-cased toml name of a Config field to
+	// get the environment variable overriding it, e.g. FLASHDB_PATH.
+	EnvPrefix = "FLASHDB_"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid config")
+)
+
+// EvictionPolicy is how keys are picked for eviction when the memory used is
+// over Config.MaxMemory. The policies are those of Redis.
+type EvictionPolicy string
+
+const (
+	// NoEviction fails the writes with ErrOutOfMemory instead of evicting.
+	NoEviction EvictionPolicy = "noeviction"
+	// AllKeysLRU evicts the least recently used keys.
+	AllKeysLRU EvictionPolicy = "allkeys-lru"
+	// AllKeysLFU evicts the least frequently used keys.
+	AllKeysLFU EvictionPolicy = "allkeys-lfu"
+	// VolatileLRU evicts the least recently used keys among those with a TTL.
+	VolatileLRU EvictionPolicy = "volatile-lru"
+	// VolatileTTL evicts the keys with the nearest deadline.
+	VolatileTTL EvictionPolicy = "volatile-ttl"
+	// RandomEviction evicts keys at random.
+	RandomEviction EvictionPolicy = "random"
 )
 
 type Config struct {
@@ -17,13 +57,72 @@ type Config struct {
 	EvictionInterval int    `json:"eviction_interval" toml:"eviction_interval"` // in seconds
 	// NoSync disables fsync after writes. This is less durable and puts the
 	// log at risk of data loss when there's a server crash.
-	NoSync bool
+	NoSync bool `json:"no_sync" toml:"no_sync"`
+	// TruncateCorruptTail drops a partially written record at the end of the
+	// log when loading, instead of failing with a CorruptRecordError.
+	TruncateCorruptTail bool `json:"truncate_corrupt_tail" toml:"truncate_corrupt_tail"`
+
+	// Size limits for keys, members of a Hash, Set or ZSet, and values of a
+	// String, Hash or List. Writes over a limit fail with a SizeLimitError,
+	// and so does loading a log holding a record over it. 0 means no limit.
+	MaxKeySize    uint32 `json:"max_key_size" toml:"max_key_size"`       // in bytes
+	MaxMemberSize uint32 `json:"max_member_size" toml:"max_member_size"` // in bytes
+	MaxValueSize  uint32 `json:"max_value_size" toml:"max_value_size"`   // in bytes
+
+	// MaxMemory bounds the memory used by the keys, as estimated from their
+	// size. When a write transaction commits while the memory used is over
+	// it, keys are evicted by EvictionPolicy. Zero means no limit.
+	MaxMemory      uint64         `json:"max_memory" toml:"max_memory"` // in bytes
+	EvictionPolicy EvictionPolicy `json:"eviction_policy" toml:"eviction_policy"`
+
+	// EventBuffer is the number of events, or pub/sub messages, buffered for
+	// each subscription. When a buffer is full, they are dropped unless
+	// BlockSlowSubscribers is set, in which case commits, or Publish, wait
+	// for the subscriber.
+	EventBuffer          int  `json:"event_buffer" toml:"event_buffer"`
+	BlockSlowSubscribers bool `json:"block_slow_subscribers" toml:"block_slow_subscribers"`
+
+	// StrictTypes allows a single data type per key name, as in Redis: the
+	// commands on a key whose name holds a value of another data type fail
+	// with ErrWrongType, or return an empty result if they have no error to
+	// return. Names holding several data types in an existing log are kept,
+	// and reported to OnTypeConflict when the database is opened.
+	StrictTypes bool `json:"strict_types" toml:"strict_types"`
+
+	// OnEvictionError is called with the errors of the background eviction of
+	// expired keys, such as a failed write to the log. It is not read from the
+	// config file.
+	OnEvictionError func(error) `json:"-" toml:"-"`
+	// OnTypeConflict is called, with StrictTypes, for each key name holding
+	// several data types when the database is opened. It is not read from the
+	// config file.
+	OnTypeConflict func(TypeConflict) `json:"-" toml:"-"`
 }
 
-func (c *Config) validate() {
+// validate fills in defaults for unset values and checks the rest.
+func (c *Config) validate() error {
 	if c.Addr == "" {
 		c.Addr = DefaultAddr
 	}
+	if c.EventBuffer == 0 {
+		c.EventBuffer = DefaultEventBuffer
+	}
+	if c.EvictionPolicy == "" {
+		c.EvictionPolicy = NoEviction
+	}
+
+	if c.EvictionInterval < 0 {
+		return fmt.Errorf("%w: eviction_interval must not be negative", ErrInvalidConfig)
+	}
+	if c.EventBuffer < 0 {
+		return fmt.Errorf("%w: event_buffer must not be negative", ErrInvalidConfig)
+	}
+	switch c.EvictionPolicy {
+	case NoEviction, AllKeysLRU, AllKeysLFU, VolatileLRU, VolatileTTL, RandomEviction:
+	default:
+		return fmt.Errorf("%w: unknown eviction_policy %q", ErrInvalidConfig, c.EvictionPolicy)
+	}
+	return nil
 }
 
 func (c *Config) evictionInterval() time.Duration {
@@ -35,7 +134,99 @@ func DefaultConfig() *Config {
 		Addr:             DefaultAddr,
 		Path:             "/tmp/flashdb",
 		EvictionInterval: 10,
+		MaxKeySize:       DefaultMaxKeySize,
+		MaxMemberSize:    DefaultMaxMemberSize,
+		MaxValueSize:     DefaultMaxValueSize,
+		EvictionPolicy:   NoEviction,
+		EventBuffer:      DefaultEventBuffer,
+	}
+}
+
+// LoadConfig reads the config file at path, in TOML or JSON. The format is
+// picked from the file extension, or guessed from the content if the
+// extension is neither .toml nor .json. Values missing from the file are
+// taken from DefaultConfig, and any value can be overridden with an
+// environment variable named after its toml key, e.g. FLASHDB_ADDR.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := DefaultConfig()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			err = json.Unmarshal(data, c)
+		} else {
+			err = toml.Unmarshal(data, c)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	if err := c.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadEnv overrides the config values with the environment variables that
+// are set for them.
+func (c *Config) loadEnv() error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("toml")
+		if name == "" || name == "-" {
+			continue
+		}
+		env := EnvPrefix + strings.ToUpper(name)
+		val, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), val); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, env, err)
+		}
+	}
+	return nil
+}
+
+func setField(f reflect.Value, val string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
 	}
+	return nil
 }
 
 func float64ToStr(val float64) string {
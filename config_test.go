@@ -0,0 +1,121 @@
+package flashdb
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, name, data string) string {
+	dir, err := ioutil.TempDir("", "flashdb-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig_TOML(t *testing.T) {
+	path := writeConfigFile(t, "flashdb.toml", `
+addr = "0.0.0.0:9000"
+path = "/var/lib/flashdb"
+no_sync = true
+max_key_size = 64
+max_memory = 1048576
+eviction_policy = "allkeys-lfu"
+strict_types = true
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	c, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0:9000", c.Addr)
+	assert.Equal(t, "/var/lib/flashdb", c.Path)
+	assert.True(t, c.NoSync)
+	assert.Equal(t, uint32(64), c.MaxKeySize)
+	assert.Equal(t, uint64(1048576), c.MaxMemory)
+	assert.Equal(t, AllKeysLFU, c.EvictionPolicy)
+	assert.True(t, c.StrictTypes)
+
+	// missing values come from the defaults
+	assert.Equal(t, DefaultConfig().EvictionInterval, c.EvictionInterval)
+	assert.Equal(t, DefaultMaxValueSize, c.MaxValueSize)
+}
+
+func TestLoadConfig_JSON(t *testing.T) {
+	path := writeConfigFile(t, "flashdb.json", `{"path": "/data", "eviction_interval": 30}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	c, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "/data", c.Path)
+	assert.Equal(t, 30, c.EvictionInterval)
+	assert.Equal(t, DefaultAddr, c.Addr)
+}
+
+func TestLoadConfig_DetectFormat(t *testing.T) {
+	path := writeConfigFile(t, "flashdb.conf", `{"path": "/json"}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	c, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "/json", c.Path)
+
+	path = writeConfigFile(t, "flashdb.conf", `path = "/toml"`)
+	defer os.RemoveAll(filepath.Dir(path))
+	c, err = LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "/toml", c.Path)
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	path := writeConfigFile(t, "flashdb.toml", `eviction_interval = -1`)
+	defer os.RemoveAll(filepath.Dir(path))
+	_, err := LoadConfig(path)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	path = writeConfigFile(t, "flashdb.json", `{"path": `)
+	defer os.RemoveAll(filepath.Dir(path))
+	_, err = LoadConfig(path)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	_, err = LoadConfig("does-not-exist.toml")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLoadConfig_Env(t *testing.T) {
+	path := writeConfigFile(t, "flashdb.toml", `path = "/from/file"`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	os.Setenv("FLASHDB_PATH", "/from/env")
+	os.Setenv("FLASHDB_NO_SYNC", "true")
+	os.Setenv("FLASHDB_MAX_VALUE_SIZE", "128")
+	defer os.Unsetenv("FLASHDB_PATH")
+	defer os.Unsetenv("FLASHDB_NO_SYNC")
+	defer os.Unsetenv("FLASHDB_MAX_VALUE_SIZE")
+
+	c, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "/from/env", c.Path)
+	assert.True(t, c.NoSync)
+	assert.Equal(t, uint32(128), c.MaxValueSize)
+
+	os.Setenv("FLASHDB_EVICTION_INTERVAL", "ten")
+	defer os.Unsetenv("FLASHDB_EVICTION_INTERVAL")
+	_, err = LoadConfig(path)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New(&Config{EvictionInterval: -1})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	_, err = New(&Config{EvictionPolicy: "lru"})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
@@ -1,49 +1,151 @@
 package flashdb
 
 import (
-	"time"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/arriqaaq/aol"
 )
 
-// load String, Hash, Set and ZSet stores from append-only log
+// load String, Hash, Set, ZSet and List stores from the latest snapshot, if any, and
+// the append-only log records written after it.
 func (db *FlashDB) load() error {
 	if db.log == nil {
 		return nil
 	}
 
+	pos, recs := db.loadSnapshot()
+	for _, r := range recs {
+		if err := db.loadRecord(r); err != nil {
+			return loadError(err)
+		}
+	}
+
+	n, err := db.replay(pos)
+	if err != nil {
+		return loadError(err)
+	}
+
+	// The snapshot is ahead of the log, so it was not taken from this log.
+	// Start over from an empty database and replay the whole log.
+	if n < pos {
+		db.reset()
+		if n, err = db.replay(0); err != nil {
+			return loadError(err)
+		}
+	}
+
+	atomic.StoreUint64(&db.logCount, n)
+	return nil
+}
+
+// loadError explains a size limit hit while loading: the log was written
+// with larger limits, or none, and cannot be opened until they are raised.
+func loadError(err error) error {
+	var limitErr *SizeLimitError
+	if errors.As(err, &limitErr) {
+		return fmt.Errorf("the log holds a record over the size limits, raise them or set them to 0 to open it: %w", err)
+	}
+	return err
+}
+
+// replay loads the records in the append-only log, skipping the first pos of
+// them. It returns the total number of records in the log.
+func (db *FlashDB) replay(pos uint64) (n uint64, err error) {
 	noOfSegments := db.log.Segments()
 	for i := 1; i <= noOfSegments; i++ {
-		j := 0
-
-		for {
+		for j := 0; ; j++ {
 			data, err := db.log.Read(uint64(i), uint64(j))
 			if err != nil {
 				if err == aol.ErrEOF {
 					break
 				}
-				return err
+				return n, &CorruptRecordError{Segment: uint64(i), Index: uint64(j), Err: err}
+			}
+
+			if n++; n <= pos {
+				continue
 			}
 
 			record, err := decode(data)
 			if err != nil {
-				return err
+				if db.config.TruncateCorruptTail && db.isTornTail(i, j) {
+					return n - 1, db.truncateLog(uint64(i), uint64(j))
+				}
+				return n, &CorruptRecordError{Segment: uint64(i), Index: uint64(j), Err: err}
 			}
 
 			if len(record.meta.key) > 0 {
 				if err := db.loadRecord(record); err != nil {
-					return err
+					return n, err
 				}
 			}
+		}
+	}
+
+	return n, nil
+}
 
-			j++
+// isTornTail reports whether the record at index j of segment i, along with
+// every record after it, sits at the end of the log and cannot be decoded.
+// This is what a write interrupted by a crash leaves behind.
+func (db *FlashDB) isTornTail(i, j int) bool {
+	if i != db.log.Segments() {
+		return false
+	}
+	for ; ; j++ {
+		data, err := db.log.Read(uint64(i), uint64(j))
+		if err == aol.ErrEOF {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+		if _, err := decode(data); err == nil {
+			return false
 		}
 	}
+}
+
+// truncateLog drops the records from the given segment and index onwards, and
+// reopens the log.
+func (db *FlashDB) truncateLog(segment, index uint64) error {
+	if err := db.log.Close(); err != nil {
+		return err
+	}
+	if err := truncateSegment(db.config.Path, segment, index); err != nil {
+		return err
+	}
 
+	l, err := db.openLog()
+	if err != nil {
+		return err
+	}
+	db.log = l
 	return nil
 }
 
+// reset empties all the stores.
+func (db *FlashDB) reset() {
+	db.strStore = newStrStore()
+	db.hashStore = newHashStore()
+	db.setStore = newSetStore()
+	db.zsetStore = newZSetStore()
+	db.listStore = newListStore()
+	db.exps = newExpiry()
+	db.fieldExps = newExpiry()
+	db.mem = newMemory()
+}
+
 func (db *FlashDB) loadRecord(r *record) (err error) {
+	if err = db.checkRecord(r); err != nil {
+		return
+	}
+	if err = db.validateRecord(r); err != nil {
+		return
+	}
 
 	switch r.getType() {
 	case StringRecord:
@@ -54,6 +156,8 @@ func (db *FlashDB) loadRecord(r *record) (err error) {
 		err = db.buildSetRecord(r)
 	case ZSetRecord:
 		err = db.buildZsetRecord(r)
+	case ListRecord:
+		err = db.buildListRecord(r)
 	}
 	return
 }
@@ -70,21 +174,79 @@ func (db *FlashDB) buildStringRecord(r *record) error {
 	switch r.getMark() {
 	case StringSet:
 		db.strStore.Insert([]byte(key), member)
+	case StringSetClearTTL:
+		db.strStore.Insert([]byte(key), member)
+		db.exps.HDel(String, key)
+	case StringAppend:
+		val, _ := db.strStore.get(key)
+		db.strStore.Insert([]byte(key), toString(val)+member)
+	case StringSetRange:
+		offset, err := strconv.Atoi(string(r.meta.value))
+		if err != nil {
+			return err
+		}
+		val, _ := db.strStore.get(key)
+		db.strStore.Insert([]byte(key), setRange(toString(val), offset, member))
+	case StringPersist:
+		db.exps.HDel(String, key)
+	case StringSetEx:
+		if r.timestamp < uint64(nowMs()) {
+			db.strStore.Delete([]byte(key))
+			db.exps.HDel(String, key)
+		} else {
+			db.strStore.Insert([]byte(key), member)
+			db.setTTL(String, key, int64(r.timestamp))
+		}
 	case StringRem:
 		db.strStore.Delete([]byte(key))
 		db.exps.HDel(String, key)
 	case StringExpire:
-		if r.timestamp < uint64(time.Now().Unix()) {
+		if r.timestamp < uint64(nowMs()) {
 			db.strStore.Delete([]byte(key))
 			db.exps.HDel(String, key)
 		} else {
 			db.setTTL(String, key, int64(r.timestamp))
 		}
+	case StringIncrBy:
+		delta, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return err
+		}
+		n, err := incrBy(db.strValue(key), delta)
+		if err != nil {
+			return err
+		}
+		db.strStore.Insert([]byte(key), strconv.FormatInt(n, 10))
+	case StringIncrByFloat:
+		delta, err := strToFloat64(member)
+		if err != nil {
+			return err
+		}
+		f, err := incrByFloat(db.strValue(key), delta)
+		if err != nil {
+			return err
+		}
+		db.strStore.Insert([]byte(key), float64ToStr(f))
 	}
 
+	if val, err := db.strStore.get(key); err == nil {
+		db.mem.set(String, key, int64(len(val.(string))))
+	} else {
+		db.mem.remove(String, key)
+	}
 	return nil
 }
 
+// strValue returns the value of the string at key, or "0" if there is none,
+// for the counters to increment.
+func (db *FlashDB) strValue(key string) string {
+	val, err := db.strStore.get(key)
+	if err != nil {
+		return "0"
+	}
+	return val.(string)
+}
+
 func (db *FlashDB) buildHashRecord(r *record) error {
 
 	key := string(r.meta.key)
@@ -93,21 +255,42 @@ func (db *FlashDB) buildHashRecord(r *record) error {
 
 	switch r.getMark() {
 	case HashHSet:
+		db.mem.add(Hash, key, elemSize(member, value)-db.hashFieldSize(key, member))
 		db.hashStore.HSet(key, member, value)
+		db.fieldExps.HDel(key, member)
 	case HashHDel:
+		db.mem.add(Hash, key, -db.hashFieldSize(key, member))
 		db.hashStore.HDel(key, member)
+		db.fieldExps.HDel(key, member)
 	case HashHClear:
 		db.hashStore.HClear(key)
 		db.exps.HDel(Hash, key)
+		db.fieldExps.HClear(key)
 	case HashHExpire:
-		if r.timestamp < uint64(time.Now().Unix()) {
+		if r.timestamp < uint64(nowMs()) {
 			db.hashStore.HClear(key)
 			db.exps.HDel(Hash, key)
+			db.fieldExps.HClear(key)
 		} else {
 			db.setTTL(Hash, key, int64(r.timestamp))
 		}
+	case HashHPersist:
+		db.exps.HDel(Hash, key)
+	case HashHFieldExpire:
+		if r.timestamp < uint64(nowMs()) {
+			db.mem.add(Hash, key, -db.hashFieldSize(key, member))
+			db.hashStore.HDel(key, member)
+			db.fieldExps.HDel(key, member)
+		} else {
+			db.fieldExps.HSet(key, member, int64(r.timestamp))
+		}
+	case HashHFieldPersist:
+		db.fieldExps.HDel(key, member)
 	}
 
+	if db.hashStore.HLen(key) == 0 {
+		db.mem.remove(Hash, key)
+	}
 	return nil
 }
 
@@ -119,23 +302,43 @@ func (db *FlashDB) buildSetRecord(r *record) error {
 
 	switch r.getMark() {
 	case SetSAdd:
+		if !db.setStore.SIsMember(key, member) {
+			db.mem.add(Set, key, elemSize(member, ""))
+		}
 		db.setStore.SAdd(key, member)
 	case SetSRem:
+		if db.setStore.SIsMember(key, member) {
+			db.mem.add(Set, key, -elemSize(member, ""))
+		}
 		db.setStore.SRem(key, member)
 	case SetSMove:
+		if db.setStore.SIsMember(key, member) {
+			db.mem.add(Set, key, -elemSize(member, ""))
+			if !db.setStore.SIsMember(value, member) {
+				db.mem.add(Set, value, elemSize(member, ""))
+			}
+		}
 		db.setStore.SMove(key, value, member)
+		if db.setStore.SCard(value) == 0 {
+			db.mem.remove(Set, value)
+		}
 	case SetSClear:
 		db.setStore.SClear(key)
 		db.exps.HDel(Set, key)
 	case SetSExpire:
-		if r.timestamp < uint64(time.Now().Unix()) {
+		if r.timestamp < uint64(nowMs()) {
 			db.setStore.SClear(key)
 			db.exps.HDel(Set, key)
 		} else {
 			db.setTTL(Set, key, int64(r.timestamp))
 		}
+	case SetSPersist:
+		db.exps.HDel(Set, key)
 	}
 
+	if db.setStore.SCard(key) == 0 {
+		db.mem.remove(Set, key)
+	}
 	return nil
 }
 
@@ -151,20 +354,126 @@ func (db *FlashDB) buildZsetRecord(r *record) error {
 		if err != nil {
 			return err
 		}
+		if ok, _ := db.zsetStore.ZScore(key, member); !ok {
+			db.mem.add(ZSet, key, elemSize(member, "")+scoreSize)
+		}
 		db.zsetStore.ZAdd(key, score, member, nil)
 	case ZSetZRem:
-		db.zsetStore.ZRem(key, member)
+		if db.zsetStore.ZRem(key, member) {
+			db.mem.add(ZSet, key, -elemSize(member, "")-scoreSize)
+		}
 	case ZSetZClear:
 		db.zsetStore.ZClear(key)
 		db.exps.HDel(ZSet, key)
 	case ZSetZExpire:
-		if r.timestamp < uint64(time.Now().Unix()) {
+		if r.timestamp < uint64(nowMs()) {
 			db.zsetStore.ZClear(key)
 			db.exps.HDel(ZSet, key)
 		} else {
 			db.setTTL(ZSet, key, int64(r.timestamp))
 		}
+	case ZSetZPersist:
+		db.exps.HDel(ZSet, key)
 	}
 
+	if db.zsetStore.ZCard(key) == 0 {
+		db.mem.remove(ZSet, key)
+	}
 	return nil
 }
+
+func (db *FlashDB) buildListRecord(r *record) error {
+
+	key := string(r.meta.key)
+	member := string(r.meta.member)
+	value := string(r.meta.value)
+
+	switch r.getMark() {
+	case ListLPush:
+		db.listStore.LPush(key, member)
+		db.mem.add(List, key, elemSize(member, ""))
+	case ListRPush:
+		db.listStore.RPush(key, member)
+		db.mem.add(List, key, elemSize(member, ""))
+	case ListLPop:
+		if val, ok := db.listStore.LPop(key); ok {
+			db.mem.add(List, key, -elemSize(val, ""))
+		}
+	case ListRPop:
+		if val, ok := db.listStore.RPop(key); ok {
+			db.mem.add(List, key, -elemSize(val, ""))
+		}
+	case ListLSet:
+		index, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		old, _ := db.listStore.LIndex(key, index)
+		if db.listStore.LSet(key, index, member) {
+			db.mem.add(List, key, elemSize(member, "")-elemSize(old, ""))
+		}
+	case ListLRem:
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		n := db.listStore.LRem(key, count, member)
+		db.mem.add(List, key, -int64(n)*elemSize(member, ""))
+	case ListLTrim:
+		start, err := strconv.Atoi(member)
+		if err != nil {
+			return err
+		}
+		stop, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		db.trimList(key, start, stop)
+	case ListLInsertBefore:
+		if db.listStore.LInsert(key, Before, value, member) > 0 {
+			db.mem.add(List, key, elemSize(member, ""))
+		}
+	case ListLInsertAfter:
+		if db.listStore.LInsert(key, After, value, member) > 0 {
+			db.mem.add(List, key, elemSize(member, ""))
+		}
+	case ListLClear:
+		db.listStore.LClear(key)
+		db.exps.HDel(List, key)
+	case ListLExpire:
+		if r.timestamp < uint64(nowMs()) {
+			db.listStore.LClear(key)
+			db.exps.HDel(List, key)
+		} else {
+			db.setTTL(List, key, int64(r.timestamp))
+		}
+	case ListLPersist:
+		db.exps.HDel(List, key)
+	}
+
+	if db.listStore.LLen(key) == 0 {
+		db.mem.remove(List, key)
+	}
+	return nil
+}
+
+// trimList trims the list stored at key as LTrim does, popping the elements
+// removed so that the memory they used is released.
+func (db *FlashDB) trimList(key string, start, stop int) {
+	n := db.listStore.LLen(key)
+	start, stop, ok := listRange(n, start, stop)
+	if !ok {
+		db.listStore.LClear(key)
+		return
+	}
+	for i := 0; i < start; i++ {
+		if val, ok := db.listStore.LPop(key); ok {
+			db.mem.add(List, key, -elemSize(val, ""))
+		}
+	}
+	for i := stop + 1; i < n; i++ {
+		if val, ok := db.listStore.RPop(key); ok {
+			db.mem.add(List, key, -elemSize(val, ""))
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package flashdb
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/arriqaaq/aol"
 	"github.com/stretchr/testify/assert"
@@ -67,3 +70,138 @@ func TestFlashDB_load(t *testing.T) {
 
 	}
 }
+
+func appendToSegment(t *testing.T, segment uint64, data []byte) {
+	f, err := os.OpenFile(segmentPath(tmpDir, segment), os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlashDB_loadTornWrite(t *testing.T) {
+	defer os.RemoveAll(tmpDir)
+
+	db := getTestDB()
+	makeLoadRecords(2, db)
+	db.Close()
+
+	// a frame claiming 100 bytes with only 3 written
+	appendToSegment(t, 1, []byte{100, 1, 2, 3})
+
+	_, err := New(testConfig())
+	assert.True(t, errors.Is(err, ErrCorruptRecord))
+	var cerr *CorruptRecordError
+	assert.True(t, errors.As(err, &cerr))
+	assert.Equal(t, uint64(1), cerr.Segment)
+	assert.Equal(t, uint64(8), cerr.Index)
+
+	config := testConfig()
+	config.TruncateCorruptTail = true
+	db2, err := New(config)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(8), db2.logCount)
+
+	db2.Update(func(tx *Tx) error {
+		return tx.Set("after", "repair")
+	})
+	db2.Close()
+
+	db3 := getTestDB()
+	defer db3.Close()
+	db3.View(func(tx *Tx) error {
+		val, err := tx.Get("after")
+		assert.NoError(t, err)
+		assert.Equal(t, "repair", val)
+		assert.Equal(t, "value_2", tx.HGet("key_2", "member_2"))
+		return nil
+	})
+}
+
+func TestFlashDB_loadCorruptTail(t *testing.T) {
+	defer os.RemoveAll(tmpDir)
+
+	db := getTestDB()
+	makeLoadRecords(2, db)
+	db.Close()
+
+	// a complete frame whose record fails the checksum
+	rec, _ := newRecord([]byte("key"), []byte("value"), StringRecord, StringSet).encode()
+	rec[len(rec)-1] ^= 0xff
+	frame := append([]byte{byte(len(rec))}, rec...)
+	appendToSegment(t, 1, frame)
+
+	_, err := New(testConfig())
+	var cerr *CorruptRecordError
+	assert.True(t, errors.As(err, &cerr))
+	assert.Equal(t, uint64(1), cerr.Segment)
+	assert.Equal(t, uint64(8), cerr.Index)
+	assert.Equal(t, ErrInvalidChecksum, cerr.Err)
+
+	config := testConfig()
+	config.TruncateCorruptTail = true
+	db2, err := New(config)
+	assert.NoError(t, err)
+	defer db2.Close()
+	assert.Equal(t, uint64(8), db2.logCount)
+
+	info, err := os.Stat(segmentPath(tmpDir, 1))
+	assert.NoError(t, err)
+	data, _ := ioutil.ReadFile(segmentPath(tmpDir, 1))
+	_, end := scanEntries(data)
+	assert.Equal(t, int64(end), info.Size())
+}
+
+func TestFlashDB_loadCorruptMiddle(t *testing.T) {
+	defer os.RemoveAll(tmpDir)
+
+	db := getTestDB()
+	makeLoadRecords(1, db)
+	db.Close()
+
+	rec, _ := newRecord([]byte("key"), []byte("value"), StringRecord, StringSet).encode()
+	valid := append([]byte{byte(len(rec))}, rec...)
+	rec[len(rec)-1] ^= 0xff
+	appendToSegment(t, 1, append([]byte{byte(len(rec))}, rec...))
+	appendToSegment(t, 1, valid)
+
+	// valid records follow the corrupt one, so it is not a torn write
+	config := testConfig()
+	config.TruncateCorruptTail = true
+	_, err := New(config)
+	var cerr *CorruptRecordError
+	assert.True(t, errors.As(err, &cerr))
+	assert.Equal(t, uint64(4), cerr.Index)
+}
+
+func TestFlashDB_loadSecondsDeadline(t *testing.T) {
+	defer os.RemoveAll(tmpDir)
+
+	db := getTestDB()
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("live", "1"))
+		return tx.Set("dead", "1")
+	})
+	assert.NoError(t, err)
+
+	// deadlines written in Unix seconds by older versions
+	now := time.Now().Unix()
+	for key, deadline := range map[string]int64{"live": now + 100, "dead": now - 100} {
+		r := newRecordWithExpire([]byte(key), nil, deadline, StringRecord, StringExpire)
+		assert.NoError(t, db.log.Write(encodeSeconds(t, r)))
+	}
+	assert.NoError(t, db.Close())
+
+	db = getTestDB()
+	defer db.Close()
+	err = db.View(func(tx *Tx) error {
+		ttl := tx.TTL("live")
+		assert.True(t, ttl > 0 && ttl <= 100)
+		assert.False(t, tx.Exists("dead"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -4,8 +4,6 @@ import (
 	"math/rand"
 	"runtime"
 	"time"
-
-	"github.com/arriqaaq/hash"
 )
 
 const (
@@ -25,15 +23,15 @@ func startupDelay() time.Duration {
 }
 
 type evictor interface {
-	run(cache *hash.Hash)
+	run()
 	stop()
 }
 
-func newSweeperWithStore(s store, sweepTime time.Duration) evictor {
+func newSweeper(db *FlashDB, sweepTime time.Duration) evictor {
 	var swp = &sweeper{
 		interval: sweepTime,
 		stopC:    make(chan bool),
-		store:    s,
+		db:       db,
 	}
 	runtime.SetFinalizer(swp, stopSweeper)
 	return swp
@@ -43,19 +41,24 @@ func stopSweeper(c evictor) {
 	c.stop()
 }
 
+// sweeper removes expired keys from the database periodically, with
+// EvictExpired. Errors are passed to Config.OnEvictionError.
 type sweeper struct {
-	store    store
+	db       *FlashDB
 	interval time.Duration
 	stopC    chan bool
 }
 
-func (s *sweeper) run(cache *hash.Hash) {
+func (s *sweeper) run() {
 	<-time.After(startupDelay())
 	ticker := time.NewTicker(s.interval)
 	for {
 		select {
 		case <-ticker.C:
-			s.store.evict(cache)
+			_, err := s.db.EvictExpired()
+			if err != nil && err != ErrDatabaseClosed && s.db.config.OnEvictionError != nil {
+				s.db.config.OnEvictionError(err)
+			}
 		case <-s.stopC:
 			ticker.Stop()
 			return
@@ -0,0 +1,282 @@
+package flashdb
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// sweepSamples is the number of keys with a TTL sampled by each round of
+	// a sweep.
+	sweepSamples = 20
+	// sweepBudget bounds the time spent sampling by a sweep, for every data
+	// type and the hash fields together. Past it, each group only gets the
+	// single round of sampling that guarantees progress.
+	sweepBudget = 25 * time.Millisecond
+)
+
+// expiry is the index of TTL deadlines, in Unix milliseconds, by group and
+// key. The groups of exps are the data types, and those of fieldExps are the
+// hash keys whose fields have a TTL.
+//
+// Besides the lookup by key, it keeps the groups and the keys of each group in
+// slices, so that the sweeper can sample them at random in constant time. The
+// cost of a sweep depends on the number of expired keys, not on the number of
+// keys in the stores.
+type expiry struct {
+	mu        sync.Mutex
+	deadlines map[string]map[string]int64
+	keys      map[string]*keySet // keys of each group
+	groups    *keySet            // groups with at least one key
+}
+
+func newExpiry() *expiry {
+	return &expiry{
+		deadlines: make(map[string]map[string]int64),
+		keys:      make(map[string]*keySet),
+		groups:    newKeySet(),
+	}
+}
+
+// HSet sets the deadline of key in group.
+func (e *expiry) HSet(group, key string, deadline int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.deadlines[group] == nil {
+		e.deadlines[group] = make(map[string]int64)
+		e.keys[group] = newKeySet()
+		e.groups.add(group)
+	}
+	e.deadlines[group][key] = deadline
+	e.keys[group].add(key)
+}
+
+// HGet returns the deadline of key in group as an int64, or nil if the key
+// has no TTL.
+func (e *expiry) HGet(group, key string) interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	deadline, ok := e.deadlines[group][key]
+	if !ok {
+		return nil
+	}
+	return deadline
+}
+
+// HDel removes the deadline of key in group.
+func (e *expiry) HDel(group, key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.deadlines[group][key]; !ok {
+		return
+	}
+	delete(e.deadlines[group], key)
+	e.keys[group].remove(key)
+	if e.keys[group].len() == 0 {
+		e.clear(group)
+	}
+}
+
+// HClear removes the deadlines of every key in group.
+func (e *expiry) HClear(group string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clear(group)
+}
+
+func (e *expiry) clear(group string) {
+	delete(e.deadlines, group)
+	delete(e.keys, group)
+	e.groups.remove(group)
+}
+
+// HKeys returns the keys with a deadline in group.
+func (e *expiry) HKeys(group string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.keys[group] == nil {
+		return nil
+	}
+	return append([]string(nil), e.keys[group].keys...)
+}
+
+// HLen returns the number of keys with a deadline in group.
+func (e *expiry) HLen(group string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.deadlines[group])
+}
+
+// Len returns the number of keys with a deadline.
+func (e *expiry) Len() (n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, keys := range e.keys {
+		n += keys.len()
+	}
+	return
+}
+
+// expired returns the expired keys of group. It does not remove them, which
+// is left to the caller.
+//
+// As in Redis, it checks sweepSamples keys with a TTL picked at random, and
+// goes on with another round while more than a quarter of them had expired,
+// until end. A group of at most sweepSamples keys is checked in full.
+func (e *expiry) expired(group string, end time.Time) []expiryEntry {
+	e.mu.Lock()
+	var small []string
+	if keys := e.keys[group]; keys != nil && keys.len() <= sweepSamples {
+		small = append(small, keys.keys...)
+	}
+	e.mu.Unlock()
+
+	if small != nil {
+		var res []expiryEntry
+		now := nowMs()
+		for _, key := range small {
+			if deadline := e.HGet(group, key); deadline != nil && now > deadline.(int64) {
+				res = append(res, expiryEntry{group, key})
+			}
+		}
+		return res
+	}
+
+	return e.sample(end, func() (string, string, bool) {
+		return e.random(group)
+	})
+}
+
+// expiredAll is like expired, but samples the keys of every group.
+func (e *expiry) expiredAll(end time.Time) []expiryEntry {
+	return e.sample(end, func() (string, string, bool) {
+		entry, ok := e.randomEntry()
+		return entry.group, entry.key, ok
+	})
+}
+
+// randomEntry returns a key of a group, both picked at random.
+func (e *expiry) randomEntry() (expiryEntry, bool) {
+	e.mu.Lock()
+	group, ok := e.groups.random()
+	e.mu.Unlock()
+	if !ok {
+		return expiryEntry{}, false
+	}
+	group, key, ok := e.random(group)
+	return expiryEntry{group, key}, ok
+}
+
+// expiryEntry is a key of a group in expiry.
+type expiryEntry struct {
+	group, key string
+}
+
+func (e *expiry) sample(end time.Time, pick func() (string, string, bool)) (res []expiryEntry) {
+	seen := make(map[expiryEntry]bool)
+	for {
+		sampled, expired := 0, 0
+		now := nowMs()
+		for ; sampled < sweepSamples; sampled++ {
+			group, key, ok := pick()
+			if !ok {
+				break
+			}
+			entry := expiryEntry{group, key}
+			if seen[entry] {
+				continue
+			}
+			seen[entry] = true
+
+			deadline := e.HGet(group, key)
+			if deadline == nil || now <= deadline.(int64) {
+				continue
+			}
+			res = append(res, entry)
+			expired++
+		}
+
+		if sampled == 0 || expired*4 <= sampled || time.Now().After(end) {
+			return
+		}
+	}
+}
+
+// random returns a key of group picked at random.
+func (e *expiry) random(group string) (string, string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	keys := e.keys[group]
+	if keys == nil {
+		return "", "", false
+	}
+	key, ok := keys.random()
+	return group, key, ok
+}
+
+// keySet is a set of keys that can be picked at random in constant time, and
+// scanned with a cursor.
+type keySet struct {
+	pos  map[string]int // index of each key in keys
+	keys []string
+}
+
+func newKeySet() *keySet {
+	return &keySet{pos: make(map[string]int)}
+}
+
+func (s *keySet) add(key string) {
+	if _, ok := s.pos[key]; ok {
+		return
+	}
+	s.pos[key] = len(s.keys)
+	s.keys = append(s.keys, key)
+}
+
+// remove removes key by moving the last key in its place.
+func (s *keySet) remove(key string) {
+	i, ok := s.pos[key]
+	if !ok {
+		return
+	}
+	last := s.keys[len(s.keys)-1]
+	s.keys[i] = last
+	s.pos[last] = i
+	s.keys = s.keys[:len(s.keys)-1]
+	delete(s.pos, key)
+}
+
+func (s *keySet) len() int {
+	return len(s.keys)
+}
+
+func (s *keySet) random() (string, bool) {
+	if len(s.keys) == 0 {
+		return "", false
+	}
+	return s.keys[rand.Intn(len(s.keys))], true
+}
+
+// scan returns up to count keys from cursor, the number of keys left to scan,
+// and the cursor after them. A negative cursor starts a scan. The keys are
+// scanned from the last one down: removing a key moves the last key in its
+// place, which only moves a key left to scan further down, or a key already
+// scanned back into those left, so that a key present for the whole scan is
+// returned at least once.
+func (s *keySet) scan(cursor, count int) ([]string, int) {
+	if cursor < 0 || cursor > len(s.keys) {
+		cursor = len(s.keys)
+	}
+	n := min(cursor, count)
+	keys := make([]string, n)
+	copy(keys, s.keys[cursor-n:cursor])
+	return keys, cursor - n
+}
@@ -0,0 +1,196 @@
+package flashdb
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlashDB_Expiry(t *testing.T) {
+	e := newExpiry()
+
+	e.HSet(String, "a", 1)
+	e.HSet(String, "b", 2)
+	e.HSet(Hash, "a", 3)
+	assert.Equal(t, int64(1), e.HGet(String, "a"))
+	assert.Nil(t, e.HGet(Set, "a"))
+	assert.ElementsMatch(t, []string{"a", "b"}, e.HKeys(String))
+	assert.Equal(t, 3, e.Len())
+
+	e.HDel(String, "a")
+	e.HDel(String, "missing")
+	assert.Nil(t, e.HGet(String, "a"))
+	assert.Equal(t, []string{"b"}, e.HKeys(String))
+
+	e.HClear(Hash)
+	assert.Nil(t, e.HKeys(Hash))
+	e.HDel(String, "b")
+	assert.Equal(t, 0, e.Len())
+	assert.Equal(t, 0, e.groups.len())
+}
+
+func TestFlashDB_PExpireAllTypes(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.HSet("h", "a", "1")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.SAdd("s", "a"))
+		assert.NoError(t, tx.ZAdd("z", 1, "a"))
+		_, err = tx.RPush("l", "a")
+		assert.NoError(t, err)
+
+		assert.NoError(t, tx.HPExpire("h", 50))
+		assert.NoError(t, tx.SPExpire("s", 50))
+		assert.NoError(t, tx.ZPExpireAt("z", time.Now().UnixMilli()+50))
+		assert.NoError(t, tx.LExpireAt("l", time.Now().Unix()+100))
+		assert.Equal(t, ErrInvalidKey, tx.SPExpire("missing", 50))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		for _, pttl := range []int64{tx.HPTTL("h"), tx.SPTTL("s"), tx.ZPTTL("z")} {
+			assert.True(t, pttl > 0 && pttl <= 50)
+		}
+		assert.Equal(t, int64(1), tx.HTTL("h"))
+		assert.True(t, tx.LPTTL("l") > 98000)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	err = db.View(func(tx *Tx) error {
+		assert.False(t, tx.HKeyExists("h"))
+		assert.False(t, tx.SKeyExists("s"))
+		assert.False(t, tx.ZKeyExists("z"))
+		assert.True(t, tx.LKeyExists("l"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_ExpirySweep(t *testing.T) {
+	e := newExpiry()
+	past, future := nowMs()-1, nowMs()+60000
+	end := time.Now().Add(sweepBudget)
+
+	// every key of a small group is checked
+	e.HSet(String, "expired", past)
+	e.HSet(String, "live", future)
+	assert.Equal(t, []expiryEntry{{String, "expired"}}, e.expired(String, end))
+	assert.Equal(t, 2, e.Len(), "expired keys are left to the caller")
+	e.HClear(String)
+
+	// most of a large group of expired keys is sampled
+	for i := 0; i < 100; i++ {
+		e.HSet(String, fmt.Sprintf("expired_%d", i), past)
+	}
+	assert.True(t, len(e.expired(String, end)) >= sweepSamples/2)
+	// past the budget of the sweep, a single round is sampled
+	assert.True(t, len(e.expired(String, time.Now())) <= sweepSamples)
+
+	// the sampling stops once few samples expired
+	e.HClear(String)
+	for i := 0; i < 1000; i++ {
+		e.HSet(String, fmt.Sprintf("live_%d", i), future)
+	}
+	e.HSet(String, "expired", past)
+	assert.Subset(t, []expiryEntry{{String, "expired"}}, e.expired(String, end))
+
+	// expiredAll samples across the groups
+	e.HSet("h1", "f", past)
+	e.HSet("h2", "f", past)
+	e.HSet("h3", "f", future)
+	for _, entry := range e.expiredAll(end) {
+		assert.NotEqual(t, "h3", entry.group)
+		assert.Equal(t, past, e.HGet(entry.group, entry.key))
+	}
+}
+
+func TestFlashDB_EvictExpired(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("a", "1"))
+		assert.NoError(t, tx.PExpire("a", 10))
+		assert.NoError(t, tx.SAdd("s", "1"))
+		return tx.SPExpire("s", 10)
+	})
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	// a read-only transaction reads the keys as missing, without writing
+	count := atomic.LoadUint64(&db.logCount)
+	err = db.View(func(tx *Tx) error {
+		assert.False(t, tx.Exists("a"))
+		assert.False(t, tx.SKeyExists("s"))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, count, atomic.LoadUint64(&db.logCount))
+
+	n, err := db.EvictExpired()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, count+2, atomic.LoadUint64(&db.logCount))
+	assert.Equal(t, 0, db.exps.Len())
+
+	// the removals survive a restart, even once the deadlines are forgotten
+	assert.NoError(t, db.Close())
+	db = getTestDB()
+	defer db.Close()
+	assert.Nil(t, db.strStore.Search([]byte("a")))
+	assert.False(t, db.setStore.SKeyExists("s"))
+
+	_, err = db.EvictExpired()
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+	_, err = db.EvictExpired()
+	assert.Equal(t, ErrDatabaseClosed, err)
+}
+
+func TestFlashDB_WriteExpiredKey(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.SAdd("s", "old"))
+		return tx.SPExpire("s", 10)
+	})
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	// the write starts from an empty set, in the transaction and on commit
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.SAdd("s", "new"))
+		assert.Equal(t, []string{"new"}, tx.SMembers("s"))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"new"}, db.setStore.SMembers("s"))
+	assert.Nil(t, db.getTTL(Set, "s"))
+
+	// a read in a read/write transaction removes the expired key on commit
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("a", "1"))
+		return tx.PExpire("a", 10)
+	})
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	err = db.Update(func(tx *Tx) error {
+		assert.False(t, tx.Exists("a"))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, db.strStore.Search([]byte("a")))
+	assert.Nil(t, db.getTTL(String, "a"))
+}
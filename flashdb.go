@@ -2,11 +2,11 @@ package flashdb
 
 import (
 	"errors"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/arriqaaq/aol"
-	"github.com/arriqaaq/hash"
 )
 
 var (
@@ -16,30 +16,45 @@ var (
 	ErrTxClosed       = errors.New("tx closed")
 	ErrDatabaseClosed = errors.New("database closed")
 	ErrTxNotWritable  = errors.New("tx not writable")
+	ErrOutOfMemory    = errors.New("out of memory: used memory is over max_memory")
+	ErrWrongType      = errors.New("operation against a key holding the wrong kind of value")
 )
 
 type (
 	FlashDB struct {
-		mu     sync.RWMutex
-		config *Config
-		exps   *hash.Hash // hashmap of ttl keys
-		log    *aol.Log
+		mu        sync.RWMutex
+		config    *Config
+		exps      *expiry     // hashmap of ttl keys
+		fieldExps fieldExpiry // hashmap of ttl hash fields, by key and field
+		log       *aol.Log
+		logCount  uint64 // number of records in the log, accessed atomically
 
 		closed  bool // set when the database has been closed
 		persist bool // do we write to disk
 
 		strStore  *strStore
-		hashStore *hashStore
-		setStore  *setStore
-		zsetStore *zsetStore
+		hashStore hashStorage
+		setStore  setStorage
+		zsetStore zsetStorage
+		listStore listStorage
+
+		mem *memory // estimated memory used by the keys, and their accesses
 
 		evictors []evictor // background manager to delete keys periodically
+
+		blocked *blockedClients // clients blocked on lists by BLPop and friends
+		subs    *subscribers    // subscriptions to the changes of the keys
+		pubsub  *pubSubHub      // subscribers of the pub/sub channels
+
+		rewrite *rewriteBuffer // set while the log is being rewritten
 	}
 )
 
 func New(config *Config) (*FlashDB, error) {
 
-	config.validate()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
 
 	db := &FlashDB{
 		config:    config,
@@ -47,28 +62,23 @@ func New(config *Config) (*FlashDB, error) {
 		setStore:  newSetStore(),
 		hashStore: newHashStore(),
 		zsetStore: newZSetStore(),
-		exps:      hash.New(),
-	}
-
-	evictionInterval := config.evictionInterval()
-	if evictionInterval > 0 {
-		db.evictors = []evictor{
-			newSweeperWithStore(db.strStore, evictionInterval),
-			newSweeperWithStore(db.setStore, evictionInterval),
-			newSweeperWithStore(db.hashStore, evictionInterval),
-			newSweeperWithStore(db.zsetStore, evictionInterval),
-		}
-		for _, evictor := range db.evictors {
-			go evictor.run(db.exps)
-		}
+		listStore: newListStore(),
+		exps:      newExpiry(),
+		fieldExps: newExpiry(),
+		mem:       newMemory(),
+		blocked:   newBlockedClients(),
+		subs:      newSubscribers(),
+		pubsub:    newPubSubHub(config),
 	}
 
 	db.persist = config.Path != ""
 	if db.persist {
-		opts := aol.DefaultOptions
-		opts.NoSync = config.NoSync
+		// finish or undo a log rewrite interrupted by a crash
+		if err := recoverRewrite(config.Path); err != nil {
+			return nil, err
+		}
 
-		l, err := aol.Open(config.Path, opts)
+		l, err := db.openLog()
 		if err != nil {
 			return nil, err
 		}
@@ -82,9 +92,79 @@ func New(config *Config) (*FlashDB, error) {
 		}
 	}
 
+	if config.StrictTypes && config.OnTypeConflict != nil {
+		for _, c := range db.TypeConflicts() {
+			config.OnTypeConflict(c)
+		}
+	}
+
+	if evictionInterval := config.evictionInterval(); evictionInterval > 0 {
+		sweeper := newSweeper(db, evictionInterval)
+		db.evictors = []evictor{sweeper}
+		go sweeper.run()
+	}
+
 	return db, nil
 }
 
+// openLog opens the append-only log at config.Path. If the tail segment ends
+// with a partially written entry, it is either truncated or reported as a
+// CorruptRecordError depending on config.TruncateCorruptTail.
+func (db *FlashDB) openLog() (*aol.Log, error) {
+	opts := *aol.DefaultOptions
+	opts.NoSync = db.config.NoSync
+
+	l, err := aol.Open(db.config.Path, &opts)
+	if err != aol.ErrCorrupt {
+		return l, err
+	}
+
+	segment, index, terr := tornSegment(db.config.Path)
+	if terr != nil {
+		return nil, terr
+	}
+	if !db.config.TruncateCorruptTail {
+		return nil, &CorruptRecordError{Segment: segment, Index: index, Err: err}
+	}
+	if err := truncateSegment(db.config.Path, segment, index); err != nil {
+		return nil, err
+	}
+
+	return aol.Open(db.config.Path, &opts)
+}
+
+// TTL deadlines, in exps and in expire records, are Unix times in milliseconds.
+
+// nowMs returns the current Unix time in milliseconds.
+func nowMs() int64 {
+	return time.Now().UnixMilli()
+}
+
+// deadlineIn returns the deadline of a TTL of d, counted in units of unit.
+func deadlineIn(d int64, unit time.Duration) (int64, error) {
+	ms := int64(unit / time.Millisecond)
+	now := nowMs()
+	if d <= 0 || d > (math.MaxInt64-now)/ms {
+		return 0, ErrInvalidTTL
+	}
+	return now + d*ms, nil
+}
+
+// deadlineAt returns the deadline at the Unix time t, counted in units of
+// unit.
+func deadlineAt(t int64, unit time.Duration) (int64, error) {
+	ms := int64(unit / time.Millisecond)
+	if t <= 0 || t > math.MaxInt64/ms {
+		return 0, ErrInvalidTTL
+	}
+	return t * ms, nil
+}
+
+// ttlSeconds rounds a TTL in milliseconds up to whole seconds.
+func ttlSeconds(ms int64) int64 {
+	return (ms + 999) / 1000
+}
+
 func (db *FlashDB) setTTL(dType DataType, key string, ttl int64) {
 	db.exps.HSet(dType, key, ttl)
 }
@@ -93,46 +173,95 @@ func (db *FlashDB) getTTL(dType DataType, key string) interface{} {
 	return db.exps.HGet(dType, key)
 }
 
+// pttl returns the remaining time to live of the key in milliseconds, or 0 if
+// the key has no TTL.
+func (db *FlashDB) pttl(dType DataType, key string) int64 {
+	deadline := db.getTTL(dType, key)
+	if deadline == nil {
+		return 0
+	}
+	return deadline.(int64) - nowMs()
+}
+
 func (db *FlashDB) hasExpired(key string, dType DataType) (expired bool) {
 	ttl := db.exps.HGet(dType, key)
 	if ttl == nil {
 		return
 	}
-	if time.Now().Unix() > ttl.(int64) {
+	if nowMs() > ttl.(int64) {
 		expired = true
 	}
 	return
 }
 
-func (db *FlashDB) evict(key string, dType DataType) {
-	ttl := db.exps.HGet(dType, key)
-	if ttl == nil {
-		return
+// UsedMemory returns the memory used by the keys of the database, in bytes, as
+// estimated for Config.MaxMemory.
+func (db *FlashDB) UsedMemory() int64 {
+	return db.mem.Used()
+}
+
+// fieldExpired reports whether the field of the hash stored at key has a
+// deadline that has passed.
+func (db *FlashDB) fieldExpired(key, field string) bool {
+	deadline := db.fieldExps.HGet(key, field)
+	return deadline != nil && nowMs() > deadline.(int64)
+}
+
+// evictRecord returns the record removing the key of type dType, which is
+// written when the key has expired or is evicted.
+func evictRecord(dType DataType, key string, cause removalCause) (r *record) {
+	switch dType {
+	case Hash:
+		r = newRecord([]byte(key), nil, HashRecord, HashHClear)
+	case Set:
+		r = newRecord([]byte(key), nil, SetRecord, SetSClear)
+	case ZSet:
+		r = newRecord([]byte(key), nil, ZSetRecord, ZSetZClear)
+	case List:
+		r = newRecord([]byte(key), nil, ListRecord, ListLClear)
+	default:
+		r = newRecord([]byte(key), nil, StringRecord, StringRem)
 	}
+	r.cause = cause
+	return
+}
 
-	var r *record
-	if time.Now().Unix() > ttl.(int64) {
-		switch dType {
-		case String:
-			r = newRecord([]byte(key), nil, StringRecord, StringRem)
-			db.strStore.Delete([]byte(key))
-		case Hash:
-			r = newRecord([]byte(key), nil, HashRecord, HashHClear)
-			db.hashStore.HClear(key)
-		case Set:
-			r = newRecord([]byte(key), nil, SetRecord, SetSClear)
-			db.setStore.SClear(key)
-		case ZSet:
-			r = newRecord([]byte(key), nil, ZSetRecord, ZSetZClear)
-			db.zsetStore.ZClear(key)
+// EvictExpired removes a sample of the expired keys and hash fields, as the
+// background sweeper does. The removals are written to the log in a single
+// read/write transaction, so they are not lost on restart. It returns the
+// number of keys and fields removed.
+func (db *FlashDB) EvictExpired() (n int, err error) {
+	err = db.Update(func(tx *Tx) error {
+		n = 0
+		tx.sweeping = true
+		// one budget for the whole sweep, which holds the write lock
+		end := time.Now().Add(sweepBudget)
+		for _, dType := range dataTypes {
+			for _, e := range db.exps.expired(dType, end) {
+				if err := tx.evict(e.key, dType); err != nil {
+					return err
+				}
+				n++
+			}
 		}
 
-		if err := db.write(r); err != nil {
-			panic(err)
+		for _, e := range db.fieldExps.expiredAll(end) {
+			if !tx.lookup(Hash, e.group).hashStore.HExists(e.group, e.key) {
+				continue
+			}
+			r := newRecord([]byte(e.group), []byte(e.key), HashRecord, HashHDel)
+			r.cause = removedExpired
+			if err := tx.addRecord(r); err != nil {
+				return err
+			}
+			n++
 		}
-
-		db.exps.HDel(dType, key)
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return n, nil
 }
 
 func (db *FlashDB) Close() error {
@@ -140,6 +269,9 @@ func (db *FlashDB) Close() error {
 	for _, evictor := range db.evictors {
 		evictor.stop()
 	}
+	db.blocked.closeAll(ErrDatabaseClosed)
+	db.closeSubscriptions()
+	db.pubsub.closeAll()
 	if db.log != nil {
 		err := db.log.Close()
 		if err != nil {
@@ -148,15 +280,3 @@ func (db *FlashDB) Close() error {
 	}
 	return nil
 }
-
-func (db *FlashDB) write(r *record) error {
-	if db.log == nil {
-		return nil
-	}
-	encVal, err := r.encode()
-	if err != nil {
-		return err
-	}
-
-	return db.log.Write(encVal)
-}
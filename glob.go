@@ -0,0 +1,89 @@
+package flashdb
+
+// globMatch reports whether str matches the glob-style pattern, as in the
+// KEYS command of Redis: '*' matches any sequence of characters, '?' any single
+// character, "[abc]" one of the characters, "[^abc]" any other and "[a-z]" a
+// range of them, and a backslash escapes the character after it.
+func globMatch(pattern, str string) bool {
+	// A mismatch after a '*' backtracks to it, with one more character of
+	// str matched by the star. Only the last star is tracked: the ones
+	// before it can already match as much as needed, so that the match runs
+	// in O(len(pattern)*len(str)).
+	p, s := 0, 0
+	star, starStr := -1, 0
+	for p < len(pattern) || s < len(str) {
+		if p < len(pattern) {
+			switch c := pattern[p]; c {
+			case '*':
+				star, starStr = p, s
+				p++
+				continue
+			case '?':
+				if s < len(str) {
+					p++
+					s++
+					continue
+				}
+			case '[':
+				if s < len(str) {
+					ok, rest := matchClass(pattern[p+1:], str[s])
+					if ok {
+						p = len(pattern) - len(rest)
+						s++
+						continue
+					}
+				}
+			default:
+				next := p + 1
+				if c == '\\' && p+1 < len(pattern) {
+					c = pattern[p+1]
+					next = p + 2
+				}
+				if s < len(str) && str[s] == c {
+					p = next
+					s++
+					continue
+				}
+			}
+		}
+		if star < 0 || starStr == len(str) {
+			return false
+		}
+		starStr++
+		p, s = star+1, starStr
+	}
+	return true
+}
+
+// matchClass matches c against the character class at the start of pattern,
+// right after its '['. It returns the rest of the pattern after the class.
+func matchClass(pattern string, c byte) (bool, string) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+
+	match := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			match = match || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			match = match || lo <= c && c <= hi
+			pattern = pattern[3:]
+		default:
+			match = match || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		// skip the closing ']'
+		pattern = pattern[1:]
+	}
+	return match != not, pattern
+}
@@ -0,0 +1,59 @@
+package flashdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, str string
+		match        bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users", false},
+		{"*:name", "user:1:name", true},
+		{"user:*:name", "user:1:age", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a**b", "axyb", true},
+		{"*a*b", "xaab", true},
+		{"a*b*c", "abbbc", true},
+		{"a*b*c", "abbbcd", false},
+		{"*[0-9]", "key9", true},
+		{`*\\`, `a\\`, true},
+	} {
+		assert.Equal(t, tc.match, globMatch(tc.pattern, tc.str), "%s %s", tc.pattern, tc.str)
+	}
+}
+
+func TestGlobMatchBacktracking(t *testing.T) {
+	// a pattern with many stars that does not match must not backtrack
+	// through every way of splitting the string between them
+	pattern := strings.Repeat("a*", 30) + "b"
+	str := strings.Repeat("a", 1000)
+
+	done := make(chan bool)
+	go func() {
+		done <- globMatch(pattern, str)
+	}()
+	select {
+	case match := <-done:
+		assert.False(t, match)
+	case <-time.After(5 * time.Second):
+		t.Fatal("globMatch did not return")
+	}
+}
@@ -0,0 +1,883 @@
+package flashdb
+
+import (
+	"time"
+
+	"github.com/arriqaaq/set"
+)
+
+// The layers below are the stores of an overlay. Each holds the changes of a
+// transaction to the keys it has touched, as the fields, members or elements
+// written and removed, on top of the store of the database, which is left as
+// it is until the transaction commits. A write costs the size of the change,
+// not that of the key. Keys that have not been touched are read from the
+// store of the database.
+
+// hashLayer is the hash store of an overlay.
+type hashLayer struct {
+	base hashStorage
+	keys map[string]*hashDelta
+}
+
+// hashDelta holds the changes to a hash.
+type hashDelta struct {
+	cleared bool                   // the fields in the database are removed
+	fields  map[string]interface{} // the fields written, or nil if removed
+	n       int                    // number of fields
+}
+
+func newHashLayer(base hashStorage) *hashLayer {
+	return &hashLayer{base: base, keys: make(map[string]*hashDelta)}
+}
+
+// touch starts the changes to the hash stored at key, which is read as empty
+// if clear is set.
+func (l *hashLayer) touch(key string, clear bool) *hashDelta {
+	d, ok := l.keys[key]
+	if ok {
+		return d
+	}
+	d = &hashDelta{cleared: clear, fields: make(map[string]interface{})}
+	if !clear {
+		d.n = l.base.HLen(key)
+	}
+	l.keys[key] = d
+	return d
+}
+
+func (l *hashLayer) Keys() (keys []string) {
+	for key, d := range l.keys {
+		if d.n > 0 {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+func (l *hashLayer) HSet(key string, field string, value interface{}) (res int) {
+	if l.HGet(key, field) == nil {
+		res = 1
+	}
+	d := l.touch(key, false)
+	d.fields[field] = value
+	d.n += res
+	return
+}
+
+func (l *hashLayer) HGet(key, field string) interface{} {
+	d, ok := l.keys[key]
+	if !ok {
+		return l.base.HGet(key, field)
+	}
+	if val, ok := d.fields[field]; ok || d.cleared {
+		return val
+	}
+	return l.base.HGet(key, field)
+}
+
+func (l *hashLayer) HDel(key, field string) int {
+	if l.HGet(key, field) == nil {
+		return 0
+	}
+	d := l.touch(key, false)
+	d.fields[field] = nil
+	d.n--
+	return 1
+}
+
+func (l *hashLayer) HExists(key, field string) bool {
+	return l.HGet(key, field) != nil
+}
+
+func (l *hashLayer) HLen(key string) int {
+	if d, ok := l.keys[key]; ok {
+		return d.n
+	}
+	return l.base.HLen(key)
+}
+
+func (l *hashLayer) HKeys(key string) []string {
+	d, ok := l.keys[key]
+	if !ok {
+		return l.base.HKeys(key)
+	}
+
+	fields := make([]string, 0, d.n)
+	if !d.cleared {
+		for _, field := range l.base.HKeys(key) {
+			if _, ok := d.fields[field]; !ok {
+				fields = append(fields, field)
+			}
+		}
+	}
+	for field, val := range d.fields {
+		if val != nil {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func (l *hashLayer) HClear(key string) {
+	d := l.touch(key, false)
+	d.cleared = true
+	d.fields = make(map[string]interface{})
+	d.n = 0
+}
+
+// scan scans the fields of the database still in the hash stored at key,
+// then returns the fields added by the transaction with the last ones.
+func (l *hashLayer) scan(key string, cursor, count int) ([]string, int) {
+	d, ok := l.keys[key]
+	if !ok {
+		return l.base.scan(key, cursor, count)
+	}
+
+	var fields []string
+	next := 0
+	if !d.cleared {
+		var page []string
+		page, next = l.base.scan(key, cursor, count)
+		for _, field := range page {
+			if val, ok := d.fields[field]; !ok || val != nil {
+				fields = append(fields, field)
+			}
+		}
+	}
+	if next == 0 {
+		for field, val := range d.fields {
+			if val != nil && (d.cleared || l.base.HGet(key, field) == nil) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields, next
+}
+
+// fieldExpLayer is the index of the TTLs of hash fields of an overlay. Like
+// hashLayer, it holds the deadlines set and removed for each hash touched.
+type fieldExpLayer struct {
+	base   fieldExpiry
+	groups map[string]*hashDelta // deadlines by hash key, nil if removed
+}
+
+func newFieldExpLayer(base fieldExpiry) *fieldExpLayer {
+	return &fieldExpLayer{base: base, groups: make(map[string]*hashDelta)}
+}
+
+// touch starts the changes to the TTLs of the fields of the hash stored at
+// key, which has none if clear is set.
+func (l *fieldExpLayer) touch(key string, clear bool) *hashDelta {
+	d, ok := l.groups[key]
+	if ok {
+		return d
+	}
+	d = &hashDelta{cleared: clear, fields: make(map[string]interface{})}
+	if !clear {
+		d.n = l.base.HLen(key)
+	}
+	l.groups[key] = d
+	return d
+}
+
+func (l *fieldExpLayer) HSet(group, key string, deadline int64) {
+	d := l.touch(group, false)
+	if l.HGet(group, key) == nil {
+		d.n++
+	}
+	d.fields[key] = deadline
+}
+
+func (l *fieldExpLayer) HGet(group, key string) interface{} {
+	d, ok := l.groups[group]
+	if !ok {
+		return l.base.HGet(group, key)
+	}
+	if deadline, ok := d.fields[key]; ok || d.cleared {
+		return deadline
+	}
+	return l.base.HGet(group, key)
+}
+
+func (l *fieldExpLayer) HDel(group, key string) {
+	if l.HGet(group, key) == nil {
+		return
+	}
+	d := l.touch(group, false)
+	d.fields[key] = nil
+	d.n--
+}
+
+func (l *fieldExpLayer) HClear(group string) {
+	d := l.touch(group, false)
+	d.cleared = true
+	d.fields = make(map[string]interface{})
+	d.n = 0
+}
+
+func (l *fieldExpLayer) HKeys(group string) []string {
+	d, ok := l.groups[group]
+	if !ok {
+		return l.base.HKeys(group)
+	}
+
+	keys := make([]string, 0, d.n)
+	if !d.cleared {
+		for _, key := range l.base.HKeys(group) {
+			if _, ok := d.fields[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	for key, deadline := range d.fields {
+		if deadline != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (l *fieldExpLayer) HLen(group string) int {
+	if d, ok := l.groups[group]; ok {
+		return d.n
+	}
+	return l.base.HLen(group)
+}
+
+// expiredAll returns nothing: the sweeper only samples the database.
+func (l *fieldExpLayer) expiredAll(end time.Time) []expiryEntry {
+	return nil
+}
+
+// setLayer is the set store of an overlay.
+type setLayer struct {
+	base setStorage
+	keys map[string]*setDelta
+}
+
+// setDelta holds the changes to a set.
+type setDelta struct {
+	cleared bool                 // the members in the database are removed
+	members map[interface{}]bool // the members added, or false if removed
+	n       int                  // number of members
+}
+
+func newSetLayer(base setStorage) *setLayer {
+	return &setLayer{base: base, keys: make(map[string]*setDelta)}
+}
+
+// touch starts the changes to the set stored at key, which is read as empty
+// if clear is set.
+func (l *setLayer) touch(key string, clear bool) *setDelta {
+	d, ok := l.keys[key]
+	if ok {
+		return d
+	}
+	d = &setDelta{cleared: clear, members: make(map[interface{}]bool)}
+	if !clear {
+		d.n = l.base.SCard(key)
+	}
+	l.keys[key] = d
+	return d
+}
+
+func (l *setLayer) Keys() (keys []string) {
+	for key, d := range l.keys {
+		if d.n > 0 {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+func (l *setLayer) SAdd(key string, member interface{}) int {
+	added := !l.SIsMember(key, member)
+	d := l.touch(key, false)
+	if added {
+		d.members[member] = true
+		d.n++
+	}
+	return d.n
+}
+
+func (l *setLayer) SIsMember(key string, member interface{}) bool {
+	d, ok := l.keys[key]
+	if !ok {
+		return l.base.SIsMember(key, member)
+	}
+	if added, ok := d.members[member]; ok || d.cleared {
+		return added
+	}
+	return l.base.SIsMember(key, member)
+}
+
+func (l *setLayer) SRandMember(key string, count int) []interface{} {
+	if _, ok := l.keys[key]; !ok {
+		return l.base.SRandMember(key, count)
+	}
+
+	s := set.New()
+	for _, member := range l.SMembers(key) {
+		s.SAdd(key, member)
+	}
+	return s.SRandMember(key, count)
+}
+
+func (l *setLayer) SRem(key string, member interface{}) bool {
+	if !l.SIsMember(key, member) {
+		return false
+	}
+	d := l.touch(key, false)
+	d.members[member] = false
+	d.n--
+	return true
+}
+
+func (l *setLayer) SMove(src, dst string, member interface{}) bool {
+	if !l.SRem(src, member) {
+		return false
+	}
+	l.SAdd(dst, member)
+	return true
+}
+
+func (l *setLayer) SCard(key string) int {
+	if d, ok := l.keys[key]; ok {
+		return d.n
+	}
+	return l.base.SCard(key)
+}
+
+func (l *setLayer) SMembers(key string) []interface{} {
+	d, ok := l.keys[key]
+	if !ok {
+		return l.base.SMembers(key)
+	}
+
+	members := make([]interface{}, 0, d.n)
+	if !d.cleared {
+		for _, member := range l.base.SMembers(key) {
+			if _, ok := d.members[member]; !ok {
+				members = append(members, member)
+			}
+		}
+	}
+	for member, added := range d.members {
+		if added {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+func (l *setLayer) SKeyExists(key string) bool {
+	if d, ok := l.keys[key]; ok {
+		return d.n > 0
+	}
+	return l.base.SKeyExists(key)
+}
+
+func (l *setLayer) SClear(key string) {
+	d := l.touch(key, false)
+	d.cleared = true
+	d.members = make(map[interface{}]bool)
+	d.n = 0
+}
+
+// scan scans the members of the database still in the set stored at key,
+// then returns the members added by the transaction with the last ones.
+func (l *setLayer) scan(key string, cursor, count int) ([]string, int) {
+	d, ok := l.keys[key]
+	if !ok {
+		return l.base.scan(key, cursor, count)
+	}
+
+	var members []string
+	next := 0
+	if !d.cleared {
+		var page []string
+		page, next = l.base.scan(key, cursor, count)
+		for _, member := range page {
+			if added, ok := d.members[member]; !ok || added {
+				members = append(members, member)
+			}
+		}
+	}
+	if next == 0 {
+		for member, added := range d.members {
+			if added && (d.cleared || !l.base.SIsMember(key, member)) {
+				members = append(members, member.(string))
+			}
+		}
+	}
+	return members, next
+}
+
+// zsetLayer is the sorted set store of an overlay. The members of a sorted
+// set are changed one by one until it is read by rank or by score: it is then
+// merged into a sorted set of its own, to which the later changes go.
+type zsetLayer struct {
+	base zsetStorage
+	keys map[string]*zsetDelta
+}
+
+// zsetDelta holds the changes to a sorted set.
+type zsetDelta struct {
+	cleared bool                   // the members in the database are removed
+	scores  map[string]interface{} // the float64 scores set, or nil if removed
+	n       int                    // number of members
+
+	merged *zsetStore // the sorted set once merged, holding every change
+}
+
+func newZSetLayer(base zsetStorage) *zsetLayer {
+	return &zsetLayer{base: base, keys: make(map[string]*zsetDelta)}
+}
+
+// touch starts the changes to the sorted set stored at key, which is read as
+// empty if clear is set.
+func (l *zsetLayer) touch(key string, clear bool) *zsetDelta {
+	d, ok := l.keys[key]
+	if ok {
+		return d
+	}
+	d = &zsetDelta{cleared: clear, scores: make(map[string]interface{})}
+	if !clear {
+		d.n = l.base.ZCard(key)
+	}
+	l.keys[key] = d
+	return d
+}
+
+// sorted returns the store to read the sorted set at key by rank or by score
+// from, merging the changes to it first.
+func (l *zsetLayer) sorted(key string) zsetStorage {
+	d, ok := l.keys[key]
+	if !ok {
+		return l.base
+	}
+	if d.merged != nil {
+		return d.merged
+	}
+
+	z := newZSetStore()
+	if !d.cleared {
+		vals := l.base.ZRangeWithScores(key, 0, -1)
+		for i := 0; i+1 < len(vals); i += 2 {
+			if _, ok := d.scores[vals[i].(string)]; !ok {
+				z.ZAdd(key, vals[i+1].(float64), vals[i].(string), nil)
+			}
+		}
+	}
+	for member, score := range d.scores {
+		if score != nil {
+			z.ZAdd(key, score.(float64), member, nil)
+		}
+	}
+	d.merged, d.scores = z, nil
+	return z
+}
+
+func (l *zsetLayer) Keys() (keys []string) {
+	for key := range l.keys {
+		if l.ZCard(key) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+func (l *zsetLayer) ZAdd(key string, score float64, member string, value interface{}) int {
+	d := l.touch(key, false)
+	if d.merged != nil {
+		return d.merged.ZAdd(key, score, member, value)
+	}
+
+	res := 0
+	if ok, _ := l.ZScore(key, member); !ok {
+		res = 1
+	}
+	d.scores[member] = score
+	d.n += res
+	return res
+}
+
+func (l *zsetLayer) ZScore(key string, member string) (bool, float64) {
+	d, ok := l.keys[key]
+	switch {
+	case !ok:
+		return l.base.ZScore(key, member)
+	case d.merged != nil:
+		return d.merged.ZScore(key, member)
+	}
+	if score, ok := d.scores[member]; ok || d.cleared {
+		if score == nil {
+			return false, 0
+		}
+		return true, score.(float64)
+	}
+	return l.base.ZScore(key, member)
+}
+
+func (l *zsetLayer) ZCard(key string) int {
+	d, ok := l.keys[key]
+	switch {
+	case !ok:
+		return l.base.ZCard(key)
+	case d.merged != nil:
+		return d.merged.ZCard(key)
+	}
+	return d.n
+}
+
+func (l *zsetLayer) ZRem(key, member string) bool {
+	d := l.touch(key, false)
+	if d.merged != nil {
+		return d.merged.ZRem(key, member)
+	}
+
+	if ok, _ := l.ZScore(key, member); !ok {
+		return false
+	}
+	d.scores[member] = nil
+	d.n--
+	return true
+}
+
+func (l *zsetLayer) ZKeyExists(key string) bool {
+	if _, ok := l.keys[key]; ok {
+		return l.ZCard(key) > 0
+	}
+	return l.base.ZKeyExists(key)
+}
+
+func (l *zsetLayer) ZClear(key string) {
+	d := l.touch(key, false)
+	d.cleared = true
+	d.scores = make(map[string]interface{})
+	d.n = 0
+	d.merged = nil
+}
+
+// scan scans the members of the database still in the sorted set stored at
+// key, then returns the members added by the transaction with the last ones.
+// A merged sorted set is returned in a single call.
+func (l *zsetLayer) scan(key string, cursor, count int) ([]string, int) {
+	d, ok := l.keys[key]
+	switch {
+	case !ok:
+		return l.base.scan(key, cursor, count)
+	case d.merged != nil:
+		var members []string
+		for _, member := range d.merged.ZRange(key, 0, -1) {
+			members = append(members, member.(string))
+		}
+		return members, 0
+	}
+
+	var members []string
+	next := 0
+	if !d.cleared {
+		var page []string
+		page, next = l.base.scan(key, cursor, count)
+		for _, member := range page {
+			if score, ok := d.scores[member]; !ok || score != nil {
+				members = append(members, member)
+			}
+		}
+	}
+	if next == 0 {
+		for member, score := range d.scores {
+			if ok, _ := l.base.ZScore(key, member); score != nil && (d.cleared || !ok) {
+				members = append(members, member)
+			}
+		}
+	}
+	return members, next
+}
+
+func (l *zsetLayer) ZRank(key, member string) int64 {
+	return l.sorted(key).ZRank(key, member)
+}
+
+func (l *zsetLayer) ZRevRank(key, member string) int64 {
+	return l.sorted(key).ZRevRank(key, member)
+}
+
+func (l *zsetLayer) ZScoreRange(key string, min, max float64) []interface{} {
+	return l.sorted(key).ZScoreRange(key, min, max)
+}
+
+func (l *zsetLayer) ZRevScoreRange(key string, max, min float64) []interface{} {
+	return l.sorted(key).ZRevScoreRange(key, max, min)
+}
+
+func (l *zsetLayer) ZRange(key string, start, stop int) []interface{} {
+	return l.sorted(key).ZRange(key, start, stop)
+}
+
+func (l *zsetLayer) ZRangeWithScores(key string, start, stop int) []interface{} {
+	return l.sorted(key).ZRangeWithScores(key, start, stop)
+}
+
+func (l *zsetLayer) ZRevRange(key string, start, stop int) []interface{} {
+	return l.sorted(key).ZRevRange(key, start, stop)
+}
+
+func (l *zsetLayer) ZRevRangeWithScores(key string, start, stop int) []interface{} {
+	return l.sorted(key).ZRevRangeWithScores(key, start, stop)
+}
+
+func (l *zsetLayer) ZGetByRank(key string, rank int) []interface{} {
+	return l.sorted(key).ZGetByRank(key, rank)
+}
+
+func (l *zsetLayer) ZRevGetByRank(key string, rank int) []interface{} {
+	return l.sorted(key).ZRevGetByRank(key, rank)
+}
+
+// listLayer is the list store of an overlay. Elements pushed and popped at
+// either end of a list are changes of their own; the other writes merge the
+// list into a list of their own first, as they go through it anyway.
+type listLayer struct {
+	base listStorage
+	keys map[string]*listDelta
+}
+
+// listDelta holds the changes to a list: the elements of the list in the
+// database still in it, between from and to, and those pushed at its ends.
+type listDelta struct {
+	head []string // pushed to the head, the first element last
+	from int
+	to   int
+	tail []string // pushed to the tail
+
+	merged *lists // the list once merged, holding every change
+}
+
+func newListLayer(base listStorage) *listLayer {
+	return &listLayer{base: base, keys: make(map[string]*listDelta)}
+}
+
+// touch starts the changes to the list stored at key, which is read as empty
+// if clear is set.
+func (l *listLayer) touch(key string, clear bool) *listDelta {
+	d, ok := l.keys[key]
+	if ok {
+		return d
+	}
+	d = &listDelta{}
+	if !clear {
+		d.to = l.base.LLen(key)
+	}
+	l.keys[key] = d
+	return d
+}
+
+// merge returns the list stored at key once merged.
+func (l *listLayer) merge(key string) *lists {
+	d := l.touch(key, false)
+	if d.merged != nil {
+		return d.merged
+	}
+
+	merged := newLists()
+	if vals := l.LRange(key, 0, -1); len(vals) > 0 {
+		merged.RPush(key, vals...)
+	}
+	*d = listDelta{merged: merged}
+	return merged
+}
+
+// at returns the element at index, which must be within the list.
+func (l *listLayer) at(key string, d *listDelta, index int) string {
+	if index < len(d.head) {
+		return d.head[len(d.head)-1-index]
+	}
+	index -= len(d.head)
+	if index < d.to-d.from {
+		val, _ := l.base.LIndex(key, d.from+index)
+		return val
+	}
+	return d.tail[index-d.to+d.from]
+}
+
+// dropFront removes the first n elements of the list.
+func (d *listDelta) dropFront(n int) {
+	m := min(n, len(d.head))
+	d.head = d.head[:len(d.head)-m]
+	n -= m
+	m = min(n, d.to-d.from)
+	d.from += m
+	d.tail = d.tail[n-m:]
+}
+
+// dropBack removes the last n elements of the list.
+func (d *listDelta) dropBack(n int) {
+	m := min(n, len(d.tail))
+	d.tail = d.tail[:len(d.tail)-m]
+	n -= m
+	m = min(n, d.to-d.from)
+	d.to -= m
+	d.head = d.head[n-m:]
+}
+
+func (l *listLayer) Keys() (keys []string) {
+	for key := range l.keys {
+		if l.LLen(key) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+func (l *listLayer) LPush(key string, values ...string) int {
+	d := l.touch(key, false)
+	if d.merged != nil {
+		return d.merged.LPush(key, values...)
+	}
+	d.head = append(d.head, values...)
+	return l.LLen(key)
+}
+
+func (l *listLayer) RPush(key string, values ...string) int {
+	d := l.touch(key, false)
+	if d.merged != nil {
+		return d.merged.RPush(key, values...)
+	}
+	d.tail = append(d.tail, values...)
+	return l.LLen(key)
+}
+
+func (l *listLayer) LPop(key string) (string, bool) {
+	d := l.touch(key, false)
+	if d.merged != nil {
+		return d.merged.LPop(key)
+	}
+	if l.LLen(key) == 0 {
+		return "", false
+	}
+	val := l.at(key, d, 0)
+	d.dropFront(1)
+	return val, true
+}
+
+func (l *listLayer) RPop(key string) (string, bool) {
+	d := l.touch(key, false)
+	if d.merged != nil {
+		return d.merged.RPop(key)
+	}
+	n := l.LLen(key)
+	if n == 0 {
+		return "", false
+	}
+	val := l.at(key, d, n-1)
+	d.dropBack(1)
+	return val, true
+}
+
+func (l *listLayer) LIndex(key string, index int) (string, bool) {
+	d, ok := l.keys[key]
+	switch {
+	case !ok:
+		return l.base.LIndex(key, index)
+	case d.merged != nil:
+		return d.merged.LIndex(key, index)
+	}
+
+	n := l.LLen(key)
+	if index < 0 {
+		index += n
+	}
+	if index < 0 || index >= n {
+		return "", false
+	}
+	return l.at(key, d, index), true
+}
+
+func (l *listLayer) LSet(key string, index int, value string) bool {
+	return l.merge(key).LSet(key, index, value)
+}
+
+func (l *listLayer) LRange(key string, start, stop int) []string {
+	d, ok := l.keys[key]
+	switch {
+	case !ok:
+		return l.base.LRange(key, start, stop)
+	case d.merged != nil:
+		return d.merged.LRange(key, start, stop)
+	}
+
+	start, stop, ok = listRange(l.LLen(key), start, stop)
+	if !ok {
+		return nil
+	}
+	vals := make([]string, 0, stop-start+1)
+	i := start
+	for ; i <= stop && i < len(d.head); i++ {
+		vals = append(vals, d.head[len(d.head)-1-i])
+	}
+	if n := d.to - d.from; i <= stop && i-len(d.head) < n {
+		last := min(stop-len(d.head), n-1)
+		vals = append(vals, l.base.LRange(key, d.from+i-len(d.head), d.from+last)...)
+		i = len(d.head) + last + 1
+	}
+	for ; i <= stop; i++ {
+		vals = append(vals, d.tail[i-len(d.head)-d.to+d.from])
+	}
+	return vals
+}
+
+func (l *listLayer) LRem(key string, count int, value string) int {
+	return l.merge(key).LRem(key, count, value)
+}
+
+func (l *listLayer) LTrim(key string, start, stop int) {
+	d := l.touch(key, false)
+	if d.merged != nil {
+		d.merged.LTrim(key, start, stop)
+		return
+	}
+
+	n := l.LLen(key)
+	start, stop, ok := listRange(n, start, stop)
+	if !ok {
+		l.LClear(key)
+		return
+	}
+	d.dropFront(start)
+	d.dropBack(n - 1 - stop)
+}
+
+func (l *listLayer) LInsert(key string, pos InsertPosition, pivot, value string) int {
+	return l.merge(key).LInsert(key, pos, pivot, value)
+}
+
+func (l *listLayer) LLen(key string) int {
+	d, ok := l.keys[key]
+	switch {
+	case !ok:
+		return l.base.LLen(key)
+	case d.merged != nil:
+		return d.merged.LLen(key)
+	}
+	return len(d.head) + d.to - d.from + len(d.tail)
+}
+
+func (l *listLayer) LKeyExists(key string) bool {
+	if _, ok := l.keys[key]; ok {
+		return l.LLen(key) > 0
+	}
+	return l.base.LKeyExists(key)
+}
+
+func (l *listLayer) LClear(key string) {
+	*l.touch(key, false) = listDelta{}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,88 @@
+package flashdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrKeyTooLarge    = errors.New("key too large")
+	ErrMemberTooLarge = errors.New("member too large")
+	ErrValueTooLarge  = errors.New("value too large")
+)
+
+// SizeLimitError is returned when a key, member or value is larger than the
+// limit set in the Config. It matches one of ErrKeyTooLarge,
+// ErrMemberTooLarge or ErrValueTooLarge with errors.Is.
+type SizeLimitError struct {
+	Err   error  // which limit was exceeded
+	Size  uint32 // size of the input in bytes
+	Limit uint32 // configured limit in bytes
+}
+
+func (e *SizeLimitError) Error() string {
+	return fmt.Sprintf("%v: %d bytes, limit is %d", e.Err, e.Size, e.Limit)
+}
+
+func (e *SizeLimitError) Unwrap() error {
+	return e.Err
+}
+
+// checkSize checks size against limit, where a limit of 0 means no limit.
+func checkSize(err error, size, limit uint32) error {
+	if limit > 0 && size > limit {
+		return &SizeLimitError{Err: err, Size: size, Limit: limit}
+	}
+	return nil
+}
+
+// checkRange checks that a value written at offset, n bytes long, ends within
+// MaxValueSize. It does not overflow for any offset.
+func (c *Config) checkRange(offset, n int) error {
+	if c.MaxValueSize == 0 || int64(offset) <= int64(c.MaxValueSize)-int64(n) {
+		return nil
+	}
+	size := uint64(offset) + uint64(n)
+	if size > math.MaxUint32 {
+		size = math.MaxUint32
+	}
+	return &SizeLimitError{Err: ErrValueTooLarge, Size: uint32(size), Limit: c.MaxValueSize}
+}
+
+// checkRecord checks the key, member and value of a record against the size
+// limits in the config. What the member and value hold depends on the data
+// type, e.g. the member of a String record is its value.
+func (db *FlashDB) checkRecord(r *record) error {
+	c := db.config
+	m := r.meta
+	if err := checkSize(ErrKeyTooLarge, m.keySize, c.MaxKeySize); err != nil {
+		return err
+	}
+
+	switch r.getType() {
+	case StringRecord:
+		return checkSize(ErrValueTooLarge, m.memberSize, c.MaxValueSize)
+	case HashRecord:
+		if err := checkSize(ErrMemberTooLarge, m.memberSize, c.MaxMemberSize); err != nil {
+			return err
+		}
+		return checkSize(ErrValueTooLarge, m.valueSize, c.MaxValueSize)
+	case SetRecord:
+		if err := checkSize(ErrMemberTooLarge, m.memberSize, c.MaxMemberSize); err != nil {
+			return err
+		}
+		// the value of an SMove record is the destination key
+		return checkSize(ErrKeyTooLarge, m.valueSize, c.MaxKeySize)
+	case ZSetRecord:
+		return checkSize(ErrMemberTooLarge, m.memberSize, c.MaxMemberSize)
+	case ListRecord:
+		// the member is the element, and the value either the pivot of an
+		// insert or an index
+		if err := checkSize(ErrValueTooLarge, m.memberSize, c.MaxValueSize); err != nil {
+			return err
+		}
+		return checkSize(ErrValueTooLarge, m.valueSize, c.MaxValueSize)
+	}
+	return nil
+}
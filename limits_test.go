@@ -0,0 +1,96 @@
+package flashdb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/arriqaaq/aol"
+	"github.com/stretchr/testify/assert"
+)
+
+func limitsConfig() *Config {
+	c := testConfig()
+	c.MaxKeySize = 8
+	c.MaxMemberSize = 8
+	c.MaxValueSize = 16
+	return c
+}
+
+func TestFlashDB_SizeLimits(t *testing.T) {
+	db, err := New(limitsConfig())
+	assert.NoError(t, err)
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	longKey := strings.Repeat("k", 9)
+	longMember := strings.Repeat("m", 9)
+	longValue := strings.Repeat("v", 17)
+
+	err = db.Update(func(tx *Tx) error {
+		assert.True(t, errors.Is(tx.Set(longKey, "v"), ErrKeyTooLarge))
+		assert.True(t, errors.Is(tx.Set("k", longValue), ErrValueTooLarge))
+
+		_, err := tx.HSet("k", longMember, "v")
+		assert.True(t, errors.Is(err, ErrMemberTooLarge))
+		_, err = tx.HSet("k", "f", longValue)
+		assert.True(t, errors.Is(err, ErrValueTooLarge))
+
+		assert.True(t, errors.Is(tx.SAdd("k", "ok", longMember), ErrMemberTooLarge))
+		assert.True(t, errors.Is(tx.ZAdd("k", 1, longMember), ErrMemberTooLarge))
+		assert.True(t, errors.Is(tx.SMove("k", longKey, "ok"), ErrKeyTooLarge))
+
+		var serr *SizeLimitError
+		assert.True(t, errors.As(tx.Set("k", longValue), &serr))
+		assert.Equal(t, uint32(17), serr.Size)
+		assert.Equal(t, uint32(16), serr.Limit)
+
+		// nothing is queued when a record is over the limits
+		assert.Len(t, tx.wc.commitItems, 0)
+		return tx.Set("k", "v")
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_SizeLimitsOnLoad(t *testing.T) {
+	defer os.RemoveAll(tmpDir)
+
+	// a record written before the limit was lowered
+	l, err := aol.Open(tmpDir, nil)
+	assert.NoError(t, err)
+	data, _ := newRecord([]byte("key"), []byte(strings.Repeat("v", 32)), StringRecord, StringSet).encode()
+	assert.NoError(t, l.Write(data))
+	l.Close()
+
+	_, err = New(limitsConfig())
+	assert.True(t, errors.Is(err, ErrValueTooLarge))
+}
+
+func TestFlashDB_SizeLimitsUpgrade(t *testing.T) {
+	defer os.RemoveAll(tmpDir)
+
+	// a log written before there were limits, with a value over the default
+	l, err := aol.Open(tmpDir, nil)
+	assert.NoError(t, err)
+	val := strings.Repeat("v", int(DefaultMaxValueSize)+1)
+	data, _ := newRecord([]byte("key"), []byte(val), StringRecord, StringSet).encode()
+	assert.NoError(t, l.Write(data))
+	l.Close()
+
+	config := DefaultConfig()
+	config.Path = tmpDir
+	_, err = New(config)
+	assert.True(t, errors.Is(err, ErrValueTooLarge))
+	assert.Contains(t, err.Error(), "set them to 0 to open it")
+
+	// unset limits do not limit anything
+	db, err := New(&Config{Path: tmpDir, NoSync: true})
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, db.View(func(tx *Tx) error {
+		got, err := tx.Get("key")
+		assert.Equal(t, val, got)
+		return err
+	}))
+}
@@ -0,0 +1,273 @@
+package flashdb
+
+import (
+	"container/list"
+)
+
+// lists holds the List values of the database by key. Each value is a doubly
+// linked list of strings, and a key is removed when its list becomes empty.
+type lists struct {
+	record map[string]*list.List
+}
+
+func newLists() *lists {
+	return &lists{record: make(map[string]*list.List)}
+}
+
+// LPush inserts the values at the head of the list stored at key, one after
+// the other, and returns the length of the list.
+func (l *lists) LPush(key string, values ...string) int {
+	lst := l.getOrCreate(key)
+	for _, v := range values {
+		lst.PushFront(v)
+	}
+	return lst.Len()
+}
+
+// RPush inserts the values at the tail of the list stored at key, and returns
+// the length of the list.
+func (l *lists) RPush(key string, values ...string) int {
+	lst := l.getOrCreate(key)
+	for _, v := range values {
+		lst.PushBack(v)
+	}
+	return lst.Len()
+}
+
+// LPop removes and returns the first element of the list stored at key.
+func (l *lists) LPop(key string) (string, bool) {
+	lst := l.record[key]
+	if lst == nil {
+		return "", false
+	}
+	return l.remove(key, lst.Front()), true
+}
+
+// RPop removes and returns the last element of the list stored at key.
+func (l *lists) RPop(key string) (string, bool) {
+	lst := l.record[key]
+	if lst == nil {
+		return "", false
+	}
+	return l.remove(key, lst.Back()), true
+}
+
+// LIndex returns the element at index in the list stored at key. Negative
+// indexes count from the tail, -1 being the last element.
+func (l *lists) LIndex(key string, index int) (string, bool) {
+	e := l.element(key, index)
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+// LSet sets the element at index in the list stored at key to value. It
+// returns false if the index is out of range.
+func (l *lists) LSet(key string, index int, value string) bool {
+	e := l.element(key, index)
+	if e == nil {
+		return false
+	}
+	e.Value = value
+	return true
+}
+
+// LRange returns the elements between start and stop, both inclusive, of the
+// list stored at key. Negative offsets count from the tail.
+func (l *lists) LRange(key string, start, stop int) []string {
+	lst := l.record[key]
+	if lst == nil {
+		return nil
+	}
+	start, stop, ok := listRange(lst.Len(), start, stop)
+	if !ok {
+		return nil
+	}
+
+	vals := make([]string, 0, stop-start+1)
+	i := 0
+	for e := lst.Front(); e != nil && i <= stop; e = e.Next() {
+		if i >= start {
+			vals = append(vals, e.Value.(string))
+		}
+		i++
+	}
+	return vals
+}
+
+// LRem removes the first count occurrences of value from the list stored at
+// key, searching from the tail if count is negative, or every occurrence if
+// count is zero. It returns the number of removed elements.
+func (l *lists) LRem(key string, count int, value string) int {
+	lst := l.record[key]
+	if lst == nil {
+		return 0
+	}
+
+	var n int
+	max := absUint(count)
+	if count >= 0 {
+		for e := lst.Front(); e != nil && (count == 0 || uint(n) < max); {
+			next := e.Next()
+			if e.Value.(string) == value {
+				l.remove(key, e)
+				n++
+			}
+			e = next
+		}
+	} else {
+		for e := lst.Back(); e != nil && uint(n) < max; {
+			prev := e.Prev()
+			if e.Value.(string) == value {
+				l.remove(key, e)
+				n++
+			}
+			e = prev
+		}
+	}
+	return n
+}
+
+// LTrim trims the list stored at key to the elements between start and stop,
+// both inclusive.
+func (l *lists) LTrim(key string, start, stop int) {
+	lst := l.record[key]
+	if lst == nil {
+		return
+	}
+	start, stop, ok := listRange(lst.Len(), start, stop)
+	if !ok {
+		delete(l.record, key)
+		return
+	}
+
+	i := 0
+	for e := lst.Front(); e != nil; i++ {
+		next := e.Next()
+		if i < start || i > stop {
+			lst.Remove(e)
+		}
+		e = next
+	}
+}
+
+// LInsert inserts value before or after the first occurrence of pivot in the
+// list stored at key. It returns the length of the list, -1 if pivot was not
+// found, or 0 if the key does not exist.
+func (l *lists) LInsert(key string, pos InsertPosition, pivot, value string) int {
+	lst := l.record[key]
+	if lst == nil {
+		return 0
+	}
+	for e := lst.Front(); e != nil; e = e.Next() {
+		if e.Value.(string) != pivot {
+			continue
+		}
+		if pos == Before {
+			lst.InsertBefore(value, e)
+		} else {
+			lst.InsertAfter(value, e)
+		}
+		return lst.Len()
+	}
+	return -1
+}
+
+// LLen returns the length of the list stored at key.
+func (l *lists) LLen(key string) int {
+	lst := l.record[key]
+	if lst == nil {
+		return 0
+	}
+	return lst.Len()
+}
+
+// LKeyExists returns if the key exists.
+func (l *lists) LKeyExists(key string) bool {
+	_, ok := l.record[key]
+	return ok
+}
+
+// LClear removes the list stored at key.
+func (l *lists) LClear(key string) {
+	delete(l.record, key)
+}
+
+// Keys returns the keys of all lists.
+func (l *lists) Keys() []string {
+	keys := make([]string, 0, len(l.record))
+	for k := range l.record {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (l *lists) getOrCreate(key string) *list.List {
+	lst := l.record[key]
+	if lst == nil {
+		lst = list.New()
+		l.record[key] = lst
+	}
+	return lst
+}
+
+// remove removes e from the list stored at key, and the key if the list is
+// left empty.
+func (l *lists) remove(key string, e *list.Element) string {
+	lst := l.record[key]
+	val := lst.Remove(e).(string)
+	if lst.Len() == 0 {
+		delete(l.record, key)
+	}
+	return val
+}
+
+// element returns the element at index in the list stored at key, or nil if
+// the index is out of range.
+func (l *lists) element(key string, index int) *list.Element {
+	lst := l.record[key]
+	if lst == nil {
+		return nil
+	}
+	if index < 0 {
+		index += lst.Len()
+	}
+	if index < 0 || index >= lst.Len() {
+		return nil
+	}
+
+	if index < lst.Len()/2 {
+		e := lst.Front()
+		for ; index > 0; index-- {
+			e = e.Next()
+		}
+		return e
+	}
+	e := lst.Back()
+	for i := lst.Len() - 1; i > index; i-- {
+		e = e.Prev()
+	}
+	return e
+}
+
+// listRange converts start and stop offsets, which may be negative, to
+// indexes within a list of length n. It returns false if the range is empty.
+func listRange(n, start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
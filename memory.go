@@ -0,0 +1,362 @@
+package flashdb
+
+import (
+	"math/rand"
+	"sync"
+)
+
+const (
+	// keyOverhead and elemOverhead approximate the memory used by the
+	// bookkeeping of a key, and of a field or member of a key, besides their
+	// content.
+	keyOverhead  = 64
+	elemOverhead = 32
+	scoreSize    = 8 // the float64 score of a member of a sorted set
+
+	// evictionSamples is the number of keys sampled to pick the key to evict,
+	// as maxmemory-samples in Redis.
+	evictionSamples = 5
+
+	// lfuInitVal is the access counter of a new key, so that it is not evicted
+	// before it gets a chance to be accessed. lfuLogFactor sets how slowly
+	// the counter grows, and the counter is decremented once for every
+	// lfuDecayTime milliseconds without access.
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+	lfuDecayTime = 60 * 1000
+)
+
+// memory estimates the memory used by each key of the database, and tracks
+// the accesses to the keys by which the eviction policies rank them.
+//
+// The estimate counts the bytes of the keys, fields, members and values, plus
+// a fixed overhead for each of them. It is meant to bound the size of the
+// database, not to match the memory used by the process.
+type memory struct {
+	mu      sync.Mutex
+	used    int64
+	entries map[DataType]map[string]*memEntry
+	keys    map[DataType]*keySet // keys of each data type, to sample and scan them
+}
+
+// memEntry is the memory used by a key and its accesses.
+type memEntry struct {
+	size   int64 // including keyOverhead and the key
+	access int64 // Unix time of the last access, in milliseconds
+	freq   uint8 // logarithmic access counter, as in Redis
+}
+
+func newMemory() *memory {
+	return &memory{
+		entries: make(map[DataType]map[string]*memEntry),
+		keys:    make(map[DataType]*keySet),
+	}
+}
+
+// Used returns the estimated memory used by the keys, in bytes.
+func (m *memory) Used() int64 {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
+
+// add adds delta bytes to the memory used by key.
+func (m *memory) add(dType DataType, key string, delta int64) {
+	if m == nil || delta == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.entry(dType, key)
+	e.size += delta
+	m.used += delta
+}
+
+// set sets the memory used by the value of key to size bytes.
+func (m *memory) set(dType DataType, key string, size int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.entry(dType, key)
+	size += keyOverhead + int64(len(key))
+	m.used += size - e.size
+	e.size = size
+}
+
+// entry returns the entry of key, creating it if needed. The caller must hold
+// m.mu.
+func (m *memory) entry(dType DataType, key string) *memEntry {
+	if e, ok := m.entries[dType][key]; ok {
+		return e
+	}
+
+	if m.entries[dType] == nil {
+		m.entries[dType] = make(map[string]*memEntry)
+		m.keys[dType] = newKeySet()
+	}
+	e := &memEntry{
+		size:   keyOverhead + int64(len(key)),
+		access: nowMs(),
+		freq:   lfuInitVal,
+	}
+	m.entries[dType][key] = e
+	m.keys[dType].add(key)
+	m.used += e.size
+	return e
+}
+
+// seed sets the memory used by key to size bytes, as in the database written
+// to by a transaction, without counting it in the memory used: the memory of
+// an overlay counts the memory added by the transaction.
+func (m *memory) seed(dType DataType, key string, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.entry(dType, key)
+	m.used -= e.size
+	e.size = size
+}
+
+// remove forgets key once it has been deleted.
+func (m *memory) remove(dType DataType, key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[dType][key]
+	if !ok {
+		return
+	}
+	m.used -= e.size
+	delete(m.entries[dType], key)
+	m.keys[dType].remove(key)
+}
+
+// size returns the memory used by key, in bytes.
+func (m *memory) size(dType DataType, key string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[dType][key]; ok {
+		return e.size
+	}
+	return 0
+}
+
+// has reports whether the memory used by key is counted, that is whether the
+// key is stored, including if it has expired.
+func (m *memory) has(dType DataType, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.entries[dType][key]
+	return ok
+}
+
+// scan returns up to count keys of the data type from cursor, as
+// keySet.scan does.
+func (m *memory) scan(dType DataType, cursor, count int) ([]string, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := m.keys[dType]
+	if keys == nil {
+		return nil, 0
+	}
+	return keys.scan(cursor, count)
+}
+
+// access records an access to key.
+func (m *memory) access(dType DataType, key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[dType][key]
+	if !ok {
+		return
+	}
+	now := nowMs()
+	e.freq = e.decayedFreq(now)
+	if e.freq < 255 {
+		base := float64(e.freq) - lfuInitVal
+		if base < 0 {
+			base = 0
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			e.freq++
+		}
+	}
+	e.access = now
+}
+
+// decayedFreq returns the access counter of the entry, decremented for the
+// time elapsed since the last access.
+func (e *memEntry) decayedFreq(now int64) uint8 {
+	periods := (now - e.access) / lfuDecayTime
+	if periods >= int64(e.freq) {
+		return 0
+	}
+	return e.freq - uint8(periods)
+}
+
+// get returns a copy of the entry of key.
+func (m *memory) get(dType DataType, key string) (memEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[dType][key]
+	if !ok {
+		return memEntry{}, false
+	}
+	return *e, true
+}
+
+// random returns a key picked at random among the keys of every data type.
+func (m *memory) random() (DataType, string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := 0
+	for _, keys := range m.keys {
+		total += keys.len()
+	}
+	if total == 0 {
+		return "", "", false
+	}
+
+	i := rand.Intn(total)
+	for dType, keys := range m.keys {
+		if i < keys.len() {
+			return dType, keys.keys[i], true
+		}
+		i -= keys.len()
+	}
+	return "", "", false
+}
+
+// elemSize returns the memory used by a field or member, and its value.
+func elemSize(member, value string) int64 {
+	return elemOverhead + int64(len(member)+len(value))
+}
+
+// hashFieldSize returns the memory used by the field of the hash stored at
+// key, or 0 if there is no such field.
+func (db *FlashDB) hashFieldSize(key, field string) int64 {
+	val := db.hashStore.HGet(key, field)
+	if val == nil {
+		return 0
+	}
+	return elemSize(field, val.(string))
+}
+
+// evictionVictim returns the key to evict under the eviction policy, picked
+// among a sample of the keys as in Redis. Keys for which skip returns true are
+// not picked. It returns false if no key could be picked.
+func (db *FlashDB) evictionVictim(policy EvictionPolicy, skip func(DataType, string) bool) (DataType, string, bool) {
+	var (
+		best      overlayKey
+		bestScore int64
+		found     bool
+	)
+	seen := make(map[overlayKey]bool)
+	now := nowMs()
+	for i, n := 0, 0; i < evictionSamples*4 && n < evictionSamples; i++ {
+		var (
+			dType DataType
+			key   string
+			ok    bool
+		)
+		switch policy {
+		case VolatileLRU, VolatileTTL:
+			var e expiryEntry
+			e, ok = db.exps.randomEntry()
+			dType, key = e.group, e.key
+		default:
+			dType, key, ok = db.mem.random()
+		}
+		if !ok {
+			break
+		}
+		if seen[overlayKey{dType, key}] || skip(dType, key) {
+			continue
+		}
+		seen[overlayKey{dType, key}] = true
+		entry, ok := db.mem.get(dType, key)
+		if !ok {
+			continue
+		}
+		n++
+
+		// the key with the lowest score is evicted
+		var score int64
+		switch policy {
+		case AllKeysLRU, VolatileLRU:
+			score = entry.access
+		case AllKeysLFU:
+			score = int64(entry.decayedFreq(now))<<48 | entry.access&(1<<48-1)
+		case VolatileTTL:
+			if deadline := db.getTTL(dType, key); deadline != nil {
+				score = deadline.(int64)
+			}
+		}
+		if !found || score < bestScore {
+			best, bestScore, found = overlayKey{dType, key}, score, true
+		}
+		if policy == RandomEviction {
+			break
+		}
+	}
+	return best.dType, best.key, found
+}
+
+// freeMemory evicts keys by Config.EvictionPolicy until the memory used, with
+// the keys written by the transaction, is within Config.MaxMemory. The
+// removals are committed along with the transaction, and the keys written by
+// the transaction are not evicted. A transaction that does not add to the
+// memory used always commits; otherwise, under NoEviction or if no key can be
+// evicted, it fails with ErrOutOfMemory.
+func (tx *Tx) freeMemory() error {
+	db := tx.db
+	max := int64(db.config.MaxMemory)
+	if max <= 0 || tx.wc.overlay == nil {
+		return nil
+	}
+
+	// the memory added by the transaction, counted as its records were applied
+	// to the overlay
+	added := tx.wc.overlay.db.mem.Used()
+	if added <= 0 {
+		return nil
+	}
+
+	evicted := make(map[overlayKey]bool)
+	skip := func(dType DataType, key string) bool {
+		k := overlayKey{dType, key}
+		return evicted[k] || tx.wc.overlay.touched[k]
+	}
+	for used := db.mem.Used() + added; used > max; {
+		if db.config.EvictionPolicy == NoEviction {
+			return ErrOutOfMemory
+		}
+		dType, key, ok := db.evictionVictim(db.config.EvictionPolicy, skip)
+		if !ok {
+			return ErrOutOfMemory
+		}
+		evicted[overlayKey{dType, key}] = true
+		used -= db.mem.size(dType, key)
+		tx.wc.commitItems = append(tx.wc.commitItems, evictRecord(dType, key, removedEvicted))
+	}
+	return nil
+}
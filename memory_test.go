@@ -0,0 +1,266 @@
+package flashdb
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlashDB_MemoryAccounting(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("s", "value"))
+		_, err := tx.HSet("h", "f", "v")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.SAdd("set", "m"))
+		assert.NoError(t, tx.ZAdd("z", 1, "m"))
+		_, err = tx.RPush("l", "a", "b")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, keyOverhead+int64(len("s")+len("value")), db.mem.size(String, "s"))
+	assert.Equal(t, keyOverhead+int64(len("h"))+elemSize("f", "v"), db.mem.size(Hash, "h"))
+	assert.Equal(t, keyOverhead+int64(len("z"))+elemSize("m", "")+scoreSize, db.mem.size(ZSet, "z"))
+	assert.Equal(t, keyOverhead+int64(len("l"))+2*elemSize("a", ""), db.mem.size(List, "l"))
+	assert.True(t, db.UsedMemory() > 0)
+
+	// the accounting follows the updates of the keys
+	err = db.Update(func(tx *Tx) error {
+		_, err := tx.Append("s", "s")
+		assert.NoError(t, err)
+		_, err = tx.HSet("h", "f", "longer")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.SMove("set", "set2", "m"))
+		_, err = tx.LInsert("l", Before, "b", "c")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.LTrim("l", 1, -1))
+		return nil
+	})
+	assert.NoError(t, err)
+	for _, k := range []overlayKey{{String, "s"}, {Hash, "h"}, {Set, "set"}, {Set, "set2"}, {List, "l"}} {
+		assert.Equal(t, db.keySize(k.dType, k.key), db.mem.size(k.dType, k.key), k.key)
+	}
+
+	// the memory is released as the keys are emptied
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Delete("s"))
+		_, err := tx.HDel("h", "f")
+		assert.NoError(t, err)
+		_, err = tx.SRem("set2", "m")
+		assert.NoError(t, err)
+		_, err = tx.ZRem("z", "m")
+		assert.NoError(t, err)
+		_, err = tx.LPop("l")
+		assert.NoError(t, err)
+		_, err = tx.LPop("l")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), db.UsedMemory())
+}
+
+func TestFlashDB_MemoryAddedByTx(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.RPush("l", "a", "b", "a", "c", "d")
+		assert.NoError(t, err)
+		_, err = tx.HSet("h", "f", "v")
+		return err
+	})
+	assert.NoError(t, err)
+	used := db.UsedMemory()
+
+	keys := []overlayKey{{List, "l"}, {Hash, "h"}, {String, "s"}}
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.LSet("l", 1, "longer"))
+		_, err := tx.LRem("l", 0, "a")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.LTrim("l", 0, 1))
+		_, err = tx.HSet("h", "f", "value")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Set("s", "val"))
+
+		// the memory added is counted as the records are applied
+		var added int64
+		for _, k := range keys {
+			added += tx.wc.overlay.db.keySize(k.dType, k.key) - db.mem.size(k.dType, k.key)
+		}
+		assert.Equal(t, added, tx.wc.overlay.db.mem.Used())
+		return nil
+	})
+	assert.NoError(t, err)
+	for _, k := range keys {
+		assert.Equal(t, db.keySize(k.dType, k.key), db.mem.size(k.dType, k.key), k.key)
+	}
+	assert.NotEqual(t, used, db.UsedMemory())
+}
+
+func TestFlashDB_SweepIsNotAccess(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.HSet("h", "a", "1")
+		assert.NoError(t, err)
+		_, err = tx.HSet("h", "b", "1")
+		assert.NoError(t, err)
+		_, err = tx.HPExpireFields("h", 10, "a")
+		return err
+	})
+	assert.NoError(t, err)
+	before, ok := db.mem.get(Hash, "h")
+	assert.True(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	n, err := db.EvictExpired()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	after, _ := db.mem.get(Hash, "h")
+	assert.Equal(t, before.access, after.access, "the sweep is not an access")
+
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"b"}, tx.HKeys("h"))
+		return nil
+	})
+	assert.NoError(t, err)
+	after, _ = db.mem.get(Hash, "h")
+	assert.Greater(t, after.access, before.access)
+}
+
+func TestFlashDB_MaxMemoryNoEviction(t *testing.T) {
+	config := testConfig()
+	config.MaxMemory = 100
+	db, err := New(config)
+	assert.NoError(t, err)
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err = db.Update(func(tx *Tx) error {
+		return tx.Set("a", "a value over the limit along with its overhead")
+	})
+	assert.Equal(t, ErrOutOfMemory, err)
+	err = db.Update(func(tx *Tx) error {
+		return tx.Set("a", "value")
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		return tx.Set("b", "1")
+	})
+	assert.Equal(t, ErrOutOfMemory, err)
+
+	// removals are still allowed
+	err = db.Update(func(tx *Tx) error {
+		return tx.Delete("a")
+	})
+	assert.NoError(t, err)
+	err = db.Update(func(tx *Tx) error {
+		return tx.Set("b", "1")
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_MaxMemoryEviction(t *testing.T) {
+	set := func(db *FlashDB, key string) {
+		err := db.Update(func(tx *Tx) error {
+			return tx.Set(key, "value")
+		})
+		assert.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		policy  EvictionPolicy
+		evicted string
+	}{
+		{AllKeysLRU, "old"},
+		{VolatileLRU, "old"},
+		{VolatileTTL, "new"},
+		{AllKeysLFU, "old"},
+	} {
+		config := testConfig()
+		config.MaxMemory = 2 * (keyOverhead + 10)
+		config.EvictionPolicy = tc.policy
+		db, err := New(config)
+		assert.NoError(t, err)
+
+		set(db, "old")
+		set(db, "new")
+		err = db.Update(func(tx *Tx) error {
+			assert.NoError(t, tx.Expire("old", 100))
+			return tx.Expire("new", 10)
+		})
+		assert.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+		for i := 0; i < 10; i++ {
+			err = db.View(func(tx *Tx) error {
+				_, err := tx.Get("new")
+				return err
+			})
+			assert.NoError(t, err)
+		}
+
+		// the eviction is committed along with the write
+		sub := db.Subscribe(EventFilter{})
+		set(db, "third")
+		sub.Close()
+		var evicted []string
+		for e := range sub.C {
+			if e.Evicted {
+				evicted = append(evicted, e.Key)
+			}
+		}
+		assert.Equal(t, []string{tc.evicted}, evicted, tc.policy)
+		assert.Nil(t, db.strStore.Search([]byte(tc.evicted)), tc.policy)
+		assert.NotNil(t, db.strStore.Search([]byte("third")), tc.policy)
+		assert.True(t, db.UsedMemory() <= int64(config.MaxMemory), tc.policy)
+
+		assert.NoError(t, db.Close())
+		db, err = New(config)
+		assert.NoError(t, err)
+		assert.Nil(t, db.strStore.Search([]byte(tc.evicted)), tc.policy)
+		assert.NoError(t, db.Close())
+		os.RemoveAll(tmpDir)
+	}
+}
+
+// keySize computes the memory used by key from its content, to check the
+// accounting done as records are applied to the stores.
+func (db *FlashDB) keySize(dType DataType, key string) (size int64) {
+	switch dType {
+	case String:
+		val, err := db.strStore.get(key)
+		if err != nil {
+			return 0
+		}
+		return keyOverhead + int64(len(key)+len(val.(string)))
+	case Hash:
+		for _, field := range db.hashStore.HKeys(key) {
+			size += db.hashFieldSize(key, field)
+		}
+	case Set:
+		for _, member := range db.setStore.SMembers(key) {
+			size += elemSize(member.(string), "")
+		}
+	case ZSet:
+		for _, member := range db.zsetStore.ZRange(key, 0, -1) {
+			size += elemSize(member.(string), "") + scoreSize
+		}
+	case List:
+		for _, val := range db.listStore.LRange(key, 0, -1) {
+			size += elemSize(val, "")
+		}
+	}
+	if size == 0 {
+		return 0
+	}
+	return size + keyOverhead + int64(len(key))
+}
@@ -7,13 +7,18 @@ const (
 	Hash   DataType = "Hash"
 	Set    DataType = "Set"
 	ZSet   DataType = "ZSet"
+	List   DataType = "List"
 )
 
+// dataTypes lists the data types, in the order keys are reported by Type.
+var dataTypes = []DataType{String, Hash, Set, ZSet, List}
+
 const (
 	StringRecord uint16 = iota
 	HashRecord
 	SetRecord
 	ZSetRecord
+	ListRecord
 )
 
 // The operations on Strings.
@@ -21,6 +26,13 @@ const (
 	StringSet uint16 = iota
 	StringRem
 	StringExpire
+	StringIncrBy
+	StringIncrByFloat
+	StringSetClearTTL
+	StringAppend
+	StringSetRange
+	StringPersist
+	StringSetEx
 )
 
 // The operations on Hash.
@@ -29,6 +41,9 @@ const (
 	HashHDel
 	HashHClear
 	HashHExpire
+	HashHPersist
+	HashHFieldExpire
+	HashHFieldPersist
 )
 
 // The operations on Set.
@@ -38,6 +53,7 @@ const (
 	SetSMove
 	SetSClear
 	SetSExpire
+	SetSPersist
 )
 
 // The operations on Sorted Set.
@@ -46,4 +62,21 @@ const (
 	ZSetZRem
 	ZSetZClear
 	ZSetZExpire
+	ZSetZPersist
+)
+
+// The operations on List.
+const (
+	ListLPush uint16 = iota
+	ListRPush
+	ListLPop
+	ListRPop
+	ListLSet
+	ListLRem
+	ListLTrim
+	ListLInsertBefore
+	ListLInsertAfter
+	ListLClear
+	ListLExpire
+	ListLPersist
 )
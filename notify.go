@@ -0,0 +1,166 @@
+package flashdb
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Event is a change to a key of the database, sent to the subscribers once the
+// transaction making it has committed.
+type Event struct {
+	Type      DataType
+	Key       string
+	Member    string // the field or member changed, if any
+	Mark      uint16 // the operation, such as StringSet or HashHDel
+	Timestamp int64  // Unix time of the commit, in milliseconds
+
+	Expired bool // the key or field was removed because its TTL passed
+	Evicted bool // the key was evicted to stay within Config.MaxMemory
+}
+
+// EventFilter selects the events sent to a subscription.
+type EventFilter struct {
+	Types   []DataType // data types of the keys, any type if empty
+	Pattern string     // glob-style pattern of the keys, as in KEYS, any key if empty
+}
+
+func (f *EventFilter) match(e *Event) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			if t == e.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.Pattern == "" || globMatch(f.Pattern, e.Key)
+}
+
+// Subscription receives the events matching its filter on C, in the order of
+// the commits. Its buffer holds Config.EventBuffer events; when it is full,
+// further events are dropped, or the commits wait for the subscriber if
+// Config.BlockSlowSubscribers is set. In that case the subscriber must not use
+// the database while receiving, as the commit holds the database lock.
+//
+// C is closed when the subscription or the database is closed.
+type Subscription struct {
+	C <-chan Event
+
+	c       chan Event
+	db      *FlashDB
+	filter  EventFilter
+	dropped uint64 // accessed atomically
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close stops the subscription and closes C.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		// unblock a commit waiting on the subscriber before removing it
+		close(s.done)
+		s.db.subs.remove(s)
+		close(s.c)
+	})
+}
+
+// subscribers holds the subscriptions to the events of the database.
+type subscribers struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]bool
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{subs: make(map[*Subscription]bool)}
+}
+
+func (s *subscribers) remove(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, sub)
+}
+
+// Subscribe returns a subscription to the changes of the keys matching the
+// filter. Expired and evicted keys are reported as the records removing them.
+// The subscription must be closed when done.
+func (db *FlashDB) Subscribe(filter EventFilter) *Subscription {
+	c := make(chan Event, db.config.EventBuffer)
+	sub := &Subscription{
+		C:      c,
+		c:      c,
+		db:     db,
+		filter: filter,
+		done:   make(chan struct{}),
+	}
+
+	db.subs.mu.Lock()
+	db.subs.subs[sub] = true
+	db.subs.mu.Unlock()
+	return sub
+}
+
+// notify sends the events of the committed records to the subscribers.
+func (db *FlashDB) notify(recs []*record) {
+	db.subs.mu.RLock()
+	defer db.subs.mu.RUnlock()
+	if len(db.subs.subs) == 0 {
+		return
+	}
+
+	now := nowMs()
+	for _, r := range recs {
+		e := Event{
+			Type:      recordDataType(r.getType()),
+			Key:       string(r.meta.key),
+			Member:    string(r.meta.member),
+			Mark:      r.getMark(),
+			Timestamp: now,
+			Expired:   r.cause == removedExpired,
+			Evicted:   r.cause == removedEvicted,
+		}
+		for sub := range db.subs.subs {
+			if sub.filter.match(&e) {
+				db.send(sub, e)
+			}
+		}
+	}
+}
+
+func (db *FlashDB) send(sub *Subscription, e Event) {
+	if db.config.BlockSlowSubscribers {
+		select {
+		case sub.c <- e:
+		case <-sub.done:
+		}
+		return
+	}
+
+	select {
+	case sub.c <- e:
+	default:
+		atomic.AddUint64(&sub.dropped, 1)
+	}
+}
+
+// closeSubscriptions closes the subscriptions when the database is closed.
+func (db *FlashDB) closeSubscriptions() {
+	db.subs.mu.RLock()
+	subs := make([]*Subscription, 0, len(db.subs.subs))
+	for sub := range db.subs.subs {
+		subs = append(subs, sub)
+	}
+	db.subs.mu.RUnlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
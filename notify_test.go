@@ -0,0 +1,145 @@
+package flashdb
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receive returns the next event of the subscription, or fails the test if
+// there is none.
+func receive(t *testing.T, sub *Subscription) Event {
+	select {
+	case e := <-sub.C:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return Event{}
+}
+
+func TestFlashDB_Subscribe(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	all := db.Subscribe(EventFilter{})
+	defer all.Close()
+	users := db.Subscribe(EventFilter{Types: []DataType{Hash}, Pattern: "user:*"})
+	defer users.Close()
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("a", "1"))
+		_, err := tx.HSet("user:1", "name", "x")
+		assert.NoError(t, err)
+		_, err = tx.HSet("other", "name", "x")
+		return err
+	})
+	assert.NoError(t, err)
+
+	e := receive(t, all)
+	assert.Equal(t, String, e.Type)
+	assert.Equal(t, "a", e.Key)
+	assert.Equal(t, StringSetClearTTL, e.Mark)
+	assert.True(t, e.Timestamp > 0)
+	assert.Equal(t, "user:1", receive(t, all).Key)
+	assert.Equal(t, "other", receive(t, all).Key)
+
+	e = receive(t, users)
+	assert.Equal(t, Hash, e.Type)
+	assert.Equal(t, "user:1", e.Key)
+	assert.Equal(t, "name", e.Member)
+	assert.Equal(t, HashHSet, e.Mark)
+	assert.Len(t, users.C, 0)
+
+	// a rolled back transaction sends nothing
+	_ = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("b", "1"))
+		return ErrInvalidKey
+	})
+	assert.Len(t, all.C, 0)
+
+	// closing the subscription, or the database, closes the channel
+	all.Close()
+	_, ok := <-all.C
+	assert.False(t, ok)
+	assert.NoError(t, db.Close())
+	_, ok = <-users.C
+	assert.False(t, ok)
+}
+
+func TestFlashDB_SubscribeExpired(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("a", "1"))
+		return tx.PExpire("a", 10)
+	})
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	sub := db.Subscribe(EventFilter{})
+	defer sub.Close()
+	_, err = db.EvictExpired()
+	assert.NoError(t, err)
+
+	e := receive(t, sub)
+	assert.Equal(t, "a", e.Key)
+	assert.Equal(t, StringRem, e.Mark)
+	assert.True(t, e.Expired)
+	assert.False(t, e.Evicted)
+}
+
+func TestFlashDB_SubscribeSlowConsumer(t *testing.T) {
+	config := testConfig()
+	config.EventBuffer = 2
+	db, err := New(config)
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// the events over the buffer are dropped
+	sub := db.Subscribe(EventFilter{})
+	for i := 0; i < 3; i++ {
+		err = db.Update(func(tx *Tx) error {
+			return tx.Set("a", "1")
+		})
+		assert.NoError(t, err)
+	}
+	assert.Len(t, sub.C, 2)
+	assert.Equal(t, uint64(1), sub.Dropped())
+	sub.Close()
+	assert.NoError(t, db.Close())
+
+	// or the commits wait for the subscriber
+	config.BlockSlowSubscribers = true
+	db, err = New(config)
+	assert.NoError(t, err)
+	defer db.Close()
+	sub = db.Subscribe(EventFilter{})
+	defer sub.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			err := db.Update(func(tx *Tx) error {
+				return tx.Set("a", "1")
+			})
+			assert.NoError(t, err)
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatal("commit did not wait for the subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for i := 0; i < 3; i++ {
+		receive(t, sub)
+	}
+	<-done
+	assert.Equal(t, uint64(0), sub.Dropped())
+}
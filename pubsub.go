@@ -0,0 +1,333 @@
+package flashdb
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Message is a message published to a channel, as received by a PubSub.
+type Message struct {
+	Channel string
+	Pattern string // the pattern matching the channel, for a pattern subscription
+	Payload string
+}
+
+// PubSub receives the messages published to its channels, and to the channels
+// matching its glob-style patterns, on C. Like a Subscription, it buffers
+// Config.EventBuffer messages, and drops the messages over the buffer unless
+// Config.BlockSlowSubscribers is set, in which case Publish waits.
+//
+// Messages are not written to the log: they are only received by the
+// subscribers at the time they are published. C is closed when the PubSub or
+// the database is closed.
+type PubSub struct {
+	C <-chan Message
+
+	c        chan Message
+	hub      *pubSubHub
+	mu       sync.Mutex // guards channels and patterns
+	channels map[string]bool
+	patterns map[string]bool
+	dropped  uint64 // accessed atomically
+	done     chan struct{}
+	once     sync.Once
+
+	sendMu sync.RWMutex // held by the senders to c, and by Close to close it
+	closed bool
+}
+
+// pubSubHub holds the subscribers of each channel and pattern.
+type pubSubHub struct {
+	mu       sync.RWMutex
+	block    bool
+	buffer   int
+	channels map[string]map[*PubSub]bool
+	patterns map[string]map[*PubSub]bool
+	all      map[*PubSub]bool
+}
+
+func newPubSubHub(config *Config) *pubSubHub {
+	return &pubSubHub{
+		block:    config.BlockSlowSubscribers,
+		buffer:   config.EventBuffer,
+		channels: make(map[string]map[*PubSub]bool),
+		patterns: make(map[string]map[*PubSub]bool),
+		all:      make(map[*PubSub]bool),
+	}
+}
+
+// NewPubSub returns a PubSub that is not subscribed to any channel yet. It
+// must be closed when done.
+func (db *FlashDB) NewPubSub() *PubSub {
+	h := db.pubsub
+	c := make(chan Message, h.buffer)
+	ps := &PubSub{
+		C:        c,
+		c:        c,
+		hub:      h,
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+		done:     make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	h.all[ps] = true
+	h.mu.Unlock()
+	return ps
+}
+
+// SubscribeChannels returns a PubSub subscribed to the channels. It is named
+// apart from Subscribe, which subscribes to the changes of the keys.
+func (db *FlashDB) SubscribeChannels(channels ...string) *PubSub {
+	ps := db.NewPubSub()
+	ps.Subscribe(channels...)
+	return ps
+}
+
+// PSubscribe returns a PubSub subscribed to the channels matching the
+// patterns.
+func (db *FlashDB) PSubscribe(patterns ...string) *PubSub {
+	ps := db.NewPubSub()
+	ps.PSubscribe(patterns...)
+	return ps
+}
+
+// Publish sends the message to the subscribers of channel, and returns the
+// number of subscriptions it was sent to. A PubSub subscribed to the channel
+// and to patterns matching it receives the message once for each of them.
+//
+// The subscribers are picked under the lock of the hub, and the message is
+// sent to them once it is released, so that a Publish waiting on a slow
+// subscriber does not hold up the subscriptions.
+func (db *FlashDB) Publish(channel, message string) int {
+	h := db.pubsub
+	type delivery struct {
+		ps *PubSub
+		m  Message
+	}
+	var deliveries []delivery
+
+	h.mu.RLock()
+	for ps := range h.channels[channel] {
+		deliveries = append(deliveries, delivery{ps, Message{Channel: channel, Payload: message}})
+	}
+	for pattern, subs := range h.patterns {
+		if !globMatch(pattern, channel) {
+			continue
+		}
+		for ps := range subs {
+			deliveries = append(deliveries, delivery{ps, Message{Channel: channel, Pattern: pattern, Payload: message}})
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, d := range deliveries {
+		h.send(d.ps, d.m)
+	}
+	return len(deliveries)
+}
+
+// send sends the message to the PubSub, unless it has been closed since it
+// was picked.
+func (h *pubSubHub) send(ps *PubSub, m Message) {
+	ps.sendMu.RLock()
+	defer ps.sendMu.RUnlock()
+	if ps.closed {
+		return
+	}
+
+	if h.block {
+		select {
+		case ps.c <- m:
+		case <-ps.done:
+		}
+		return
+	}
+
+	select {
+	case ps.c <- m:
+	default:
+		atomic.AddUint64(&ps.dropped, 1)
+	}
+}
+
+// PubSubChannels returns the channels with at least one subscriber, matching
+// pattern if it is not empty, in sorted order. Pattern subscriptions are not
+// counted.
+func (db *FlashDB) PubSubChannels(pattern string) []string {
+	h := db.pubsub
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	channels := make([]string, 0, len(h.channels))
+	for channel := range h.channels {
+		if pattern == "" || globMatch(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// PubSubNumSub returns the number of subscribers of each channel, not counting
+// pattern subscriptions.
+func (db *FlashDB) PubSubNumSub(channels ...string) []int {
+	h := db.pubsub
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	res := make([]int, 0, len(channels))
+	for _, channel := range channels {
+		res = append(res, len(h.channels[channel]))
+	}
+	return res
+}
+
+// PubSubNumPat returns the number of distinct patterns subscribed to.
+func (db *FlashDB) PubSubNumPat() int {
+	h := db.pubsub
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.patterns)
+}
+
+// Subscribe subscribes to the channels.
+func (ps *PubSub) Subscribe(channels ...string) {
+	ps.subscribe(false, channels)
+}
+
+// PSubscribe subscribes to the channels matching the glob-style patterns.
+func (ps *PubSub) PSubscribe(patterns ...string) {
+	ps.subscribe(true, patterns)
+}
+
+// Unsubscribe unsubscribes from the channels, or from every channel if none
+// is given.
+func (ps *PubSub) Unsubscribe(channels ...string) {
+	ps.unsubscribe(false, channels)
+}
+
+// PUnsubscribe unsubscribes from the patterns, or from every pattern if none
+// is given.
+func (ps *PubSub) PUnsubscribe(patterns ...string) {
+	ps.unsubscribe(true, patterns)
+}
+
+// Channels returns the channels subscribed to, in sorted order.
+func (ps *PubSub) Channels() []string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return sortedKeys(ps.channels)
+}
+
+// Patterns returns the patterns subscribed to, in sorted order.
+func (ps *PubSub) Patterns() []string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return sortedKeys(ps.patterns)
+}
+
+// Count returns the number of channels and patterns subscribed to.
+func (ps *PubSub) Count() int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.channels) + len(ps.patterns)
+}
+
+// Dropped returns the number of messages dropped because the buffer was full.
+func (ps *PubSub) Dropped() uint64 {
+	return atomic.LoadUint64(&ps.dropped)
+}
+
+// Close unsubscribes from every channel and pattern, and closes C.
+func (ps *PubSub) Close() {
+	ps.once.Do(func() {
+		// unblock a Publish waiting on the subscriber before removing it
+		close(ps.done)
+		ps.unsubscribe(false, nil)
+		ps.unsubscribe(true, nil)
+
+		ps.hub.mu.Lock()
+		delete(ps.hub.all, ps)
+		ps.hub.mu.Unlock()
+
+		ps.sendMu.Lock()
+		ps.closed = true
+		close(ps.c)
+		ps.sendMu.Unlock()
+	})
+}
+
+func (ps *PubSub) subscribe(pattern bool, names []string) {
+	h := ps.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if !h.all[ps] {
+		// closed
+		return
+	}
+	subs, own := h.channels, ps.channels
+	if pattern {
+		subs, own = h.patterns, ps.patterns
+	}
+	for _, name := range names {
+		if subs[name] == nil {
+			subs[name] = make(map[*PubSub]bool)
+		}
+		subs[name][ps] = true
+		own[name] = true
+	}
+}
+
+func (ps *PubSub) unsubscribe(pattern bool, names []string) {
+	h := ps.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	subs, own := h.channels, ps.channels
+	if pattern {
+		subs, own = h.patterns, ps.patterns
+	}
+	if len(names) == 0 {
+		names = make([]string, 0, len(own))
+		for name := range own {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		delete(own, name)
+		delete(subs[name], ps)
+		if len(subs[name]) == 0 {
+			delete(subs, name)
+		}
+	}
+}
+
+// closeAll closes the PubSubs when the database is closed.
+func (h *pubSubHub) closeAll() {
+	h.mu.RLock()
+	all := make([]*PubSub, 0, len(h.all))
+	for ps := range h.all {
+		all = append(all, ps)
+	}
+	h.mu.RUnlock()
+
+	for _, ps := range all {
+		ps.Close()
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
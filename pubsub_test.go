@@ -0,0 +1,120 @@
+package flashdb
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveMessage(t *testing.T, ps *PubSub) Message {
+	select {
+	case m := <-ps.C:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+	return Message{}
+}
+
+func TestFlashDB_PubSub(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	news := db.SubscribeChannels("news", "sports")
+	defer news.Close()
+	all := db.PSubscribe("n*")
+	defer all.Close()
+
+	assert.Equal(t, 2, db.Publish("news", "hello"))
+	assert.Equal(t, Message{Channel: "news", Payload: "hello"}, receiveMessage(t, news))
+	assert.Equal(t, Message{Channel: "news", Pattern: "n*", Payload: "hello"}, receiveMessage(t, all))
+
+	assert.Equal(t, 1, db.Publish("sports", "goal"))
+	assert.Equal(t, "goal", receiveMessage(t, news).Payload)
+	assert.Equal(t, 0, db.Publish("weather", "rain"))
+	assert.Len(t, all.C, 0)
+
+	assert.Equal(t, []string{"news", "sports"}, db.PubSubChannels(""))
+	assert.Equal(t, []string{"sports"}, db.PubSubChannels("s*"))
+	assert.Equal(t, []int{1, 0}, db.PubSubNumSub("news", "weather"))
+	assert.Equal(t, 1, db.PubSubNumPat())
+
+	news.Unsubscribe("news")
+	assert.Equal(t, []string{"sports"}, news.Channels())
+	assert.Equal(t, 1, db.Publish("news", "hello"))
+	news.Unsubscribe()
+	assert.Equal(t, 0, news.Count())
+	assert.Empty(t, db.PubSubChannels(""))
+
+	all.PSubscribe("w*")
+	assert.Equal(t, []string{"n*", "w*"}, all.Patterns())
+	all.PUnsubscribe()
+	assert.Equal(t, 0, db.PubSubNumPat())
+
+	// closing the database closes the PubSubs
+	assert.NoError(t, db.Close())
+	_, ok := <-news.C
+	assert.False(t, ok)
+}
+
+func TestFlashDB_PubSubSlowConsumer(t *testing.T) {
+	config := testConfig()
+	config.EventBuffer = 1
+	db, err := New(config)
+	assert.NoError(t, err)
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	ps := db.SubscribeChannels("c")
+	defer ps.Close()
+	assert.Equal(t, 1, db.Publish("c", "1"))
+	assert.Equal(t, 1, db.Publish("c", "2"))
+	assert.Equal(t, "1", receiveMessage(t, ps).Payload)
+	assert.Equal(t, uint64(1), ps.Dropped())
+
+	ps.Close()
+	ps.Subscribe("c")
+	assert.Equal(t, 0, db.Publish("c", "3"), "a closed PubSub does not subscribe")
+}
+
+func TestFlashDB_PubSubBlockedPublish(t *testing.T) {
+	config := testConfig()
+	config.EventBuffer = 1
+	config.BlockSlowSubscribers = true
+	db, err := New(config)
+	assert.NoError(t, err)
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	ps := db.SubscribeChannels("c")
+	defer ps.Close()
+	assert.Equal(t, 1, db.Publish("c", "1"))
+
+	published := make(chan int)
+	go func() {
+		published <- db.Publish("c", "2")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// subscribing does not wait for the Publish blocked on the full buffer,
+	// as the server does while holding the lock its pushes need
+	subscribed := make(chan struct{})
+	go func() {
+		ps.Subscribe("other")
+		db.PSubscribe("c*").Close()
+		close(subscribed)
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe blocked by Publish")
+	}
+
+	assert.Equal(t, "1", receiveMessage(t, ps).Payload)
+	assert.Equal(t, "2", receiveMessage(t, ps).Payload)
+	assert.Equal(t, 1, <-published)
+	assert.Equal(t, uint64(0), ps.Dropped())
+}
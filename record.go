@@ -3,6 +3,7 @@ package flashdb
 import (
 	"encoding/binary"
 	"errors"
+	"hash/crc32"
 	"time"
 )
 
@@ -11,21 +12,36 @@ import (
 */
 
 var (
-	ErrInvalidEntry = errors.New("invalid entry")
+	ErrInvalidEntry    = errors.New("invalid entry")
+	ErrInvalidChecksum = errors.New("invalid checksum")
 )
 
 const (
+	// version 1 byte, crc32 4 bytes.
 	// keySize, memberSize, valueSize is uint32 type，4 bytes each.
 	// timestamp 8 bytes, state 2 bytes.
-	// 4 + 4 + 4 + 8 + 2 = 22
-	entryHeaderSize = 22
+	// 1 + 4 + 4 + 4 + 4 + 8 + 2 = 27
+	entryHeaderSize = 27
+
+	// legacyHeaderSize is the header size of records written before the
+	// record format was versioned. Those records carry no checksum and start
+	// with the big endian key size, so their first byte is always zero.
+	legacyHeaderSize = 22
+
+	legacyVersion = byte(0)
+
+	// secondsVersion records store the deadline of expire records in Unix
+	// seconds. Later versions store it in Unix milliseconds.
+	secondsVersion = byte(1)
+	recordVersion  = byte(2)
 )
 
 type (
 	record struct {
 		meta      *meta
-		state     uint16 // state represents two fields, high 8 bits is the data type, low 8 bits is operation mark.
-		timestamp uint64 // Timestamp is the time when entry was written.
+		state     uint16       // state represents two fields, high 8 bits is the data type, low 8 bits is operation mark.
+		timestamp uint64       // Timestamp is the time when entry was written.
+		cause     removalCause // why the database removed the key, not encoded
 	}
 
 	// Meta meta info.
@@ -39,6 +55,16 @@ type (
 	}
 )
 
+// removalCause is why a record written by the database itself, rather than
+// by a caller, removes a key or field.
+type removalCause uint8
+
+const (
+	removedByCaller removalCause = iota
+	removedExpired               // the TTL of the key or field has passed
+	removedEvicted               // evicted to stay within Config.MaxMemory
+)
+
 func newInternal(key, member, value []byte, state uint16, timestamp uint64) *record {
 	return &record{
 		state: state, timestamp: timestamp,
@@ -69,6 +95,8 @@ func newRecordWithValue(key, member, value []byte, t, mark uint16) *record {
 	return newInternal(key, member, value, state, uint64(time.Now().UnixNano()))
 }
 
+// newRecordWithExpire returns a record whose timestamp is the deadline, in Unix
+// milliseconds.
 func newRecordWithExpire(key, member []byte, deadline int64, t, mark uint16) *record {
 	var state uint16 = 0
 	// set type and mark.
@@ -86,11 +114,13 @@ func (e *record) size() uint32 {
 //
 //  the entry stored format:
 //  |----------------------------------------------------------------------------------------------------------------|
-//  |  ks   | ms      | vs     | state  | timestamp  | key    | member | value  |
+//  | version | crc32  |  ks   | ms      | vs     | state  | timestamp  | key    | member | value  |
 //  |----------------------------------------------------------------------------------------------------------------|
-//  | uint32| uint32  | uint32 | uint16 | uint64     | []byte | []byte | []byte |
+//  | uint8   | uint32 | uint32| uint32  | uint32 | uint16 | uint64     | []byte | []byte | []byte |
 //  |----------------------------------------------------------------------------------------------------------------|
 //
+//  crc32 is computed over the version and every byte after the crc32 field.
+//
 
 func (e *record) encode() ([]byte, error) {
 	if e == nil || e.meta.keySize == 0 {
@@ -101,41 +131,92 @@ func (e *record) encode() ([]byte, error) {
 	vs := e.meta.valueSize
 	buf := make([]byte, e.size())
 
-	binary.BigEndian.PutUint32(buf[0:4], ks)
-	binary.BigEndian.PutUint32(buf[4:8], ms)
-	binary.BigEndian.PutUint32(buf[8:12], vs)
-	binary.BigEndian.PutUint16(buf[12:14], e.state)
-	binary.BigEndian.PutUint64(buf[14:22], e.timestamp)
+	buf[0] = recordVersion
+	binary.BigEndian.PutUint32(buf[5:9], ks)
+	binary.BigEndian.PutUint32(buf[9:13], ms)
+	binary.BigEndian.PutUint32(buf[13:17], vs)
+	binary.BigEndian.PutUint16(buf[17:19], e.state)
+	binary.BigEndian.PutUint64(buf[19:27], e.timestamp)
 	copy(buf[entryHeaderSize:entryHeaderSize+ks], e.meta.key)
 	copy(buf[entryHeaderSize+ks:(entryHeaderSize+ks+ms)], e.meta.member)
 	if vs > 0 {
 		copy(buf[(entryHeaderSize+ks+ms):(entryHeaderSize+ks+ms+vs)], e.meta.value)
 	}
+	binary.BigEndian.PutUint32(buf[1:5], checksum(buf))
 
 	return buf, nil
 }
 
 func decode(buf []byte) (*record, error) {
+	if len(buf) == 0 {
+		return nil, ErrInvalidEntry
+	}
+
+	var r *record
+	var err error
+	switch buf[0] {
+	case recordVersion, secondsVersion:
+		if len(buf) < entryHeaderSize {
+			return nil, ErrInvalidEntry
+		}
+		if binary.BigEndian.Uint32(buf[1:5]) != checksum(buf) {
+			return nil, ErrInvalidChecksum
+		}
+		r, err = decodeBody(buf[5:], entryHeaderSize-5)
+	case legacyVersion:
+		r, err = decodeBody(buf, legacyHeaderSize)
+	default:
+		return nil, ErrInvalidEntry
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if buf[0] != recordVersion && r.isExpire() {
+		r.timestamp *= 1000
+	}
+	return r, nil
+}
+
+// decodeBody decodes the sizes, state and timestamp at the start of buf,
+// followed by the key, member and value.
+func decodeBody(buf []byte, headerSize int) (*record, error) {
+	if len(buf) < headerSize {
+		return nil, ErrInvalidEntry
+	}
+
 	ks := binary.BigEndian.Uint32(buf[0:4])
 	ms := binary.BigEndian.Uint32(buf[4:8])
 	vs := binary.BigEndian.Uint32(buf[8:12])
 	state := binary.BigEndian.Uint16(buf[12:14])
 	timestamp := binary.BigEndian.Uint64(buf[14:22])
 
+	if uint64(len(buf)) != uint64(headerSize)+uint64(ks)+uint64(ms)+uint64(vs) {
+		return nil, ErrInvalidEntry
+	}
+
+	kEnd := uint32(headerSize) + ks
+	mEnd := kEnd + ms
 	return &record{
 		meta: &meta{
 			keySize:    ks,
 			memberSize: ms,
 			valueSize:  vs,
-			key:        buf[entryHeaderSize : entryHeaderSize+ks],
-			member:     buf[entryHeaderSize+ks : (entryHeaderSize + ks + ms)],
-			value:      buf[(entryHeaderSize + ks + ms):(entryHeaderSize + ks + ms + vs)],
+			key:        buf[headerSize:kEnd],
+			member:     buf[kEnd:mEnd],
+			value:      buf[mEnd : mEnd+vs],
 		},
 		state:     state,
 		timestamp: timestamp,
 	}, nil
 }
 
+// checksum returns the crc32 of an encoded record, skipping the crc32 field.
+func checksum(buf []byte) uint32 {
+	crc := crc32.ChecksumIEEE(buf[0:1])
+	return crc32.Update(crc, crc32.IEEETable, buf[5:])
+}
+
 func (e *record) getType() uint16 {
 	return e.state >> 8
 }
@@ -143,3 +224,21 @@ func (e *record) getType() uint16 {
 func (e *record) getMark() uint16 {
 	return e.state & (2<<7 - 1)
 }
+
+// isExpire returns if the timestamp of the record is a TTL deadline rather
+// than the time it was written.
+func (e *record) isExpire() bool {
+	switch e.getType() {
+	case StringRecord:
+		return e.getMark() == StringExpire || e.getMark() == StringSetEx
+	case HashRecord:
+		return e.getMark() == HashHExpire || e.getMark() == HashHFieldExpire
+	case SetRecord:
+		return e.getMark() == SetSExpire
+	case ZSetRecord:
+		return e.getMark() == ZSetZExpire
+	case ListRecord:
+		return e.getMark() == ListLExpire
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package flashdb
 
 import (
+	"encoding/binary"
 	"fmt"
 	"os"
 	"testing"
@@ -60,3 +61,79 @@ func TestFlashDB_AOL(t *testing.T) {
 	assert.Equal(t, "member_100", string(lastRecord.meta.member))
 	assert.Equal(t, "value_100", string(lastRecord.meta.value))
 }
+
+func TestFlashDB_RecordChecksum(t *testing.T) {
+	r := newRecordWithValue([]byte("key"), []byte("member"), []byte("value"), HashRecord, HashHSet)
+	data, err := r.encode()
+	assert.NoError(t, err)
+
+	res, err := decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "key", string(res.meta.key))
+	assert.Equal(t, "member", string(res.meta.member))
+	assert.Equal(t, "value", string(res.meta.value))
+	assert.Equal(t, HashRecord, res.getType())
+	assert.Equal(t, HashHSet, res.getMark())
+
+	// a flipped bit in the payload is caught by the checksum
+	data[len(data)-1] ^= 0x01
+	_, err = decode(data)
+	assert.Equal(t, ErrInvalidChecksum, err)
+
+	// truncated records are rejected instead of panicking
+	for _, n := range []int{0, 1, 10, entryHeaderSize, len(data) - 1} {
+		_, err = decode(data[:n])
+		assert.Error(t, err)
+	}
+
+	_, err = decode([]byte{0xff, 0, 0, 0, 0})
+	assert.Equal(t, ErrInvalidEntry, err)
+}
+
+func TestFlashDB_DecodeLegacyRecord(t *testing.T) {
+	key, member := []byte("key"), []byte("member")
+	buf := make([]byte, legacyHeaderSize+len(key)+len(member))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(key)))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(member)))
+	binary.BigEndian.PutUint16(buf[12:14], StringRecord<<8|StringSet)
+	copy(buf[legacyHeaderSize:], key)
+	copy(buf[legacyHeaderSize+len(key):], member)
+
+	res, err := decode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "key", string(res.meta.key))
+	assert.Equal(t, "member", string(res.meta.member))
+	assert.Equal(t, StringRecord, res.getType())
+	assert.Equal(t, StringSet, res.getMark())
+
+	_, err = decode(buf[:len(buf)-1])
+	assert.Equal(t, ErrInvalidEntry, err)
+}
+
+// encodeSeconds encodes r as a record written before deadlines were stored in
+// milliseconds.
+func encodeSeconds(t *testing.T, r *record) []byte {
+	buf, err := r.encode()
+	assert.NoError(t, err)
+	buf[0] = secondsVersion
+	binary.BigEndian.PutUint32(buf[1:5], checksum(buf))
+	return buf
+}
+
+func TestFlashDB_DecodeSecondsDeadline(t *testing.T) {
+	res, err := decode(encodeSeconds(t, newRecordWithExpire([]byte("key"), nil, 100, HashRecord, HashHExpire)))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100000), res.timestamp)
+
+	r := newRecord([]byte("key"), []byte("member"), HashRecord, HashHSet)
+	res, err = decode(encodeSeconds(t, r))
+	assert.NoError(t, err)
+	assert.Equal(t, r.timestamp, res.timestamp)
+
+	// current records are decoded as is
+	data, err := newRecordWithExpire([]byte("key"), nil, 100, HashRecord, HashHExpire).encode()
+	assert.NoError(t, err)
+	res, err = decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), res.timestamp)
+}
@@ -0,0 +1,115 @@
+package flashdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	ErrCorruptRecord = errors.New("corrupt record")
+)
+
+// CorruptRecordError is returned when loading the append-only log hits a
+// record that cannot be read or decoded.
+type CorruptRecordError struct {
+	Segment uint64 // segment of the log holding the record
+	Index   uint64 // index of the record within the segment
+	Err     error  // underlying error
+}
+
+func (e *CorruptRecordError) Error() string {
+	return fmt.Sprintf("corrupt record at segment %d, index %d: %v", e.Segment, e.Index, e.Err)
+}
+
+func (e *CorruptRecordError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrCorruptRecord) true for a CorruptRecordError.
+func (e *CorruptRecordError) Is(target error) bool {
+	return target == ErrCorruptRecord
+}
+
+func segmentPath(dir string, segment uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d", segment))
+}
+
+// lastSegment returns the index of the tail segment in the log directory.
+func lastSegment(dir string) (last uint64, err error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || len(name) != 20 {
+			continue
+		}
+		index, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || index == 0 {
+			continue
+		}
+		if index > last {
+			last = index
+		}
+	}
+
+	if last == 0 {
+		return 0, os.ErrNotExist
+	}
+	return last, nil
+}
+
+// scanEntries returns the byte offset of every complete entry in the segment
+// data. Each entry is a uvarint size followed by that many bytes. The second
+// return value is the offset right after the last complete entry.
+func scanEntries(data []byte) (offsets []int, end int) {
+	for end < len(data) {
+		size, n := binary.Uvarint(data[end:])
+		if n <= 0 || uint64(len(data)-end-n) < size {
+			break
+		}
+		offsets = append(offsets, end)
+		end += n + int(size)
+	}
+	return
+}
+
+// tornSegment finds the tail segment and the index of the partially written
+// entry at its end.
+func tornSegment(dir string) (segment, index uint64, err error) {
+	segment, err = lastSegment(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	data, err := ioutil.ReadFile(segmentPath(dir, segment))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	offsets, _ := scanEntries(data)
+	return segment, uint64(len(offsets)), nil
+}
+
+// truncateSegment removes the entries from index onwards in the segment.
+func truncateSegment(dir string, segment, index uint64) error {
+	path := segmentPath(dir, segment)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	offsets, end := scanEntries(data)
+	if index < uint64(len(offsets)) {
+		end = offsets[index]
+	}
+
+	return os.Truncate(path, int64(end))
+}
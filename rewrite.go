@@ -0,0 +1,307 @@
+package flashdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/arriqaaq/aol"
+)
+
+var (
+	ErrRewriteInProgress = errors.New("log rewrite already in progress")
+	ErrNotPersistent     = errors.New("database does not persist to disk")
+)
+
+const (
+	rewriteDirSuffix = ".rewrite" // new segments are written here first
+	backupDirSuffix  = ".old"     // old segments are moved here during the swap
+
+	// number of records written to the new log in one batch.
+	rewriteBatchSize = 1024
+)
+
+// rewriteBuffer collects the records appended to the log while a rewrite is
+// in progress, so that they can be carried over to the new segments.
+type rewriteBuffer struct {
+	mu   sync.Mutex
+	recs [][]byte
+}
+
+func (b *rewriteBuffer) append(recs ...[]byte) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.recs = append(b.recs, recs...)
+	b.mu.Unlock()
+}
+
+// Rewrite compacts the append-only log. The live contents of every store,
+// along with their TTLs, are written as a fresh set of segments which then
+// replace the old ones. Any snapshot saved in the database directory is
+// dropped along with the old segments.
+//
+// The database is only locked while the stores are dumped in memory and while
+// the segments are swapped. Writes committed in between are buffered and
+// carried over to the new log before the swap.
+func (db *FlashDB) Rewrite() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrDatabaseClosed
+	}
+	if !db.persist {
+		db.mu.Unlock()
+		return ErrNotPersistent
+	}
+	if db.rewrite != nil {
+		db.mu.Unlock()
+		return ErrRewriteInProgress
+	}
+
+	recs := make([]*record, 0, 1)
+	db.dump(func(r *record) {
+		recs = append(recs, r)
+	})
+	buf := &rewriteBuffer{}
+	db.rewrite = buf
+	db.mu.Unlock()
+
+	tmpPath := db.config.Path + rewriteDirSuffix
+	l, err := db.writeRewriteLog(tmpPath, recs)
+	if err != nil {
+		db.abortRewrite(tmpPath)
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rewrite = nil
+
+	// carry over the records written while the new log was being built.
+	buf.mu.Lock()
+	batch := new(aol.Batch)
+	for _, rec := range buf.recs {
+		batch.Write(rec)
+	}
+	count := uint64(len(recs) + len(buf.recs))
+	buf.mu.Unlock()
+	if err = l.WriteBatch(batch); err == nil && !db.config.NoSync {
+		err = l.Sync()
+	}
+	if err == nil {
+		err = l.Close()
+	}
+	if err != nil {
+		_ = l.Close()
+		_ = os.RemoveAll(tmpPath)
+		return err
+	}
+
+	return db.swapLog(tmpPath, count)
+}
+
+// writeRewriteLog writes the records to a new log at path. The returned log is
+// left open so that buffered records can be appended before the swap.
+func (db *FlashDB) writeRewriteLog(path string, recs []*record) (*aol.Log, error) {
+	if err := os.RemoveAll(path); err != nil {
+		return nil, err
+	}
+
+	opts := *aol.DefaultOptions
+	opts.NoSync = true
+	l, err := aol.Open(path, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := new(aol.Batch)
+	for i, r := range recs {
+		rec, err := r.encode()
+		if err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+		batch.Write(rec)
+
+		if (i+1)%rewriteBatchSize == 0 {
+			if err := l.WriteBatch(batch); err != nil {
+				_ = l.Close()
+				return nil, err
+			}
+		}
+	}
+	if err := l.WriteBatch(batch); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	if err := l.Sync(); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (db *FlashDB) abortRewrite(tmpPath string) {
+	db.mu.Lock()
+	db.rewrite = nil
+	db.mu.Unlock()
+	_ = os.RemoveAll(tmpPath)
+}
+
+// swapLog replaces the segments at config.Path with the ones at tmpPath, which
+// hold count records, and reopens the log. If the swap fails, the old segments
+// are reopened, so that the database keeps running on them. The caller must
+// hold db.mu.
+func (db *FlashDB) swapLog(tmpPath string, count uint64) error {
+	path := db.config.Path
+	backupPath := path + backupDirSuffix
+
+	if err := db.log.Close(); err != nil {
+		return db.reopenLog(err)
+	}
+	if err := os.RemoveAll(backupPath); err != nil {
+		return db.reopenLog(err)
+	}
+	if err := os.Rename(path, backupPath); err != nil {
+		return db.reopenLog(err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		if rerr := os.Rename(backupPath, path); rerr != nil {
+			// opening the log now would create an empty one: leave it
+			// closed, and the old segments to recoverRewrite on restart.
+			return err
+		}
+		return db.reopenLog(err)
+	}
+
+	l, err := db.openLog()
+	if err != nil {
+		return err
+	}
+	db.log = l
+	atomic.StoreUint64(&db.logCount, count)
+
+	if !db.config.NoSync {
+		// make the renames durable before the old segments are removed; the
+		// new segments are in use either way, and recoverRewrite removes the
+		// old ones on restart.
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(backupPath)
+}
+
+// reopenLog reopens the log at config.Path after a failed swap, and returns
+// the error of the swap.
+func (db *FlashDB) reopenLog(err error) error {
+	l, oerr := db.openLog()
+	if oerr != nil {
+		return fmt.Errorf("%v, and reopening the log failed: %w", err, oerr)
+	}
+	db.log = l
+	return err
+}
+
+// syncDir fsyncs the directory at path, so that the renames of its entries are
+// durable.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// recoverRewrite cleans up after a rewrite that was interrupted by a crash.
+// If the old segments were moved aside but the new ones were not yet put in
+// place, the old segments are restored.
+func recoverRewrite(path string) error {
+	backupPath := path + backupDirSuffix
+	if _, err := os.Stat(backupPath); err == nil {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := os.Rename(backupPath, path); err != nil {
+				return err
+			}
+		} else if err := os.RemoveAll(backupPath); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(path + rewriteDirSuffix)
+}
+
+// dump calls fn with the records needed to rebuild the live contents of every
+// store, including TTLs. Expired keys are skipped. The caller must hold db.mu.
+func (db *FlashDB) dump(fn func(r *record)) {
+	for _, dType := range dataTypes {
+		for _, key := range db.storeKeys(dType) {
+			if db.hasExpired(key, dType) {
+				continue
+			}
+			db.dumpKey(dType, key, key, fn)
+		}
+	}
+}
+
+// dumpKey calls fn with the records writing the content of the key of type
+// dType, and its TTLs, to the key dst. Expired hash fields are skipped.
+func (db *FlashDB) dumpKey(dType DataType, key, dst string, fn func(r *record)) {
+	switch dType {
+	case String:
+		val := db.strStore.Search([]byte(key))
+		if val == nil {
+			return
+		}
+		fn(newRecord([]byte(dst), []byte(toString(val)), StringRecord, StringSet))
+		db.dumpTTL(String, key, dst, StringRecord, StringExpire, fn)
+	case Hash:
+		for _, field := range db.hashStore.HKeys(key) {
+			ttl := db.fieldExps.HGet(key, field)
+			if ttl != nil && nowMs() > ttl.(int64) {
+				continue
+			}
+			value := toString(db.hashStore.HGet(key, field))
+			fn(newRecordWithValue([]byte(dst), []byte(field), []byte(value), HashRecord, HashHSet))
+			if ttl != nil {
+				fn(newRecordWithExpire([]byte(dst), []byte(field), ttl.(int64), HashRecord, HashHFieldExpire))
+			}
+		}
+		db.dumpTTL(Hash, key, dst, HashRecord, HashHExpire, fn)
+	case Set:
+		for _, member := range db.setStore.SMembers(key) {
+			fn(newRecord([]byte(dst), []byte(toString(member)), SetRecord, SetSAdd))
+		}
+		db.dumpTTL(Set, key, dst, SetRecord, SetSExpire, fn)
+	case ZSet:
+		vals := db.zsetStore.ZRangeWithScores(key, 0, -1)
+		for i := 0; i+1 < len(vals); i += 2 {
+			member, score := vals[i].(string), vals[i+1].(float64)
+			value := float64ToStr(score)
+			fn(newRecordWithValue([]byte(dst), []byte(member), []byte(value), ZSetRecord, ZSetZAdd))
+		}
+		db.dumpTTL(ZSet, key, dst, ZSetRecord, ZSetZExpire, fn)
+	case List:
+		for _, val := range db.listStore.LRange(key, 0, -1) {
+			fn(newRecord([]byte(dst), []byte(val), ListRecord, ListRPush))
+		}
+		db.dumpTTL(List, key, dst, ListRecord, ListLExpire, fn)
+	}
+}
+
+func (db *FlashDB) dumpTTL(dType DataType, key, dst string, t, mark uint16, fn func(r *record)) {
+	ttl := db.getTTL(dType, key)
+	if ttl == nil {
+		return
+	}
+	fn(newRecordWithExpire([]byte(dst), nil, ttl.(int64), t, mark))
+}
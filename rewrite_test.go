@@ -0,0 +1,178 @@
+package flashdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/arriqaaq/aol"
+	"github.com/stretchr/testify/assert"
+)
+
+func countLogRecords(t *testing.T, l *aol.Log) int {
+	n := 0
+	for i := 1; i <= l.Segments(); i++ {
+		for j := 0; ; j++ {
+			_, err := l.Read(uint64(i), uint64(j))
+			if err == aol.ErrEOF {
+				break
+			}
+			assert.NoError(t, err)
+			n++
+		}
+	}
+	return n
+}
+
+func TestFlashDB_Rewrite(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	for i := 0; i < 100; i++ {
+		db.Update(func(tx *Tx) error {
+			value := fmt.Sprintf("value_%d", i)
+			tx.Set("str", value)
+			tx.HSet("hash", "field", value)
+			tx.SAdd("set", value)
+			tx.ZAdd("zset", float64(i), "member")
+			return nil
+		})
+	}
+	db.Update(func(tx *Tx) error {
+		tx.Set("deleted", "1")
+		tx.Expire("str", 100)
+		tx.SRem("set", "value_0")
+		return nil
+	})
+	db.Update(func(tx *Tx) error {
+		return tx.Delete("deleted")
+	})
+
+	before := countLogRecords(t, db.log)
+	assert.NoError(t, db.Rewrite())
+	after := countLogRecords(t, db.log)
+	// str + ttl, hash field, 99 set members, zset member
+	assert.Equal(t, 1+1+1+99+1, after)
+	assert.Less(t, after, before)
+
+	// writes after the rewrite go to the new log
+	db.Update(func(tx *Tx) error {
+		return tx.Set("after", "rewrite")
+	})
+	assert.NoError(t, db.Close())
+
+	db2 := getTestDB()
+	defer db2.Close()
+
+	db2.View(func(tx *Tx) error {
+		val, err := tx.Get("str")
+		assert.NoError(t, err)
+		assert.Equal(t, "value_99", val)
+		assert.True(t, tx.TTL("str") > 0)
+
+		_, err = tx.Get("deleted")
+		assert.Equal(t, ErrInvalidKey, err)
+
+		val, err = tx.Get("after")
+		assert.NoError(t, err)
+		assert.Equal(t, "rewrite", val)
+
+		assert.Equal(t, "value_99", tx.HGet("hash", "field"))
+		assert.Equal(t, 99, tx.SCard("set"))
+		assert.False(t, tx.SIsMember("set", "value_0"))
+
+		ok, score := tx.ZScore("zset", "member")
+		assert.True(t, ok)
+		assert.Equal(t, 99.0, score)
+		return nil
+	})
+}
+
+func TestFlashDB_RewriteBuffersWrites(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	db.Update(func(tx *Tx) error {
+		return tx.Set("foo", "bar")
+	})
+
+	// simulate a commit landing while the new log is being written
+	db.rewrite = &rewriteBuffer{}
+	db.Update(func(tx *Tx) error {
+		return tx.Set("baz", "qux")
+	})
+	assert.Len(t, db.rewrite.recs, 1)
+	db.rewrite = nil
+}
+
+func TestFlashDB_RewriteNotPersistent(t *testing.T) {
+	db, err := New(&Config{})
+	assert.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, ErrNotPersistent, db.Rewrite())
+}
+
+func TestFlashDB_RecoverRewrite(t *testing.T) {
+	defer os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir + backupDirSuffix)
+	defer os.RemoveAll(tmpDir + rewriteDirSuffix)
+
+	db := getTestDB()
+	db.Update(func(tx *Tx) error {
+		return tx.Set("foo", "bar")
+	})
+	db.Close()
+
+	// crash after the old segments were moved aside
+	assert.NoError(t, os.Rename(tmpDir, tmpDir+backupDirSuffix))
+	assert.NoError(t, os.MkdirAll(tmpDir+rewriteDirSuffix, 0750))
+
+	db2 := getTestDB()
+	defer db2.Close()
+
+	db2.View(func(tx *Tx) error {
+		val, err := tx.Get("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", val)
+		return nil
+	})
+
+	_, err := os.Stat(tmpDir + rewriteDirSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFlashDB_SwapLogFailure(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		return tx.Set("before", "swap")
+	})
+	assert.NoError(t, err)
+
+	// the new segments are missing, so the swap fails after the old log is
+	// closed and moved away
+	db.mu.Lock()
+	err = db.swapLog(tmpDir+".missing", 0)
+	db.mu.Unlock()
+	assert.Error(t, err)
+
+	// the old log is back in use
+	err = db.Update(func(tx *Tx) error {
+		return tx.Set("after", "swap")
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	db = getTestDB()
+	defer db.Close()
+	db.View(func(tx *Tx) error {
+		for _, key := range []string{"before", "after"} {
+			_, err := tx.Get(key)
+			assert.NoError(t, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,1316 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arriqaaq/flashdb"
+	"github.com/tidwall/redcon"
+)
+
+type cmdFunc func(tx *flashdb.Tx, args []string) (interface{}, error)
+
+type command struct {
+	fn       cmdFunc
+	arity    int  // number of arguments including the name, negative for a minimum.
+	writable bool // run in a read/write transaction.
+}
+
+// blockingFunc runs a command outside of a transaction, such as a command that
+// blocks.
+type blockingFunc func(ctx context.Context, db *flashdb.FlashDB, args []string) (interface{}, error)
+
+type blockingCommand struct {
+	fn    blockingFunc
+	arity int
+}
+
+func validArity(arity, n int) bool {
+	if arity < 0 {
+		return n >= -arity
+	}
+	return n == arity
+}
+
+var okReply = redcon.SimpleString("OK")
+
+var commands = map[string]command{
+	// Keys, whatever their data type
+	"del":      {del, -2, true},
+	"delete":   {del, -2, true},
+	"exists":   {exists, -2, false},
+	"type":     {typeCmd, 2, false},
+	"rename":   {rename, 3, true},
+	"renamenx": {renameNX, 3, true},
+	"dbsize":   {dbSize, 1, false},
+	"flushall": {flushAll, 1, true},
+	"flushdb":  {flushAll, 1, true},
+	"scan":     {scan, -2, false},
+
+	// String
+	"set":       {set, -3, true},
+	"setex":     {setEx, 4, true},
+	"get":       {get, 2, false},
+	"expire":    {expireCmd((*flashdb.Tx).Expire), 3, true},
+	"pexpire":   {expireCmd((*flashdb.Tx).PExpire), 3, true},
+	"expireat":  {expireCmd((*flashdb.Tx).ExpireAt), 3, true},
+	"pexpireat": {expireCmd((*flashdb.Tx).PExpireAt), 3, true},
+	"ttl":       {typed(flashdb.String, ttlCmd((*flashdb.Tx).TTL)), 2, false},
+	"pttl":      {typed(flashdb.String, ttlCmd((*flashdb.Tx).PTTL)), 2, false},
+	"persist":   {persistCmd((*flashdb.Tx).Persist), 2, true},
+
+	"incr":        {incr, 2, true},
+	"incrby":      {incrBy, 3, true},
+	"decr":        {decr, 2, true},
+	"decrby":      {decrBy, 3, true},
+	"incrbyfloat": {incrByFloat, 3, true},
+
+	"mget":     {mGet, -2, false},
+	"mset":     {mSet, -3, true},
+	"setnx":    {setNX, 3, true},
+	"getset":   {getSet, 3, true},
+	"getdel":   {getDel, 2, true},
+	"getex":    {getEx, -2, true},
+	"append":   {appendCmd, 3, true},
+	"getrange": {typed(flashdb.String, getRange), 4, false},
+	"setrange": {setRange, 4, true},
+	"strlen":   {typed(flashdb.String, strLen), 2, false},
+
+	// Hash
+	"hset":       {hSet, 4, true},
+	"hget":       {typed(flashdb.Hash, hGet), 3, false},
+	"hgetall":    {typed(flashdb.Hash, hGetAll), 2, false},
+	"hdel":       {hDel, -3, true},
+	"hexists":    {typed(flashdb.Hash, hExists), 3, false},
+	"hkeyexists": {typed(flashdb.Hash, hKeyExists), 2, false},
+	"hlen":       {typed(flashdb.Hash, hLen), 2, false},
+	"hkeys":      {typed(flashdb.Hash, hKeys), 2, false},
+	"hvals":      {typed(flashdb.Hash, hVals), 2, false},
+	"hscan":      {hScan, -3, false},
+	"hclear":     {hClear, 2, true},
+	"hexpire":    {hExpireCmd((*flashdb.Tx).HExpire, (*flashdb.Tx).HExpireFields), -3, true},
+	"hpexpire":   {hExpireCmd((*flashdb.Tx).HPExpire, (*flashdb.Tx).HPExpireFields), -3, true},
+	"hexpireat":  {hExpireCmd((*flashdb.Tx).HExpireAt, (*flashdb.Tx).HExpireAtFields), -3, true},
+	"hpexpireat": {hExpireCmd((*flashdb.Tx).HPExpireAt, (*flashdb.Tx).HPExpireAtFields), -3, true},
+	"httl":       {typed(flashdb.Hash, hTTLCmd((*flashdb.Tx).HTTL, (*flashdb.Tx).HTTLFields)), -2, false},
+	"hpttl":      {typed(flashdb.Hash, hTTLCmd((*flashdb.Tx).HPTTL, (*flashdb.Tx).HPTTLFields)), -2, false},
+	"hpersist":   {hPersistCmd((*flashdb.Tx).HPersist, (*flashdb.Tx).HPersistFields), -2, true},
+
+	// Set
+	"sadd":        {sAdd, -3, true},
+	"sismember":   {typed(flashdb.Set, sIsMember), 3, false},
+	"srandmember": {typed(flashdb.Set, sRandMember), -2, false},
+	"srem":        {sRem, -3, true},
+	"smove":       {sMove, 4, true},
+	"scard":       {typed(flashdb.Set, sCard), 2, false},
+	"smembers":    {typed(flashdb.Set, sMembers), 2, false},
+	"sscan":       {sScan, -3, false},
+	"sunion":      {sUnion, -2, false},
+	"sdiff":       {sDiff, -2, false},
+	"skeyexists":  {typed(flashdb.Set, sKeyExists), 2, false},
+	"sclear":      {sClear, 2, true},
+	"sexpire":     {expireCmd((*flashdb.Tx).SExpire), 3, true},
+	"spexpire":    {expireCmd((*flashdb.Tx).SPExpire), 3, true},
+	"sexpireat":   {expireCmd((*flashdb.Tx).SExpireAt), 3, true},
+	"spexpireat":  {expireCmd((*flashdb.Tx).SPExpireAt), 3, true},
+	"sttl":        {typed(flashdb.Set, ttlCmd((*flashdb.Tx).STTL)), 2, false},
+	"spttl":       {typed(flashdb.Set, ttlCmd((*flashdb.Tx).SPTTL)), 2, false},
+	"spersist":    {persistCmd((*flashdb.Tx).SPersist), 2, true},
+
+	// ZSet
+	"zadd":           {zAdd, -4, true},
+	"zscore":         {typed(flashdb.ZSet, zScore), 3, false},
+	"zcard":          {typed(flashdb.ZSet, zCard), 2, false},
+	"zrank":          {typed(flashdb.ZSet, zRank), 3, false},
+	"zrevrank":       {typed(flashdb.ZSet, zRevRank), 3, false},
+	"zrange":         {typed(flashdb.ZSet, zRange), -4, false},
+	"zrevrange":      {typed(flashdb.ZSet, zRevRange), -4, false},
+	"zscan":          {zScan, -3, false},
+	"zrem":           {zRem, -3, true},
+	"zgetbyrank":     {typed(flashdb.ZSet, zGetByRank), 3, false},
+	"zrevgetbyrank":  {typed(flashdb.ZSet, zRevGetByRank), 3, false},
+	"zscorerange":    {typed(flashdb.ZSet, zScoreRange), 4, false},
+	"zrevscorerange": {typed(flashdb.ZSet, zRevScoreRange), 4, false},
+	"zkeyexists":     {typed(flashdb.ZSet, zKeyExists), 2, false},
+	"zclear":         {zClear, 2, true},
+	"zexpire":        {expireCmd((*flashdb.Tx).ZExpire), 3, true},
+	"zpexpire":       {expireCmd((*flashdb.Tx).ZPExpire), 3, true},
+	"zexpireat":      {expireCmd((*flashdb.Tx).ZExpireAt), 3, true},
+	"zpexpireat":     {expireCmd((*flashdb.Tx).ZPExpireAt), 3, true},
+	"zttl":           {typed(flashdb.ZSet, ttlCmd((*flashdb.Tx).ZTTL)), 2, false},
+	"zpttl":          {typed(flashdb.ZSet, ttlCmd((*flashdb.Tx).ZPTTL)), 2, false},
+	"zpersist":       {persistCmd((*flashdb.Tx).ZPersist), 2, true},
+
+	// List
+	"lpush":      {lPush, -3, true},
+	"rpush":      {rPush, -3, true},
+	"lpop":       {lPop, 2, true},
+	"rpop":       {rPop, 2, true},
+	"lrange":     {typed(flashdb.List, lRange), 4, false},
+	"lindex":     {lIndex, 3, false},
+	"lset":       {lSet, 4, true},
+	"lrem":       {lRem, 4, true},
+	"ltrim":      {lTrim, 4, true},
+	"llen":       {typed(flashdb.List, lLen), 2, false},
+	"linsert":    {lInsert, 5, true},
+	"lkeyexists": {typed(flashdb.List, lKeyExists), 2, false},
+	"lclear":     {lClear, 2, true},
+	"lexpire":    {expireCmd((*flashdb.Tx).LExpire), 3, true},
+	"lpexpire":   {expireCmd((*flashdb.Tx).LPExpire), 3, true},
+	"lexpireat":  {expireCmd((*flashdb.Tx).LExpireAt), 3, true},
+	"lpexpireat": {expireCmd((*flashdb.Tx).LPExpireAt), 3, true},
+	"lttl":       {typed(flashdb.List, ttlCmd((*flashdb.Tx).LTTL)), 2, false},
+	"lpttl":      {typed(flashdb.List, ttlCmd((*flashdb.Tx).LPTTL)), 2, false},
+	"lpersist":   {persistCmd((*flashdb.Tx).LPersist), 2, true},
+	"lmove":      {lMove, 5, true},
+}
+
+var blockingCommands = map[string]blockingCommand{
+	"blpop":  {bLPop, -3},
+	"brpop":  {bRPop, -3},
+	"blmove": {bLMove, 6},
+
+	// Pub/Sub, which does not touch the keys
+	"publish": {publish, 3},
+	"pubsub":  {pubSub, -2},
+}
+
+func parseInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+	return n, nil
+}
+
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, ErrNotFloat
+	}
+	return f, nil
+}
+
+func boolInt(b bool) redcon.SimpleInt {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// withScores reports whether the optional trailing WITHSCORES argument is set.
+func withScores(args []string) (bool, error) {
+	switch len(args) {
+	case 0:
+		return false, nil
+	case 1:
+		if strings.EqualFold(args[0], "withscores") {
+			return true, nil
+		}
+	}
+	return false, ErrSyntax
+}
+
+/*
+	String commands
+*/
+
+func set(tx *flashdb.Tx, args []string) (interface{}, error) {
+	var opts flashdb.SetOptions
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			opts.NX = true
+		case "xx":
+			opts.XX = true
+		case "keepttl":
+			opts.KeepTTL = true
+		case "get":
+			opts.Get = true
+		case "ex", "px", "exat", "pxat":
+			if i+1 == len(args) {
+				return nil, ErrSyntax
+			}
+			if err := parseExpireOption(args[i], args[i+1], &opts.Expire, &opts.PExpire, &opts.ExpireAt, &opts.PExpireAt); err != nil {
+				return nil, err
+			}
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	res, err := tx.SetWithOptions(args[0], args[1], opts)
+	if err == flashdb.ErrInvalidOptions {
+		return nil, ErrSyntax
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.Get {
+		if !res.Existed {
+			return nil, nil
+		}
+		return res.Old, nil
+	}
+	if !res.Set {
+		return nil, nil
+	}
+	return okReply, nil
+}
+
+func setEx(tx *flashdb.Tx, args []string) (interface{}, error) {
+	duration, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.SetEx(args[0], args[2], duration); err != nil {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+func get(tx *flashdb.Tx, args []string) (interface{}, error) {
+	val, err := tx.Get(args[0])
+	if err == flashdb.ErrInvalidKey || err == flashdb.ErrExpiredKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func del(tx *flashdb.Tx, args []string) (interface{}, error) {
+	n, err := tx.Del(args...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func exists(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return redcon.SimpleInt(tx.ExistsAny(args...)), nil
+}
+
+func typeCmd(tx *flashdb.Tx, args []string) (interface{}, error) {
+	dType := tx.Type(args[0])
+	if dType == "" {
+		return redcon.SimpleString("none"), nil
+	}
+	return redcon.SimpleString(strings.ToLower(dType)), nil
+}
+
+func rename(tx *flashdb.Tx, args []string) (interface{}, error) {
+	err := tx.Rename(args[0], args[1])
+	if err == flashdb.ErrInvalidKey {
+		return nil, ErrNoSuchKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+func renameNX(tx *flashdb.Tx, args []string) (interface{}, error) {
+	ok, err := tx.RenameNX(args[0], args[1])
+	if err == flashdb.ErrInvalidKey {
+		return nil, ErrNoSuchKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func dbSize(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return redcon.SimpleInt(tx.DBSize()), nil
+}
+
+func flushAll(tx *flashdb.Tx, args []string) (interface{}, error) {
+	if err := tx.FlushAll(); err != nil {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+func scan(tx *flashdb.Tx, args []string) (interface{}, error) {
+	opts, err := parseScanOptions(args[1:], true)
+	if err != nil {
+		return nil, err
+	}
+	next, keys, err := tx.Scan(args[0], opts)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{next, keys}, nil
+}
+
+// parseScanOptions parses the MATCH and COUNT options of the scan commands,
+// and the TYPE option of SCAN if withType is set.
+func parseScanOptions(args []string, withType bool) (opts flashdb.ScanOptions, err error) {
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return opts, ErrSyntax
+		}
+		val := args[i+1]
+		switch strings.ToLower(args[i]) {
+		case "match":
+			opts.Match = val
+		case "count":
+			n, err := parseInt(val)
+			if err != nil {
+				return opts, err
+			}
+			if n < 1 {
+				return opts, ErrSyntax
+			}
+			opts.Count = int(n)
+		case "type":
+			if !withType {
+				return opts, ErrSyntax
+			}
+			opts.Type = dataType(val)
+		default:
+			return opts, ErrSyntax
+		}
+	}
+	return opts, nil
+}
+
+// dataType returns the data type named as by TYPE. An unknown name is kept
+// as is, so that it matches no key.
+func dataType(name string) flashdb.DataType {
+	for _, dType := range []flashdb.DataType{flashdb.String, flashdb.Hash, flashdb.Set, flashdb.ZSet, flashdb.List} {
+		if strings.EqualFold(name, dType) {
+			return dType
+		}
+	}
+	return name
+}
+
+func incr(tx *flashdb.Tx, args []string) (interface{}, error) {
+	n, err := tx.Incr(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func incrBy(tx *flashdb.Tx, args []string) (interface{}, error) {
+	delta, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	n, err := tx.IncrBy(args[0], delta)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func decr(tx *flashdb.Tx, args []string) (interface{}, error) {
+	n, err := tx.Decr(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func decrBy(tx *flashdb.Tx, args []string) (interface{}, error) {
+	delta, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	n, err := tx.DecrBy(args[0], delta)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func incrByFloat(tx *flashdb.Tx, args []string) (interface{}, error) {
+	delta, err := parseFloat(args[1])
+	if err != nil {
+		return nil, err
+	}
+	f, err := tx.IncrByFloat(args[0], delta)
+	if err != nil {
+		return nil, err
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+func mGet(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return tx.MGet(args...), nil
+}
+
+func mSet(tx *flashdb.Tx, args []string) (interface{}, error) {
+	if err := tx.MSet(args...); err != nil {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+func setNX(tx *flashdb.Tx, args []string) (interface{}, error) {
+	ok, err := tx.SetNX(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func getSet(tx *flashdb.Tx, args []string) (interface{}, error) {
+	old, ok, err := tx.GetSet(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return old, nil
+}
+
+func getDel(tx *flashdb.Tx, args []string) (interface{}, error) {
+	val, err := tx.GetDel(args[0])
+	if err == flashdb.ErrInvalidKey || err == flashdb.ErrExpiredKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func getEx(tx *flashdb.Tx, args []string) (interface{}, error) {
+	var opts flashdb.GetExOptions
+	switch len(args) {
+	case 1:
+	case 2:
+		if !strings.EqualFold(args[1], "persist") {
+			return nil, ErrSyntax
+		}
+		opts.Persist = true
+	case 3:
+		if err := parseExpireOption(args[1], args[2], &opts.Expire, &opts.PExpire, &opts.ExpireAt, &opts.PExpireAt); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrSyntax
+	}
+
+	val, err := tx.GetEx(args[0], opts)
+	if err == flashdb.ErrInvalidKey || err == flashdb.ErrExpiredKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// parseExpireOption parses the EX, PX, EXAT or PXAT option of SET and GETEX
+// into the matching field.
+func parseExpireOption(name, arg string, ex, px, exAt, pxAt *int64) error {
+	n, err := parseInt(arg)
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		return flashdb.ErrInvalidTTL
+	}
+
+	switch strings.ToLower(name) {
+	case "ex":
+		*ex = n
+	case "px":
+		*px = n
+	case "exat":
+		*exAt = n
+	case "pxat":
+		*pxAt = n
+	default:
+		return ErrSyntax
+	}
+	return nil
+}
+
+func appendCmd(tx *flashdb.Tx, args []string) (interface{}, error) {
+	n, err := tx.Append(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func getRange(tx *flashdb.Tx, args []string) (interface{}, error) {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return tx.GetRange(args[0], int(start), int(end)), nil
+}
+
+func setRange(tx *flashdb.Tx, args []string) (interface{}, error) {
+	offset, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	n, err := tx.SetRange(args[0], int(offset), args[2])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func strLen(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return redcon.SimpleInt(tx.StrLen(args[0])), nil
+}
+
+/*
+	Hash commands
+*/
+
+func hSet(tx *flashdb.Tx, args []string) (interface{}, error) {
+	added := !tx.HExists(args[0], args[1])
+	if _, err := tx.HSet(args[0], args[1], args[2]); err != nil {
+		return nil, err
+	}
+	return boolInt(added), nil
+}
+
+func hGet(tx *flashdb.Tx, args []string) (interface{}, error) {
+	if !tx.HExists(args[0], args[1]) {
+		return nil, nil
+	}
+	return tx.HGet(args[0], args[1]), nil
+}
+
+func hGetAll(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return tx.HGetAll(args[0]), nil
+}
+
+func hDel(tx *flashdb.Tx, args []string) (interface{}, error) {
+	fields := make([]string, 0, len(args)-1)
+	for _, field := range args[1:] {
+		if tx.HExists(args[0], field) {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return redcon.SimpleInt(0), nil
+	}
+	n, err := tx.HDel(args[0], fields...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func hExists(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return boolInt(tx.HExists(args[0], args[1])), nil
+}
+
+func hKeyExists(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return boolInt(tx.HKeyExists(args[0])), nil
+}
+
+func hLen(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return redcon.SimpleInt(tx.HLen(args[0])), nil
+}
+
+func hKeys(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return tx.HKeys(args[0]), nil
+}
+
+func hScan(tx *flashdb.Tx, args []string) (interface{}, error) {
+	opts, err := parseScanOptions(args[2:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, vals, err := tx.HScan(args[0], args[1], opts)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{next, vals}, nil
+}
+
+func hVals(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return tx.HVals(args[0]), nil
+}
+
+func hClear(tx *flashdb.Tx, args []string) (interface{}, error) {
+	if err := tx.HClear(args[0]); err != nil {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+/*
+	Set commands
+*/
+
+func sAdd(tx *flashdb.Tx, args []string) (interface{}, error) {
+	added := make(map[string]bool)
+	for _, m := range args[1:] {
+		if !tx.SIsMember(args[0], m) {
+			added[m] = true
+		}
+	}
+	if err := tx.SAdd(args[0], args[1:]...); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(len(added)), nil
+}
+
+func sIsMember(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return boolInt(tx.SIsMember(args[0], args[1])), nil
+}
+
+func sRandMember(tx *flashdb.Tx, args []string) (interface{}, error) {
+	switch len(args) {
+	case 1:
+		vals := tx.SRandMember(args[0], 1)
+		if len(vals) == 0 {
+			return nil, nil
+		}
+		return vals[0], nil
+	case 2:
+		count, err := parseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return tx.SRandMember(args[0], int(count)), nil
+	}
+	return nil, ErrSyntax
+}
+
+func sRem(tx *flashdb.Tx, args []string) (interface{}, error) {
+	members := make([]string, 0, len(args)-1)
+	for _, m := range args[1:] {
+		if tx.SIsMember(args[0], m) {
+			members = append(members, m)
+		}
+	}
+	if len(members) == 0 {
+		return redcon.SimpleInt(0), nil
+	}
+	n, err := tx.SRem(args[0], members...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func sMove(tx *flashdb.Tx, args []string) (interface{}, error) {
+	if !tx.SIsMember(args[0], args[2]) {
+		return redcon.SimpleInt(0), nil
+	}
+	if err := tx.SMove(args[0], args[1], args[2]); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(1), nil
+}
+
+func sCard(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return redcon.SimpleInt(tx.SCard(args[0])), nil
+}
+
+func sScan(tx *flashdb.Tx, args []string) (interface{}, error) {
+	opts, err := parseScanOptions(args[2:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, members, err := tx.SScan(args[0], args[1], opts)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{next, members}, nil
+}
+
+func sMembers(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return tx.SMembers(args[0]), nil
+}
+
+func sUnion(tx *flashdb.Tx, args []string) (interface{}, error) {
+	if err := tx.CheckType(flashdb.Set, args...); err != nil {
+		return nil, err
+	}
+	return tx.SUnion(args...), nil
+}
+
+func sDiff(tx *flashdb.Tx, args []string) (interface{}, error) {
+	if err := tx.CheckType(flashdb.Set, args...); err != nil {
+		return nil, err
+	}
+	return tx.SDiff(args...), nil
+}
+
+func sKeyExists(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return boolInt(tx.SKeyExists(args[0])), nil
+}
+
+func sClear(tx *flashdb.Tx, args []string) (interface{}, error) {
+	err := tx.SClear(args[0])
+	if err != nil && err != flashdb.ErrInvalidKey {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+/*
+	ZSet commands
+*/
+
+func zAdd(tx *flashdb.Tx, args []string) (interface{}, error) {
+	if len(args)%2 != 1 {
+		return nil, ErrSyntax
+	}
+
+	var n redcon.SimpleInt
+	for i := 1; i < len(args); i += 2 {
+		score, err := parseFloat(args[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok, _ := tx.ZScore(args[0], args[i+1]); !ok {
+			n++
+		}
+		if err := tx.ZAdd(args[0], score, args[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func zScore(tx *flashdb.Tx, args []string) (interface{}, error) {
+	ok, score := tx.ZScore(args[0], args[1])
+	if !ok {
+		return nil, nil
+	}
+	return score, nil
+}
+
+func zCard(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return redcon.SimpleInt(tx.ZCard(args[0])), nil
+}
+
+func zRank(tx *flashdb.Tx, args []string) (interface{}, error) {
+	rank := tx.ZRank(args[0], args[1])
+	if rank < 0 {
+		return nil, nil
+	}
+	return redcon.SimpleInt(rank), nil
+}
+
+func zRevRank(tx *flashdb.Tx, args []string) (interface{}, error) {
+	rank := tx.ZRevRank(args[0], args[1])
+	if rank < 0 {
+		return nil, nil
+	}
+	return redcon.SimpleInt(rank), nil
+}
+
+func zRange(tx *flashdb.Tx, args []string) (interface{}, error) {
+	start, stop, scores, err := parseRange(args)
+	if err != nil {
+		return nil, err
+	}
+	if scores {
+		return tx.ZRangeWithScores(args[0], start, stop), nil
+	}
+	return tx.ZRange(args[0], start, stop), nil
+}
+
+func zScan(tx *flashdb.Tx, args []string) (interface{}, error) {
+	opts, err := parseScanOptions(args[2:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, vals, err := tx.ZScan(args[0], args[1], opts)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{next, vals}, nil
+}
+
+func zRevRange(tx *flashdb.Tx, args []string) (interface{}, error) {
+	start, stop, scores, err := parseRange(args)
+	if err != nil {
+		return nil, err
+	}
+	if scores {
+		return tx.ZRevRangeWithScores(args[0], start, stop), nil
+	}
+	return tx.ZRevRange(args[0], start, stop), nil
+}
+
+func parseRange(args []string) (start, stop int, scores bool, err error) {
+	var n int64
+	if n, err = parseInt(args[1]); err != nil {
+		return
+	}
+	start = int(n)
+	if n, err = parseInt(args[2]); err != nil {
+		return
+	}
+	stop = int(n)
+	scores, err = withScores(args[3:])
+	return
+}
+
+func zRem(tx *flashdb.Tx, args []string) (interface{}, error) {
+	var n redcon.SimpleInt
+	for _, m := range args[1:] {
+		ok, err := tx.ZRem(args[0], m)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func zGetByRank(tx *flashdb.Tx, args []string) (interface{}, error) {
+	rank, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return tx.ZGetByRank(args[0], int(rank)), nil
+}
+
+func zRevGetByRank(tx *flashdb.Tx, args []string) (interface{}, error) {
+	rank, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return tx.ZRevGetByRank(args[0], int(rank)), nil
+}
+
+func zScoreRange(tx *flashdb.Tx, args []string) (interface{}, error) {
+	min, err := parseFloat(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseFloat(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return tx.ZScoreRange(args[0], min, max), nil
+}
+
+func zRevScoreRange(tx *flashdb.Tx, args []string) (interface{}, error) {
+	max, err := parseFloat(args[1])
+	if err != nil {
+		return nil, err
+	}
+	min, err := parseFloat(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return tx.ZRevScoreRange(args[0], max, min), nil
+}
+
+func zKeyExists(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return boolInt(tx.ZKeyExists(args[0])), nil
+}
+
+func zClear(tx *flashdb.Tx, args []string) (interface{}, error) {
+	if err := tx.ZClear(args[0]); err != nil {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+/*
+	List commands
+*/
+
+func lPush(tx *flashdb.Tx, args []string) (interface{}, error) {
+	n, err := tx.LPush(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func rPush(tx *flashdb.Tx, args []string) (interface{}, error) {
+	n, err := tx.RPush(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func lPop(tx *flashdb.Tx, args []string) (interface{}, error) {
+	val, err := tx.LPop(args[0])
+	if err == flashdb.ErrInvalidKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func rPop(tx *flashdb.Tx, args []string) (interface{}, error) {
+	val, err := tx.RPop(args[0])
+	if err == flashdb.ErrInvalidKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func lRange(tx *flashdb.Tx, args []string) (interface{}, error) {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return tx.LRange(args[0], int(start), int(stop)), nil
+}
+
+func lIndex(tx *flashdb.Tx, args []string) (interface{}, error) {
+	index, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	val, err := tx.LIndex(args[0], int(index))
+	if err == flashdb.ErrInvalidKey || err == flashdb.ErrIndexOutOfRange {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func lSet(tx *flashdb.Tx, args []string) (interface{}, error) {
+	index, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.LSet(args[0], int(index), args[2]); err != nil {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+func lRem(tx *flashdb.Tx, args []string) (interface{}, error) {
+	count, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	n, err := tx.LRem(args[0], int(count), args[2])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func lTrim(tx *flashdb.Tx, args []string) (interface{}, error) {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.LTrim(args[0], int(start), int(stop)); err != nil {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+func lLen(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return redcon.SimpleInt(tx.LLen(args[0])), nil
+}
+
+func lInsert(tx *flashdb.Tx, args []string) (interface{}, error) {
+	var pos flashdb.InsertPosition
+	switch strings.ToLower(args[1]) {
+	case "before":
+		pos = flashdb.Before
+	case "after":
+		pos = flashdb.After
+	default:
+		return nil, ErrSyntax
+	}
+	n, err := tx.LInsert(args[0], pos, args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func lKeyExists(tx *flashdb.Tx, args []string) (interface{}, error) {
+	return boolInt(tx.LKeyExists(args[0])), nil
+}
+
+func lClear(tx *flashdb.Tx, args []string) (interface{}, error) {
+	err := tx.LClear(args[0])
+	if err != nil && err != flashdb.ErrInvalidKey {
+		return nil, err
+	}
+	return okReply, nil
+}
+
+func lMove(tx *flashdb.Tx, args []string) (interface{}, error) {
+	from, to, err := parseDirections(args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+	val, err := tx.LMove(args[0], args[1], from, to)
+	if err == flashdb.ErrInvalidKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func parseDirections(from, to string) (flashdb.ListDirection, flashdb.ListDirection, error) {
+	f, err := parseDirection(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	t, err := parseDirection(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return f, t, nil
+}
+
+func parseDirection(s string) (flashdb.ListDirection, error) {
+	switch strings.ToLower(s) {
+	case "left":
+		return flashdb.Left, nil
+	case "right":
+		return flashdb.Right, nil
+	}
+	return 0, ErrSyntax
+}
+
+// parseTimeout parses a timeout in seconds, where 0 blocks indefinitely.
+func parseTimeout(s string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, ErrNotFloat
+	}
+	if secs < 0 {
+		return 0, ErrNegativeTimeout
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+/*
+	Blocking commands
+*/
+
+func bLPop(ctx context.Context, db *flashdb.FlashDB, args []string) (interface{}, error) {
+	return blockingPop(ctx, args, db.BLPop)
+}
+
+func bRPop(ctx context.Context, db *flashdb.FlashDB, args []string) (interface{}, error) {
+	return blockingPop(ctx, args, db.BRPop)
+}
+
+func blockingPop(ctx context.Context, args []string, pop func(context.Context, time.Duration, ...string) (string, string, error)) (interface{}, error) {
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	key, val, err := pop(ctx, timeout, args[:len(args)-1]...)
+	if errors.Is(err, flashdb.ErrTimeout) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []string{key, val}, nil
+}
+
+func bLMove(ctx context.Context, db *flashdb.FlashDB, args []string) (interface{}, error) {
+	from, to, err := parseDirections(args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseTimeout(args[4])
+	if err != nil {
+		return nil, err
+	}
+	val, err := db.BLMove(ctx, timeout, args[0], args[1], from, to)
+	if errors.Is(err, flashdb.ErrTimeout) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+/*
+	TTL commands
+*/
+
+// typed returns a command running fn once its key, the first argument, is
+// checked to hold a value of type dType. It wraps the commands whose methods
+// of Tx have no error to return with Config.StrictTypes.
+func typed(dType flashdb.DataType, fn cmdFunc) cmdFunc {
+	return func(tx *flashdb.Tx, args []string) (interface{}, error) {
+		if err := tx.CheckType(dType, args[0]); err != nil {
+			return nil, err
+		}
+		return fn(tx, args)
+	}
+}
+
+// expireCmd returns a command setting the TTL of a key with fn, one of the
+// expire methods of Tx. It replies 1 if the TTL was set and 0 if the key
+// does not exist.
+func expireCmd(fn func(tx *flashdb.Tx, key string, n int64) error) cmdFunc {
+	return func(tx *flashdb.Tx, args []string) (interface{}, error) {
+		n, err := parseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		err = fn(tx, args[0], n)
+		if err == flashdb.ErrInvalidKey || err == flashdb.ErrExpiredKey {
+			return redcon.SimpleInt(0), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return redcon.SimpleInt(1), nil
+	}
+}
+
+// ttlCmd returns a command replying the TTL of a key read with fn, one of the
+// TTL methods of Tx.
+func ttlCmd(fn func(tx *flashdb.Tx, key string) int64) cmdFunc {
+	return func(tx *flashdb.Tx, args []string) (interface{}, error) {
+		return redcon.SimpleInt(fn(tx, args[0])), nil
+	}
+}
+
+// persistCmd returns a command removing the TTL of a key with fn, one of the
+// persist methods of Tx. It replies 1 if the TTL was removed.
+func persistCmd(fn func(tx *flashdb.Tx, key string) (bool, error)) cmdFunc {
+	return func(tx *flashdb.Tx, args []string) (interface{}, error) {
+		ok, err := fn(tx, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return redcon.SimpleInt(1), nil
+		}
+		return redcon.SimpleInt(0), nil
+	}
+}
+
+// hExpireCmd is like expireCmd, and also accepts the per-field form
+// key n FIELDS numfields field [field ...], which sets the TTL of the fields
+// with fieldFn and replies the result for each field.
+func hExpireCmd(fn func(tx *flashdb.Tx, key string, n int64) error, fieldFn func(tx *flashdb.Tx, key string, n int64, fields ...string) ([]int, error)) cmdFunc {
+	keyCmd := expireCmd(fn)
+	return func(tx *flashdb.Tx, args []string) (interface{}, error) {
+		if len(args) == 2 {
+			return keyCmd(tx, args)
+		}
+		n, err := parseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		fields, err := parseFields(args[2:])
+		if err != nil {
+			return nil, err
+		}
+		res, err := fieldFn(tx, args[0], n, fields...)
+		if err != nil {
+			return nil, err
+		}
+		return intsReply(res), nil
+	}
+}
+
+// hTTLCmd is like ttlCmd, and also accepts the per-field form
+// key FIELDS numfields field [field ...].
+func hTTLCmd(fn func(tx *flashdb.Tx, key string) int64, fieldFn func(tx *flashdb.Tx, key string, fields ...string) []int64) cmdFunc {
+	keyCmd := ttlCmd(fn)
+	return func(tx *flashdb.Tx, args []string) (interface{}, error) {
+		if len(args) == 1 {
+			return keyCmd(tx, args)
+		}
+		fields, err := parseFields(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		res := fieldFn(tx, args[0], fields...)
+		reply := make([]interface{}, 0, len(res))
+		for _, ttl := range res {
+			reply = append(reply, redcon.SimpleInt(ttl))
+		}
+		return reply, nil
+	}
+}
+
+// hPersistCmd is like persistCmd, and also accepts the per-field form
+// key FIELDS numfields field [field ...].
+func hPersistCmd(fn func(tx *flashdb.Tx, key string) (bool, error), fieldFn func(tx *flashdb.Tx, key string, fields ...string) ([]int, error)) cmdFunc {
+	keyCmd := persistCmd(fn)
+	return func(tx *flashdb.Tx, args []string) (interface{}, error) {
+		if len(args) == 1 {
+			return keyCmd(tx, args)
+		}
+		fields, err := parseFields(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		res, err := fieldFn(tx, args[0], fields...)
+		if err != nil {
+			return nil, err
+		}
+		return intsReply(res), nil
+	}
+}
+
+// parseFields parses the FIELDS numfields field [field ...] arguments of the
+// per-field hash TTL commands.
+func parseFields(args []string) ([]string, error) {
+	if len(args) < 3 || !strings.EqualFold(args[0], "fields") {
+		return nil, ErrSyntax
+	}
+	n, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if n != int64(len(args)-2) {
+		return nil, ErrSyntax
+	}
+	return args[2:], nil
+}
+
+func intsReply(res []int) []interface{} {
+	reply := make([]interface{}, 0, len(res))
+	for _, n := range res {
+		reply = append(reply, redcon.SimpleInt(n))
+	}
+	return reply
+}
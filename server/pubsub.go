@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/arriqaaq/flashdb"
+	"github.com/tidwall/redcon"
+)
+
+// connCommands are served on the connection itself rather than by exec, as
+// they switch it to pub/sub mode.
+var connCommands = []string{"subscribe", "psubscribe", "unsubscribe", "punsubscribe"}
+
+func publish(_ context.Context, db *flashdb.FlashDB, args []string) (interface{}, error) {
+	return redcon.SimpleInt(db.Publish(args[0], args[1])), nil
+}
+
+func pubSub(_ context.Context, db *flashdb.FlashDB, args []string) (interface{}, error) {
+	switch strings.ToLower(args[0]) {
+	case "channels":
+		switch len(args) {
+		case 1:
+			return db.PubSubChannels(""), nil
+		case 2:
+			return db.PubSubChannels(args[1]), nil
+		}
+	case "numsub":
+		channels := args[1:]
+		res := make([]interface{}, 0, 2*len(channels))
+		for i, n := range db.PubSubNumSub(channels...) {
+			res = append(res, channels[i], redcon.SimpleInt(n))
+		}
+		return res, nil
+	case "numpat":
+		if len(args) == 1 {
+			return redcon.SimpleInt(db.PubSubNumPat()), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+	return nil, fmt.Errorf("wrong number of arguments for 'pubsub|%s' command", strings.ToLower(args[0]))
+}
+
+// pubSubConn is a connection in pub/sub mode. It is detached from the server
+// loop: one goroutine serves its commands, and another pushes the messages
+// published to its channels.
+type pubSubConn struct {
+	s  *Server
+	ps *flashdb.PubSub
+
+	mu sync.Mutex // serializes the writes to dc
+	dc redcon.DetachedConn
+}
+
+// subscribe switches the connection to pub/sub mode, and runs the command
+// that did it.
+func (s *Server) subscribe(conn redcon.Conn, args []string) {
+	c := &pubSubConn{s: s, ps: s.db.NewPubSub(), dc: conn.Detach()}
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		c.push()
+	}()
+	go func() {
+		defer s.wg.Done()
+		c.serve(args)
+	}()
+}
+
+// serve runs the commands of the connection until it is closed, or the
+// server is.
+func (c *pubSubConn) serve(args []string) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-c.s.ctx.Done():
+			c.mu.Lock()
+			c.dc.Close()
+			c.mu.Unlock()
+		case <-done:
+		}
+	}()
+	defer c.close()
+
+	for c.exec(args) {
+		cmd, err := c.dc.ReadCommand()
+		if err != nil {
+			return
+		}
+		args = args[:0]
+		for _, arg := range cmd.Args {
+			args = append(args, string(arg))
+		}
+	}
+}
+
+// exec runs a command, and returns false once the connection must be closed.
+func (c *pubSubConn) exec(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.dc.Flush()
+
+	name := strings.ToLower(args[0])
+	switch name {
+	case "subscribe", "psubscribe":
+		if len(args) < 2 {
+			c.dc.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+			return true
+		}
+		for _, arg := range args[1:] {
+			if name == "subscribe" {
+				c.ps.Subscribe(arg)
+			} else {
+				c.ps.PSubscribe(arg)
+			}
+			c.writeCount(name, arg)
+		}
+	case "unsubscribe", "punsubscribe":
+		names := args[1:]
+		if len(names) == 0 {
+			if name == "unsubscribe" {
+				names = c.ps.Channels()
+			} else {
+				names = c.ps.Patterns()
+			}
+		}
+		if len(names) == 0 {
+			writeUnsubscribed(c.dc, name, c.ps.Count())
+		}
+		for _, arg := range names {
+			if name == "unsubscribe" {
+				c.ps.Unsubscribe(arg)
+			} else {
+				c.ps.PUnsubscribe(arg)
+			}
+			c.writeCount(name, arg)
+		}
+	case "ping":
+		if c.ps.Count() == 0 {
+			writePing(c.dc, args)
+			break
+		}
+		if len(args) > 2 {
+			c.dc.WriteError("ERR wrong number of arguments for 'ping' command")
+			break
+		}
+		c.dc.WriteArray(2)
+		c.dc.WriteBulkString("pong")
+		if len(args) == 2 {
+			c.dc.WriteBulkString(args[1])
+		} else {
+			c.dc.WriteBulkString("")
+		}
+	case "quit":
+		c.dc.WriteString("OK")
+		return false
+	default:
+		if c.ps.Count() > 0 {
+			c.dc.WriteError(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", name))
+			break
+		}
+		// back out of pub/sub mode, the connection runs any command
+		res, err := exec(c.s.ctx, c.s.db, args)
+		writeReply(c.dc, res, err)
+	}
+	return true
+}
+
+// writeCount writes the reply to a (un)subscription, with the number of
+// channels and patterns the connection is subscribed to.
+func (c *pubSubConn) writeCount(kind, name string) {
+	c.dc.WriteArray(3)
+	c.dc.WriteBulkString(kind)
+	c.dc.WriteBulkString(name)
+	c.dc.WriteInt(c.ps.Count())
+}
+
+// writeUnsubscribed writes the reply to an unsubscription from nothing.
+func writeUnsubscribed(conn redcon.Conn, kind string, count int) {
+	conn.WriteArray(3)
+	conn.WriteBulkString(kind)
+	conn.WriteNull()
+	conn.WriteInt(count)
+}
+
+// push writes the messages published to the channels of the connection, until
+// it is closed.
+func (c *pubSubConn) push() {
+	for m := range c.ps.C {
+		c.mu.Lock()
+		if m.Pattern != "" {
+			c.dc.WriteArray(4)
+			c.dc.WriteBulkString("pmessage")
+			c.dc.WriteBulkString(m.Pattern)
+		} else {
+			c.dc.WriteArray(3)
+			c.dc.WriteBulkString("message")
+		}
+		c.dc.WriteBulkString(m.Channel)
+		c.dc.WriteBulkString(m.Payload)
+		c.dc.Flush()
+		c.mu.Unlock()
+	}
+}
+
+func (c *pubSubConn) close() {
+	c.ps.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dc.Close()
+}
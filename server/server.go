@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/arriqaaq/flashdb"
+	"github.com/tidwall/redcon"
+)
+
+var (
+	ErrSyntax     = errors.New("syntax error")
+	ErrNotInteger = flashdb.ErrNotInteger
+	ErrNotFloat   = flashdb.ErrNotFloat
+
+	ErrNegativeTimeout = errors.New("timeout is negative")
+	ErrNoSuchKey       = errors.New("no such key")
+)
+
+// Server serves a FlashDB database over the Redis protocol (RESP). Write
+// commands run in a read/write transaction through db.Update, and read
+// commands in a read-only transaction through db.View.
+type Server struct {
+	db  *flashdb.FlashDB
+	srv *redcon.Server
+
+	// done when the server is closed, to release blocked clients.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// the connections served, which Close waits for, along with the
+	// goroutines of the connections in pub/sub mode.
+	mu      sync.Mutex
+	conns   map[redcon.Conn]bool
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// New returns a server for db listening on addr. The database is owned by the
+// caller and is not closed along with the server.
+func New(db *flashdb.FlashDB, addr string) *Server {
+	s := &Server{db: db, conns: make(map[redcon.Conn]bool)}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.srv = redcon.NewServer(addr, s.handle, s.accept, s.closed)
+	return s
+}
+
+// accept tracks a new connection, or refuses it once the server is closing.
+func (s *Server) accept(conn redcon.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = true
+	s.wg.Add(1)
+	return true
+}
+
+// closed forgets a connection once its handler has returned, including when
+// it was detached to pub/sub mode.
+func (s *Server) closed(conn redcon.Conn, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns[conn] {
+		delete(s.conns, conn)
+		s.wg.Done()
+	}
+}
+
+// ListenAndServe serves incoming connections until the server is closed.
+func (s *Server) ListenAndServe() error {
+	return s.srv.ListenAndServe()
+}
+
+// ListenServeAndSignal serves incoming connections and sends a nil error on
+// signal once the server is listening, or the error if it failed to listen.
+func (s *Server) ListenServeAndSignal(signal chan error) error {
+	return s.srv.ListenServeAndSignal(signal)
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.srv.Addr()
+}
+
+// Close stops listening and closes the accepted connections. It releases the
+// blocked clients and waits for the commands being served before closing the
+// listener, as the connections must not be written to once closed.
+func (s *Server) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	s.closing = true
+	for conn := range s.conns {
+		// the handler of the connection returns once its read fails
+		conn.NetConn().Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	return s.srv.Close()
+}
+
+func (s *Server) handle(conn redcon.Conn, cmd redcon.Command) {
+	args := make([]string, 0, len(cmd.Args))
+	for _, arg := range cmd.Args {
+		args = append(args, string(arg))
+	}
+
+	switch name := strings.ToLower(args[0]); name {
+	case "ping":
+		writePing(conn, args)
+		return
+	case "quit":
+		conn.WriteString("OK")
+		conn.Close()
+		return
+	case "subscribe", "psubscribe":
+		s.subscribe(conn, args)
+		return
+	case "unsubscribe", "punsubscribe":
+		// not subscribed to anything
+		for _, arg := range args[1:] {
+			conn.WriteArray(3)
+			conn.WriteBulkString(name)
+			conn.WriteBulkString(arg)
+			conn.WriteInt(0)
+		}
+		if len(args) == 1 {
+			writeUnsubscribed(conn, name, 0)
+		}
+		return
+	}
+
+	res, err := exec(s.ctx, s.db, args)
+	writeReply(conn, res, err)
+}
+
+// writeReply writes the reply of a command run by exec.
+func writeReply(conn redcon.Conn, res interface{}, err error) {
+	switch {
+	case errors.Is(err, flashdb.ErrOutOfMemory):
+		conn.WriteError("OOM command not allowed when used memory > 'maxmemory'")
+	case errors.Is(err, flashdb.ErrWrongType):
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	case err != nil:
+		conn.WriteError("ERR " + err.Error())
+	default:
+		conn.WriteAny(res)
+	}
+}
+
+// writePing writes the reply to PING, with its optional message.
+func writePing(conn redcon.Conn, args []string) {
+	switch len(args) {
+	case 1:
+		conn.WriteString("PONG")
+	case 2:
+		conn.WriteBulkString(args[1])
+	default:
+		conn.WriteError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+// Exec runs a single command against db. args holds the command name followed
+// by its arguments. Write commands run in a read/write transaction and read
+// commands in a read-only transaction. Blocking commands such as BLPOP run
+// outside of a transaction, and may block until their timeout. The reply is
+// in the form written to RESP connections.
+func Exec(db *flashdb.FlashDB, args []string) (interface{}, error) {
+	return exec(context.Background(), db, args)
+}
+
+func exec(ctx context.Context, db *flashdb.FlashDB, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, ErrSyntax
+	}
+
+	name := strings.ToLower(args[0])
+	for _, connCmd := range connCommands {
+		if name == connCmd {
+			return nil, fmt.Errorf("'%s' is only allowed on a connection to the server", name)
+		}
+	}
+	if c, ok := blockingCommands[name]; ok {
+		if !validArity(c.arity, len(args)) {
+			return nil, fmt.Errorf("wrong number of arguments for '%s' command", name)
+		}
+		return c.fn(ctx, db, args[1:])
+	}
+
+	c, ok := commands[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown command '%s'", name)
+	}
+	if !validArity(c.arity, len(args)) {
+		return nil, fmt.Errorf("wrong number of arguments for '%s' command", name)
+	}
+
+	var res interface{}
+	fn := func(tx *flashdb.Tx) (err error) {
+		res, err = c.fn(tx, args[1:])
+		return
+	}
+
+	var err error
+	if c.writable {
+		err = db.Update(fn)
+	} else {
+		err = db.View(fn)
+	}
+	return res, err
+}
+
+// Commands returns the names of the supported commands in sorted order.
+func Commands() []string {
+	names := make([]string, 0, len(commands)+len(blockingCommands)+len(connCommands))
+	names = append(names, connCommands...)
+	for name := range commands {
+		names = append(names, name)
+	}
+	for name := range blockingCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,597 @@
+package server
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/arriqaaq/flashdb"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+var tmpDir = "tmp"
+
+func testServer(t *testing.T) (*Server, redis.Conn, func()) {
+	return testServerWithConfig(t, &flashdb.Config{Path: tmpDir, NoSync: true})
+}
+
+func testServerWithConfig(t *testing.T, config *flashdb.Config) (*Server, redis.Conn, func()) {
+	db, err := flashdb.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(db, "127.0.0.1:0")
+	signal := make(chan error)
+	go s.ListenServeAndSignal(signal)
+	if err := <-signal; err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := redis.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, conn, func() {
+		conn.Close()
+		s.Close()
+		db.Close()
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func TestServer_String(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	res, err := redis.String(conn.Do("SET", "foo", "bar"))
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", res)
+
+	val, err := redis.String(conn.Do("GET", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", val)
+
+	_, err = redis.String(conn.Do("GET", "missing"))
+	assert.Equal(t, redis.ErrNil, err)
+
+	n, err := redis.Int(conn.Do("EXPIRE", "foo", 100))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	ttl, err := redis.Int(conn.Do("TTL", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, 100, ttl)
+
+	n, err = redis.Int(conn.Do("EXISTS", "foo", "missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = redis.Int(conn.Do("DEL", "foo", "missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = redis.String(conn.Do("GET", "foo"))
+	assert.Equal(t, redis.ErrNil, err)
+}
+
+func TestServer_Keys(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	_, err := conn.Do("SET", "str", "val")
+	assert.NoError(t, err)
+	_, err = conn.Do("SADD", "set", "a", "b")
+	assert.NoError(t, err)
+
+	typ, err := redis.String(conn.Do("TYPE", "set"))
+	assert.NoError(t, err)
+	assert.Equal(t, "set", typ)
+
+	typ, err = redis.String(conn.Do("TYPE", "missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, "none", typ)
+
+	n, err := redis.Int(conn.Do("DBSIZE"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = redis.Int(conn.Do("RENAMENX", "set", "str"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	res, err := redis.String(conn.Do("RENAME", "set", "str"))
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", res)
+
+	typ, err = redis.String(conn.Do("TYPE", "str"))
+	assert.NoError(t, err)
+	assert.Equal(t, "set", typ)
+
+	_, err = conn.Do("RENAME", "set", "other")
+	assert.EqualError(t, err, "ERR no such key")
+
+	n, err = redis.Int(conn.Do("DEL", "str"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = conn.Do("SET", "str", "val")
+	assert.NoError(t, err)
+	res, err = redis.String(conn.Do("FLUSHALL"))
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", res)
+
+	n, err = redis.Int(conn.Do("EXISTS", "str", "set"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestServer_Scan(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := conn.Do("SET", key, "val")
+		assert.NoError(t, err)
+	}
+	_, err := conn.Do("ZADD", "zset", 1, "member")
+	assert.NoError(t, err)
+
+	var keys []string
+	cursor := "0"
+	for {
+		res, err := redis.Values(conn.Do("SCAN", cursor, "COUNT", 2, "TYPE", "string"))
+		assert.NoError(t, err)
+		cursor, _ = redis.String(res[0], nil)
+		page, _ := redis.Strings(res[1], nil)
+		keys = append(keys, page...)
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, keys)
+
+	res, err := redis.Values(conn.Do("ZSCAN", "zset", 0, "MATCH", "mem*"))
+	assert.NoError(t, err)
+	vals, _ := redis.Strings(res[1], nil)
+	assert.Equal(t, []string{"member", "1"}, vals)
+
+	_, err = conn.Do("SCAN", "x")
+	assert.EqualError(t, err, "ERR invalid cursor")
+	_, err = conn.Do("SSCAN", "set", 0, "TYPE", "set")
+	assert.EqualError(t, err, "ERR syntax error")
+}
+
+func TestServer_WrongType(t *testing.T) {
+	_, conn, done := testServerWithConfig(t, &flashdb.Config{Path: tmpDir, NoSync: true, StrictTypes: true})
+	defer done()
+
+	_, err := conn.Do("LPUSH", "list", "a")
+	assert.NoError(t, err)
+
+	wrongType := "WRONGTYPE Operation against a key holding the wrong kind of value"
+	_, err = conn.Do("SET", "list", "val")
+	assert.EqualError(t, err, wrongType)
+	_, err = conn.Do("GET", "list")
+	assert.EqualError(t, err, wrongType)
+
+	_, err = conn.Do("SET", "str", "val")
+	assert.NoError(t, err)
+	for _, args := range [][]interface{}{
+		{"LRANGE", "str", 0, -1},
+		{"LPOP", "str"},
+		{"HGETALL", "list"},
+		{"HEXPIRE", "list", 100},
+		{"SMEMBERS", "list"},
+		{"SUNION", "missing", "list"},
+		{"ZRANGE", "list", 0, -1},
+		{"STRLEN", "list"},
+		{"BLPOP", "str", 0},
+	} {
+		_, err = conn.Do(args[0].(string), args[1:]...)
+		assert.EqualError(t, err, wrongType, "%v", args)
+	}
+}
+
+func TestServer_SetOptions(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	_, err := redis.String(conn.Do("SET", "foo", "1", "XX"))
+	assert.Equal(t, redis.ErrNil, err)
+
+	res, err := redis.String(conn.Do("SET", "foo", "1", "NX", "EX", 100))
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", res)
+
+	val, err := redis.String(conn.Do("SET", "foo", "2", "KEEPTTL", "GET"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", val)
+	ttl, err := redis.Int(conn.Do("TTL", "foo"))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0)
+
+	_, err = redis.String(conn.Do("SET", "bar", "1", "GET"))
+	assert.Equal(t, redis.ErrNil, err)
+
+	_, err = conn.Do("SET", "foo", "1", "NX", "XX")
+	assert.EqualError(t, err, "ERR "+ErrSyntax.Error())
+	_, err = conn.Do("SET", "foo", "1", "EX")
+	assert.EqualError(t, err, "ERR "+ErrSyntax.Error())
+}
+
+func TestServer_PExpire(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	_, err := conn.Do("SET", "foo", "bar", "PX", 5000)
+	assert.NoError(t, err)
+	pttl, err := redis.Int(conn.Do("PTTL", "foo"))
+	assert.NoError(t, err)
+	assert.True(t, pttl > 4000 && pttl <= 5000)
+
+	n, err := redis.Int(conn.Do("PEXPIREAT", "foo", time.Now().Add(time.Minute).UnixMilli()))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	ttl, err := redis.Int(conn.Do("TTL", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, 60, ttl)
+
+	conn.Do("HSET", "h", "a", "1")
+	n, err = redis.Int(conn.Do("HPEXPIRE", "h", 30))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = redis.Int(conn.Do("HPEXPIRE", "missing", 30))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	time.Sleep(40 * time.Millisecond)
+	n, err = redis.Int(conn.Do("HPTTL", "h"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestServer_Persist(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	_, err := conn.Do("SET", "foo", "bar", "EX", 100)
+	assert.NoError(t, err)
+	n, err := redis.Int(conn.Do("PERSIST", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = redis.Int(conn.Do("PERSIST", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = redis.Int(conn.Do("TTL", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	conn.Do("SADD", "s", "a")
+	conn.Do("SEXPIRE", "s", 100)
+	n, err = redis.Int(conn.Do("SPERSIST", "s"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestServer_StringCommands(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	_, err := conn.Do("MSET", "a", "1", "b", "2")
+	assert.NoError(t, err)
+	vals, err := redis.Values(conn.Do("MGET", "a", "x", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("1"), nil, []byte("2")}, vals)
+
+	n, err := redis.Int(conn.Do("SETNX", "a", "3"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = redis.Int(conn.Do("APPEND", "a", "23"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	val, err := redis.String(conn.Do("GETRANGE", "a", 1, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, "23", val)
+
+	val, err = redis.String(conn.Do("GETEX", "a", "EX", 100))
+	assert.NoError(t, err)
+	assert.Equal(t, "123", val)
+	n, err = redis.Int(conn.Do("TTL", "a"))
+	assert.NoError(t, err)
+	assert.True(t, n > 0)
+
+	val, err = redis.String(conn.Do("GETDEL", "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "123", val)
+	_, err = redis.String(conn.Do("GETSET", "a", "new"))
+	assert.Equal(t, redis.ErrNil, err)
+}
+
+func TestServer_Incr(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	n, err := redis.Int(conn.Do("INCRBY", "c", 5))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	n, err = redis.Int(conn.Do("DECR", "c"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	f, err := redis.String(conn.Do("INCRBYFLOAT", "c", "0.5"))
+	assert.NoError(t, err)
+	assert.Equal(t, "4.5", f)
+
+	_, err = conn.Do("INCR", "c")
+	assert.EqualError(t, err, "ERR value is not an integer or out of range")
+}
+
+func TestServer_Hash(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	n, err := redis.Int(conn.Do("HSET", "h", "a", "1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	conn.Do("HSET", "h", "b", "2")
+
+	val, err := redis.String(conn.Do("HGET", "h", "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", val)
+
+	all, err := redis.StringMap(conn.Do("HGETALL", "h"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, all)
+
+	n, err = redis.Int(conn.Do("HDEL", "h", "a", "c"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = redis.Int(conn.Do("HLEN", "h"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestServer_HashFieldTTL(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	conn.Do("HSET", "h", "a", "1")
+	conn.Do("HSET", "h", "b", "2")
+
+	res, err := redis.Ints(conn.Do("HEXPIRE", "h", 100, "FIELDS", 2, "a", "x"))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, -2}, res)
+
+	res, err = redis.Ints(conn.Do("HTTL", "h", "FIELDS", 2, "a", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{100, -1}, res)
+
+	res, err = redis.Ints(conn.Do("HPERSIST", "h", "FIELDS", 1, "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, res)
+
+	// the key form is unchanged
+	n, err := redis.Int(conn.Do("HEXPIRE", "h", 100))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = redis.Int(conn.Do("HTTL", "h"))
+	assert.NoError(t, err)
+	assert.Equal(t, 100, n)
+
+	_, err = conn.Do("HTTL", "h", "FIELDS", 2, "a")
+	assert.EqualError(t, err, "ERR "+ErrSyntax.Error())
+}
+
+func TestServer_Set(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	n, err := redis.Int(conn.Do("SADD", "s", "a", "b", "c"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	n, err = redis.Int(conn.Do("SISMEMBER", "s", "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = redis.Int(conn.Do("SREM", "s", "a", "x"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	members, err := redis.Strings(conn.Do("SMEMBERS", "s"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"b", "c"}, members)
+}
+
+func TestServer_ZSet(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	n, err := redis.Int(conn.Do("ZADD", "z", 1, "a", 2, "b", 3, "c"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	score, err := redis.Float64(conn.Do("ZSCORE", "z", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, score)
+
+	members, err := redis.Strings(conn.Do("ZRANGE", "z", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, members)
+
+	members, err = redis.Strings(conn.Do("ZREVRANGE", "z", 0, 0, "WITHSCORES"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "3"}, members)
+
+	rank, err := redis.Int(conn.Do("ZRANK", "z", "c"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rank)
+
+	_, err = redis.Int(conn.Do("ZRANK", "z", "missing"))
+	assert.Equal(t, redis.ErrNil, err)
+}
+
+func TestServer_List(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	n, err := redis.Int(conn.Do("RPUSH", "l", "a", "b", "c"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	n, err = redis.Int(conn.Do("LINSERT", "l", "BEFORE", "b", "x"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	val, err := redis.String(conn.Do("LPOP", "l"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", val)
+
+	vals, err := redis.Strings(conn.Do("LRANGE", "l", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x", "b", "c"}, vals)
+
+	_, err = redis.String(conn.Do("LINDEX", "l", 10))
+	assert.Equal(t, redis.ErrNil, err)
+}
+
+func TestServer_BlockingList(t *testing.T) {
+	s, conn, done := testServer(t)
+	defer done()
+
+	res, err := conn.Do("BLPOP", "q", "0.01")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	// a second client pushes while the first one blocks
+	pusher, err := redis.Dial("tcp", s.Addr().String())
+	assert.NoError(t, err)
+	defer pusher.Close()
+
+	type reply struct {
+		vals []string
+		err  error
+	}
+	popped := make(chan reply, 1)
+	go func() {
+		vals, err := redis.Strings(conn.Do("BLPOP", "other", "q", 0))
+		popped <- reply{vals, err}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = pusher.Do("RPUSH", "q", "job")
+	assert.NoError(t, err)
+	r := <-popped
+	assert.NoError(t, r.err)
+	assert.Equal(t, []string{"q", "job"}, r.vals)
+
+	_, err = conn.Do("RPUSH", "src", "a")
+	assert.NoError(t, err)
+	val, err := redis.String(conn.Do("BLMOVE", "src", "dst", "LEFT", "RIGHT", 1))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", val)
+
+	_, err = conn.Do("BRPOP", "q", -1)
+	assert.Error(t, err)
+}
+
+func TestServer_Errors(t *testing.T) {
+	_, conn, done := testServer(t)
+	defer done()
+
+	pong, err := redis.String(conn.Do("PING"))
+	assert.NoError(t, err)
+	assert.Equal(t, "PONG", pong)
+
+	_, err = conn.Do("NOSUCHCOMMAND")
+	assert.EqualError(t, err, "ERR unknown command 'nosuchcommand'")
+
+	_, err = conn.Do("GET")
+	assert.EqualError(t, err, "ERR wrong number of arguments for 'get' command")
+
+	_, err = conn.Do("EXPIRE", "foo", "bar")
+	assert.EqualError(t, err, "ERR "+ErrNotInteger.Error())
+}
+
+func TestServer_OutOfMemory(t *testing.T) {
+	_, conn, done := testServerWithConfig(t, &flashdb.Config{Path: tmpDir, NoSync: true, MaxMemory: 100})
+	defer done()
+
+	_, err := conn.Do("SET", "foo", "bar")
+	assert.NoError(t, err)
+
+	_, err = conn.Do("SET", "baz", "bar")
+	assert.EqualError(t, err, "OOM command not allowed when used memory > 'maxmemory'")
+
+	_, err = conn.Do("DEL", "foo")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "baz", "bar")
+	assert.NoError(t, err)
+}
+
+func TestServer_PubSub(t *testing.T) {
+	s, conn, done := testServer(t)
+	defer done()
+
+	sub, err := redis.Dial("tcp", s.Addr().String())
+	assert.NoError(t, err)
+	defer sub.Close()
+	psc := redis.PubSubConn{Conn: sub}
+
+	assert.NoError(t, psc.Subscribe("news"))
+	assert.Equal(t, redis.Subscription{Kind: "subscribe", Channel: "news", Count: 1}, psc.Receive())
+	assert.NoError(t, psc.PSubscribe("n*"))
+	assert.Equal(t, redis.Subscription{Kind: "psubscribe", Channel: "n*", Count: 2}, psc.Receive())
+
+	// only the pub/sub commands are allowed while subscribed
+	_, err = sub.Do("GET", "foo")
+	assert.Error(t, err)
+
+	n, err := redis.Int(conn.Do("PUBLISH", "news", "hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, redis.Message{Channel: "news", Data: []byte("hello")}, psc.Receive())
+	assert.Equal(t, redis.Message{Channel: "news", Pattern: "n*", Data: []byte("hello")}, psc.Receive())
+
+	// messages published from Go reach the connection
+	s.db.Publish("news", "from go")
+	assert.Equal(t, redis.Message{Channel: "news", Data: []byte("from go")}, psc.Receive())
+	assert.Equal(t, redis.Message{Channel: "news", Pattern: "n*", Data: []byte("from go")}, psc.Receive())
+
+	channels, err := redis.Strings(conn.Do("PUBSUB", "CHANNELS"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"news"}, channels)
+	numSub, err := redis.Values(conn.Do("PUBSUB", "NUMSUB", "news", "other"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("news"), int64(1), []byte("other"), int64(0)}, numSub)
+	numPat, err := redis.Int(conn.Do("PUBSUB", "NUMPAT"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numPat)
+
+	assert.NoError(t, psc.Ping("hi"))
+	assert.Equal(t, redis.Pong{Data: "hi"}, psc.Receive())
+
+	assert.NoError(t, psc.Unsubscribe())
+	assert.Equal(t, redis.Subscription{Kind: "unsubscribe", Channel: "news", Count: 1}, psc.Receive())
+	assert.NoError(t, psc.PUnsubscribe())
+	assert.Equal(t, redis.Subscription{Kind: "punsubscribe", Channel: "n*", Count: 0}, psc.Receive())
+
+	// out of pub/sub mode, the connection runs any command again
+	_, err = sub.Do("SET", "foo", "bar")
+	assert.NoError(t, err)
+	val, err := redis.String(sub.Do("GET", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", val)
+
+	// unsubscribing without subscriptions replies with a nil channel
+	res, err := redis.Values(conn.Do("UNSUBSCRIBE"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("unsubscribe"), nil, int64(0)}, res)
+}
@@ -0,0 +1,183 @@
+package flashdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+var (
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+)
+
+const (
+	snapshotFileName = "flashdb.snapshot"
+	snapshotMagic    = "FDBS"
+	snapshotVersion  = uint16(1)
+
+	// magic 4 bytes, version 2 bytes, log position 8 bytes, record count 8 bytes.
+	// 4 + 2 + 8 + 8 = 22
+	snapshotHeaderSize = 22
+)
+
+// Snapshot writes a point-in-time copy of every store and the TTL deadlines
+// to w. The database is locked for writes only while the stores are dumped
+// in memory.
+//
+//	the snapshot format:
+//	|---------------------------------------------------------------------------|
+//	| magic   | version | log position | count  | size   | record | ... | crc32  |
+//	|---------------------------------------------------------------------------|
+//	| [4]byte | uint16  | uint64       | uint64 | uint32 | []byte | ... | uint32 |
+//	|---------------------------------------------------------------------------|
+//
+// The log position is the number of records in the append-only log when the
+// snapshot was taken. Records after it are replayed on top of the snapshot.
+func (db *FlashDB) Snapshot(w io.Writer) error {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrDatabaseClosed
+	}
+	recs := make([]*record, 0, 1)
+	db.dump(func(r *record) {
+		recs = append(recs, r)
+	})
+	pos := atomic.LoadUint64(&db.logCount)
+	db.mu.RUnlock()
+
+	return writeSnapshot(w, pos, recs)
+}
+
+// SaveSnapshot writes a snapshot to the database directory. The snapshot is
+// loaded by New so that only the records appended after it are replayed.
+func (db *FlashDB) SaveSnapshot() error {
+	if !db.persist {
+		return ErrNotPersistent
+	}
+
+	path := filepath.Join(db.config.Path, snapshotFileName)
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+
+	err = db.Snapshot(f)
+	if err == nil && !db.config.NoSync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func writeSnapshot(w io.Writer, pos uint64, recs []*record) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	header := make([]byte, snapshotHeaderSize)
+	copy(header[0:4], snapshotMagic)
+	binary.BigEndian.PutUint16(header[4:6], snapshotVersion)
+	binary.BigEndian.PutUint64(header[6:14], pos)
+	binary.BigEndian.PutUint64(header[14:22], uint64(len(recs)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	size := make([]byte, 4)
+	for _, r := range recs {
+		data, err := r.encode()
+		if err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(size, uint32(len(data)))
+		if _, err := bw.Write(size); err != nil {
+			return err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc.Sum32())
+	_, err := w.Write(sum)
+	return err
+}
+
+// readSnapshot reads a snapshot written by Snapshot and returns the log
+// position it was taken at along with its records.
+func readSnapshot(r io.Reader) (pos uint64, recs []*record, err error) {
+	crc := crc32.NewIEEE()
+	br := bufio.NewReader(r)
+	tr := io.TeeReader(br, crc)
+
+	header := make([]byte, snapshotHeaderSize)
+	if _, err = io.ReadFull(tr, header); err != nil {
+		return 0, nil, ErrInvalidSnapshot
+	}
+	if string(header[0:4]) != snapshotMagic ||
+		binary.BigEndian.Uint16(header[4:6]) != snapshotVersion {
+		return 0, nil, ErrInvalidSnapshot
+	}
+	pos = binary.BigEndian.Uint64(header[6:14])
+	count := binary.BigEndian.Uint64(header[14:22])
+
+	size := make([]byte, 4)
+	for i := uint64(0); i < count; i++ {
+		if _, err = io.ReadFull(tr, size); err != nil {
+			return 0, nil, ErrInvalidSnapshot
+		}
+		data := make([]byte, binary.BigEndian.Uint32(size))
+		if _, err = io.ReadFull(tr, data); err != nil {
+			return 0, nil, ErrInvalidSnapshot
+		}
+		rec, err := decode(data)
+		if err != nil {
+			return 0, nil, ErrInvalidSnapshot
+		}
+		recs = append(recs, rec)
+	}
+
+	sum := make([]byte, 4)
+	if _, err = io.ReadFull(br, sum); err != nil {
+		return 0, nil, ErrInvalidSnapshot
+	}
+	if binary.BigEndian.Uint32(sum) != crc.Sum32() {
+		return 0, nil, ErrInvalidSnapshot
+	}
+
+	return pos, recs, nil
+}
+
+// loadSnapshot reads the snapshot from the database directory, if there is
+// one. A missing or unreadable snapshot is not an error since the log holds
+// every record anyway, so in that case a position of zero is returned.
+func (db *FlashDB) loadSnapshot() (pos uint64, recs []*record) {
+	f, err := os.Open(filepath.Join(db.config.Path, snapshotFileName))
+	if err != nil {
+		return 0, nil
+	}
+	defer f.Close()
+
+	pos, recs, err = readSnapshot(f)
+	if err != nil {
+		return 0, nil
+	}
+	return pos, recs
+}
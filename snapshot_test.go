@@ -0,0 +1,110 @@
+package flashdb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlashDB_Snapshot(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	makeLoadRecords(10, db)
+	db.Update(func(tx *Tx) error {
+		return tx.Expire("key_1", 100)
+	})
+
+	var buf bytes.Buffer
+	assert.NoError(t, db.Snapshot(&buf))
+
+	pos, recs, err := readSnapshot(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(41), pos)
+	// 4 records per key and the ttl
+	assert.Len(t, recs, 41)
+
+	// flip a byte in the middle of the snapshot
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	_, _, err = readSnapshot(bytes.NewReader(data))
+	assert.Equal(t, ErrInvalidSnapshot, err)
+}
+
+func TestFlashDB_SaveSnapshot(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	makeLoadRecords(10, db)
+	assert.NoError(t, db.SaveSnapshot())
+
+	// records after the snapshot are replayed from the log
+	db.Update(func(tx *Tx) error {
+		tx.Set("key_1", "changed")
+		tx.HDel("key_2", "member_2")
+		return tx.Set("after", "snapshot")
+	})
+	db.Close()
+
+	db2 := getTestDB()
+	defer db2.Close()
+	assert.Equal(t, uint64(43), db2.logCount)
+
+	db2.View(func(tx *Tx) error {
+		val, err := tx.Get("key_1")
+		assert.NoError(t, err)
+		assert.Equal(t, "changed", val)
+
+		val, err = tx.Get("after")
+		assert.NoError(t, err)
+		assert.Equal(t, "snapshot", val)
+
+		assert.False(t, tx.HExists("key_2", "member_2"))
+
+		for i := 3; i <= 10; i++ {
+			key := fmt.Sprintf("key_%d", i)
+			member := fmt.Sprintf("member_%d", i)
+			assert.Equal(t, fmt.Sprintf("value_%d", i), tx.HGet(key, member))
+			assert.True(t, tx.SIsMember(key, member))
+			ok, score := tx.ZScore(key, member)
+			assert.True(t, ok)
+			assert.Equal(t, 10.0, score)
+		}
+		return nil
+	})
+}
+
+func TestFlashDB_SnapshotAheadOfLog(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	db.Update(func(tx *Tx) error {
+		return tx.Set("foo", "bar")
+	})
+
+	// a snapshot from another log, further along than this one
+	f, err := os.Create(filepath.Join(tmpDir, snapshotFileName))
+	assert.NoError(t, err)
+	rec := newRecord([]byte("stale"), []byte("value"), StringRecord, StringSet)
+	assert.NoError(t, writeSnapshot(f, 100, []*record{rec}))
+	f.Close()
+	db.Close()
+
+	db2 := getTestDB()
+	defer db2.Close()
+
+	db2.View(func(tx *Tx) error {
+		_, err := tx.Get("stale")
+		assert.Equal(t, ErrInvalidKey, err)
+
+		val, err := tx.Get("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", val)
+		return nil
+	})
+}
@@ -10,17 +10,6 @@ import (
 	"github.com/arriqaaq/zset"
 )
 
-var (
-	_ store = &strStore{}
-	_ store = &setStore{}
-	_ store = &zsetStore{}
-	_ store = &hashStore{}
-)
-
-type store interface {
-	evict(cache *hash.Hash)
-}
-
 type strStore struct {
 	sync.RWMutex
 	*art.Tree
@@ -50,127 +39,229 @@ func (s *strStore) Keys() (keys []string) {
 	return
 }
 
-func (s *strStore) evict(cache *hash.Hash) {
-	s.Lock()
-	defer s.Unlock()
+// The stores of the data types other than String, and the index of the TTLs
+// of hash fields, are used through these interfaces, so that the overlay of a
+// transaction can layer its changes over those of the database.
+type (
+	hashStorage interface {
+		Keys() []string
+		HSet(key string, field string, value interface{}) int
+		HGet(key, field string) interface{}
+		HDel(key, field string) int
+		HExists(key, field string) bool
+		HLen(key string) int
+		HKeys(key string) []string
+		HClear(key string)
+		scan(key string, cursor, count int) ([]string, int)
+	}
 
-	keys := s.Keys()
-	expiredKeys := make([]string, 0, 1)
+	setStorage interface {
+		Keys() []string
+		SAdd(key string, member interface{}) int
+		SIsMember(key string, member interface{}) bool
+		SRandMember(key string, count int) []interface{}
+		SRem(key string, member interface{}) bool
+		SMove(src, dst string, member interface{}) bool
+		SCard(key string) int
+		SMembers(key string) []interface{}
+		SKeyExists(key string) bool
+		SClear(key string)
+		scan(key string, cursor, count int) ([]string, int)
+	}
 
-	for _, k := range keys {
-		ttl := cache.HGet(String, k)
-		if ttl == nil {
-			continue
-		}
-		if time.Now().Unix() > ttl.(int64) {
-			expiredKeys = append(expiredKeys, k)
-		}
+	zsetStorage interface {
+		Keys() []string
+		ZAdd(key string, score float64, member string, value interface{}) int
+		ZScore(key string, member string) (bool, float64)
+		ZCard(key string) int
+		ZRank(key, member string) int64
+		ZRevRank(key, member string) int64
+		ZRem(key, member string) bool
+		ZScoreRange(key string, min, max float64) []interface{}
+		ZRevScoreRange(key string, max, min float64) []interface{}
+		ZKeyExists(key string) bool
+		ZClear(key string)
+		ZRange(key string, start, stop int) []interface{}
+		ZRangeWithScores(key string, start, stop int) []interface{}
+		ZRevRange(key string, start, stop int) []interface{}
+		ZRevRangeWithScores(key string, start, stop int) []interface{}
+		ZGetByRank(key string, rank int) []interface{}
+		ZRevGetByRank(key string, rank int) []interface{}
+		scan(key string, cursor, count int) ([]string, int)
+	}
+
+	listStorage interface {
+		Keys() []string
+		LPush(key string, values ...string) int
+		RPush(key string, values ...string) int
+		LPop(key string) (string, bool)
+		RPop(key string) (string, bool)
+		LIndex(key string, index int) (string, bool)
+		LSet(key string, index int, value string) bool
+		LRange(key string, start, stop int) []string
+		LRem(key string, count int, value string) int
+		LTrim(key string, start, stop int)
+		LInsert(key string, pos InsertPosition, pivot, value string) int
+		LLen(key string) int
+		LKeyExists(key string) bool
+		LClear(key string)
 	}
 
-	for _, k := range expiredKeys {
-		s.Delete([]byte(k))
-		cache.HDel(String, k)
+	// fieldExpiry is the index of the TTLs of hash fields: the groups are the
+	// hash keys, and the keys their fields.
+	fieldExpiry interface {
+		HSet(group, key string, deadline int64)
+		HGet(group, key string) interface{}
+		HDel(group, key string)
+		HClear(group string)
+		HKeys(group string) []string
+		HLen(group string) int
+		expiredAll(end time.Time) []expiryEntry
 	}
+)
+
+// scanIndex holds the fields or members of each key of a store, so that
+// they can be scanned with a cursor.
+type scanIndex map[string]*keySet
+
+func (idx scanIndex) add(key, elem string) {
+	elems, ok := idx[key]
+	if !ok {
+		elems = newKeySet()
+		idx[key] = elems
+	}
+	elems.add(elem)
+}
+
+func (idx scanIndex) remove(key, elem string) {
+	elems, ok := idx[key]
+	if !ok {
+		return
+	}
+	elems.remove(elem)
+	if elems.len() == 0 {
+		delete(idx, key)
+	}
+}
+
+// scan returns up to count elements of key from cursor, as keySet.scan does.
+func (idx scanIndex) scan(key string, cursor, count int) ([]string, int) {
+	elems, ok := idx[key]
+	if !ok {
+		return nil, 0
+	}
+	return elems.scan(cursor, count)
 }
 
 type hashStore struct {
 	sync.RWMutex
 	*hash.Hash
+	fields scanIndex
 }
 
 func newHashStore() *hashStore {
-	n := &hashStore{}
+	n := &hashStore{fields: make(scanIndex)}
 	n.Hash = hash.New()
 	return n
 }
 
-func (h *hashStore) evict(cache *hash.Hash) {
-	h.Lock()
-	defer h.Unlock()
+func (s *hashStore) HSet(key string, field string, value interface{}) int {
+	s.fields.add(key, field)
+	return s.Hash.HSet(key, field, value)
+}
 
-	keys := h.Keys()
-	expiredKeys := make([]string, 0, 1)
+func (s *hashStore) HDel(key, field string) int {
+	s.fields.remove(key, field)
+	return s.Hash.HDel(key, field)
+}
 
-	for _, k := range keys {
-		ttl := cache.HGet(Hash, k)
-		if ttl == nil {
-			continue
-		}
-		if time.Now().Unix() > ttl.(int64) {
-			expiredKeys = append(expiredKeys, k)
-		}
-	}
+func (s *hashStore) HClear(key string) {
+	delete(s.fields, key)
+	s.Hash.HClear(key)
+}
 
-	for _, k := range expiredKeys {
-		h.HClear(k)
-		cache.HDel(Hash, k)
-	}
+func (s *hashStore) scan(key string, cursor, count int) ([]string, int) {
+	return s.fields.scan(key, cursor, count)
 }
 
 type setStore struct {
 	sync.RWMutex
 	*set.Set
+	members scanIndex
 }
 
 func newSetStore() *setStore {
-	n := &setStore{}
+	n := &setStore{members: make(scanIndex)}
 	n.Set = set.New()
 	return n
 }
 
-func (s *setStore) evict(cache *hash.Hash) {
-	s.Lock()
-	defer s.Unlock()
+func (s *setStore) SAdd(key string, member interface{}) int {
+	s.members.add(key, member.(string))
+	return s.Set.SAdd(key, member)
+}
 
-	keys := s.Keys()
-	expiredKeys := make([]string, 0, 1)
+func (s *setStore) SRem(key string, member interface{}) bool {
+	s.members.remove(key, member.(string))
+	return s.Set.SRem(key, member)
+}
 
-	for _, k := range keys {
-		ttl := cache.HGet(Set, k)
-		if ttl == nil {
-			continue
-		}
-		if time.Now().Unix() > ttl.(int64) {
-			expiredKeys = append(expiredKeys, k)
-		}
+func (s *setStore) SMove(src, dst string, member interface{}) bool {
+	if !s.Set.SMove(src, dst, member) {
+		return false
 	}
+	s.members.remove(src, member.(string))
+	s.members.add(dst, member.(string))
+	return true
+}
 
-	for _, k := range expiredKeys {
-		s.SClear(k)
-		cache.HDel(Set, k)
-	}
+func (s *setStore) SClear(key string) {
+	delete(s.members, key)
+	s.Set.SClear(key)
+}
+
+func (s *setStore) scan(key string, cursor, count int) ([]string, int) {
+	return s.members.scan(key, cursor, count)
 }
 
 type zsetStore struct {
 	sync.RWMutex
 	*zset.ZSet
+	members scanIndex
 }
 
 func newZSetStore() *zsetStore {
-	n := &zsetStore{}
+	n := &zsetStore{members: make(scanIndex)}
 	n.ZSet = zset.New()
 	return n
 }
 
-func (z *zsetStore) evict(cache *hash.Hash) {
-	z.Lock()
-	defer z.Unlock()
+func (s *zsetStore) ZAdd(key string, score float64, member string, value interface{}) int {
+	s.members.add(key, member)
+	return s.ZSet.ZAdd(key, score, member, value)
+}
+
+func (s *zsetStore) ZRem(key, member string) bool {
+	s.members.remove(key, member)
+	return s.ZSet.ZRem(key, member)
+}
 
-	keys := z.Keys()
-	expiredKeys := make([]string, 0, 1)
+func (s *zsetStore) ZClear(key string) {
+	delete(s.members, key)
+	s.ZSet.ZClear(key)
+}
 
-	for _, k := range keys {
-		ttl := cache.HGet(ZSet, k)
-		if ttl == nil {
-			continue
-		}
-		if time.Now().Unix() > ttl.(int64) {
-			expiredKeys = append(expiredKeys, k)
-		}
-	}
+func (s *zsetStore) scan(key string, cursor, count int) ([]string, int) {
+	return s.members.scan(key, cursor, count)
+}
 
-	for _, k := range expiredKeys {
-		z.ZClear(k)
-		cache.HDel(ZSet, k)
-	}
+type listStore struct {
+	sync.RWMutex
+	*lists
+}
+
+func newListStore() *listStore {
+	n := &listStore{}
+	n.lists = newLists()
+	return n
 }
@@ -4,42 +4,45 @@ import (
 	"time"
 )
 
-// HSet sets field in the hash stored at key to value.
+// HSet sets field in the hash stored at key to value. Any TTL of the field is
+// removed.
 func (tx *Tx) HSet(key string, field string, value string) (res int, err error) {
+	if tx.wrongType(Hash, key) {
+		return 0, ErrWrongType
+	}
 	existVal := tx.HGet(key, field)
-	if existVal == value {
+	if existVal == value && tx.source(Hash, key).fieldExps.HGet(key, field) == nil {
 		return
 	}
 
 	e := newRecordWithValue([]byte(key), []byte(field), []byte(value), HashRecord, HashHSet)
-	tx.addRecord(e)
+	err = tx.addRecord(e)
 	return
 }
 
 // HGet returns the value associated with field in the hash stored at key. If
-// the key has expired, the key is evicted and empty string is returned.
+// the key has expired, the key is evicted and empty string is returned. Expired
+// fields are evicted by every read of the hash.
 func (tx *Tx) HGet(key string, field string) string {
-	if tx.db.hasExpired(key, Hash) {
-		tx.db.evict(key, Hash)
+	db := tx.hash(key)
+	if db == nil || db.fieldExpired(key, field) {
 		return ""
 	}
 
-	return toString(tx.db.hashStore.HGet(key, field))
+	return toString(db.hashStore.HGet(key, field))
 }
 
 // HGetAll returns all fields and values stored at key. If the key has expired,
 // the key is evicted.
 func (tx *Tx) HGetAll(key string) []string {
-	if tx.db.hasExpired(key, Hash) {
-		tx.db.evict(key, Hash)
+	db := tx.hash(key)
+	if db == nil {
 		return nil
 	}
 
-	vals := tx.db.hashStore.HGetAll(key)
 	values := make([]string, 0, 1)
-
-	for _, v := range vals {
-		values = append(values, toString(v))
+	for _, field := range db.hashFields(key) {
+		values = append(values, field, toString(db.hashStore.HGet(key, field)))
 	}
 
 	return values
@@ -47,9 +50,14 @@ func (tx *Tx) HGetAll(key string) []string {
 
 // HDel deletes the fields stored at key.
 func (tx *Tx) HDel(key string, fields ...string) (res int, err error) {
+	if tx.wrongType(Hash, key) {
+		return 0, ErrWrongType
+	}
 	for _, f := range fields {
 		e := newRecord([]byte(key), []byte(f), HashRecord, HashHDel)
-		tx.addRecord(e)
+		if err = tx.addRecord(e); err != nil {
+			return
+		}
 		res++
 	}
 	return
@@ -58,103 +66,199 @@ func (tx *Tx) HDel(key string, fields ...string) (res int, err error) {
 // HKeyExists determines whether the key is exists. If the key has expired, the
 // key is evicted.
 func (tx *Tx) HKeyExists(key string) (ok bool) {
-	if tx.db.hasExpired(key, Hash) {
-		tx.db.evict(key, Hash)
-		return
-	}
-	return tx.db.hashStore.HKeyExists(key)
+	return tx.HLen(key) > 0
 }
 
 // HExists determines whether the key and field are exists. If the key has
 // expired, the key is evicted.
 func (tx *Tx) HExists(key, field string) (ok bool) {
-	if tx.db.hasExpired(key, Hash) {
-		tx.db.evict(key, Hash)
+	db := tx.hash(key)
+	if db == nil || db.fieldExpired(key, field) {
 		return
 	}
 
-	return tx.db.hashStore.HExists(key, field)
+	return db.hashStore.HExists(key, field)
 }
 
 // HLen returns number of the fields stored at key. If the key has expired, the
 // key is evicted.
 func (tx *Tx) HLen(key string) int {
-	if tx.db.hasExpired(key, Hash) {
-		tx.db.evict(key, Hash)
+	db := tx.hash(key)
+	if db == nil {
 		return 0
 	}
 
-	return tx.db.hashStore.HLen(key)
+	n := db.hashStore.HLen(key)
+	for _, field := range db.fieldExps.HKeys(key) {
+		if db.fieldExpired(key, field) && db.hashStore.HExists(key, field) {
+			n--
+		}
+	}
+	return n
 }
 
 // HKeys returns all fields stored at key. If the key has expired, the key is evicted.
 func (tx *Tx) HKeys(key string) (val []string) {
-	if tx.db.hasExpired(key, Hash) {
-		tx.db.evict(key, Hash)
+	db := tx.hash(key)
+	if db == nil {
 		return nil
 	}
 
-	return tx.db.hashStore.HKeys(key)
+	return db.hashFields(key)
 }
 
 // HVals returns all values stored at key. If the key has expired, the key
 // is evicted.
 func (tx *Tx) HVals(key string) (values []string) {
-	if tx.db.hasExpired(key, Hash) {
-		tx.db.evict(key, Hash)
+	db := tx.hash(key)
+	if db == nil {
 		return nil
 	}
 
-	vals := tx.db.hashStore.HVals(key)
-	for _, v := range vals {
-		values = append(values, toString(v))
+	for _, field := range db.hashFields(key) {
+		values = append(values, toString(db.hashStore.HGet(key, field)))
 	}
-
 	return
 }
 
+// hash returns the database to read the hash stored at key from, or nil if the
+// key has expired. Expired fields are evicted by a read/write transaction, and
+// skipped by the reads otherwise.
+func (tx *Tx) hash(key string) *FlashDB {
+	if tx.lookup(Hash, key).hasExpired(key, Hash) {
+		tx.evict(key, Hash)
+		return nil
+	}
+	tx.evictFields(key)
+	return tx.source(Hash, key)
+}
+
+// hashFields returns the fields of the hash stored at key that have not
+// expired.
+func (db *FlashDB) hashFields(key string) []string {
+	fields := db.hashStore.HKeys(key)
+	if len(db.fieldExps.HKeys(key)) == 0 {
+		return fields
+	}
+
+	live := fields[:0]
+	for _, field := range fields {
+		if !db.fieldExpired(key, field) {
+			live = append(live, field)
+		}
+	}
+	return live
+}
+
+// hashExists reports whether the hash stored at key has a field that has not
+// expired. Unless every field has a TTL, it does not go through the fields.
+func (db *FlashDB) hashExists(key string) bool {
+	n := db.hashStore.HLen(key)
+	if n == 0 {
+		return false
+	}
+	if db.fieldExps.HLen(key) < n {
+		return true
+	}
+	for _, field := range db.hashStore.HKeys(key) {
+		if !db.fieldExpired(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
 // HExpire adds an expiry time for key. If the duration is not positive, expiry
 // time is not set.
 func (tx *Tx) HExpire(key string, duration int64) (err error) {
-	if duration <= 0 {
-		return ErrInvalidTTL
+	deadline, err := deadlineIn(duration, time.Second)
+	if err != nil {
+		return
+	}
+	return tx.HPExpireAt(key, deadline)
+}
+
+// HPExpire is like HExpire, but duration is in milliseconds.
+func (tx *Tx) HPExpire(key string, duration int64) (err error) {
+	deadline, err := deadlineIn(duration, time.Millisecond)
+	if err != nil {
+		return
 	}
+	return tx.HPExpireAt(key, deadline)
+}
 
+// HExpireAt sets the deadline of the key in hash to the Unix time t, in
+// seconds. A deadline in the past expires the key.
+func (tx *Tx) HExpireAt(key string, t int64) (err error) {
+	deadline, err := deadlineAt(t, time.Second)
+	if err != nil {
+		return
+	}
+	return tx.HPExpireAt(key, deadline)
+}
+
+// HPExpireAt is like HExpireAt, but t is in milliseconds.
+func (tx *Tx) HPExpireAt(key string, t int64) (err error) {
+	if _, err = deadlineAt(t, time.Millisecond); err != nil {
+		return
+	}
+	if tx.wrongType(Hash, key) {
+		return ErrWrongType
+	}
 	if !tx.HKeyExists(key) {
 		return ErrInvalidKey
 	}
 
-	ttl := time.Now().Unix() + duration
-	e := newRecordWithExpire([]byte(key), nil, ttl, HashRecord, HashHExpire)
-	tx.addRecord(e)
-
-	return
+	e := newRecordWithExpire([]byte(key), nil, t, HashRecord, HashHExpire)
+	return tx.addRecord(e)
 }
 
 // HTTL returns remaining time for deadline. If the key has expired, the key is evicted.
 func (tx *Tx) HTTL(key string) (ttl int64) {
-	if tx.db.hasExpired(key, Hash) {
-		tx.db.evict(key, Hash)
+	return ttlSeconds(tx.HPTTL(key))
+}
+
+// HPTTL returns the time to live of the key in hash in milliseconds.
+func (tx *Tx) HPTTL(key string) (ttl int64) {
+	db := tx.source(Hash, key)
+	if db.hasExpired(key, Hash) {
+		tx.evict(key, Hash)
 		return
 	}
 
-	deadline := tx.db.getTTL(Hash, key)
-	if deadline == nil {
-		return
+	return db.pttl(Hash, key)
+}
+
+// HPersist removes the TTL of the key in hash. It returns false if the key
+// does not exist or has no TTL.
+func (tx *Tx) HPersist(key string) (bool, error) {
+	if tx.wrongType(Hash, key) {
+		return false, ErrWrongType
+	}
+	if !tx.HKeyExists(key) || tx.source(Hash, key).getTTL(Hash, key) == nil {
+		return false, nil
+	}
+
+	e := newRecord([]byte(key), nil, HashRecord, HashHPersist)
+	if err := tx.addRecord(e); err != nil {
+		return false, err
 	}
-	return deadline.(int64) - time.Now().Unix()
+	return true, nil
 }
 
 // HClear clears the key. If the key has expired, the key is evicted.
 func (tx *Tx) HClear(key string) (err error) {
-	if tx.db.hasExpired(key, Hash) {
-		tx.db.evict(key, Hash)
+	if tx.wrongType(Hash, key) {
+		return ErrWrongType
+	}
+	db := tx.source(Hash, key)
+	if db.hasExpired(key, Hash) {
+		tx.evict(key, Hash)
 		return
 	}
 
 	e := newRecord([]byte(key), nil, HashRecord, HashHClear)
-	tx.addRecord(e)
-	return
+	return tx.addRecord(e)
 }
 
 func toString(val interface{}) string {
@@ -163,3 +267,132 @@ func toString(val interface{}) string {
 	}
 	return val.(string)
 }
+
+// Results of the per-field TTL methods of hashes, as replied by Redis.
+const (
+	HFieldMissing = -2 // the field does not exist
+	HFieldNoTTL   = -1 // the field has no TTL
+	HFieldUpdated = 1  // the TTL of the field was set or removed
+	HFieldDeleted = 2  // the deadline has passed, so the field was deleted
+)
+
+// HExpireFields sets the TTL of the fields of the hash stored at key to
+// duration seconds. It returns HFieldUpdated for each field, or HFieldMissing
+// if the field does not exist.
+func (tx *Tx) HExpireFields(key string, duration int64, fields ...string) ([]int, error) {
+	deadline, err := deadlineIn(duration, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return tx.HPExpireAtFields(key, deadline, fields...)
+}
+
+// HPExpireFields is like HExpireFields, but duration is in milliseconds.
+func (tx *Tx) HPExpireFields(key string, duration int64, fields ...string) ([]int, error) {
+	deadline, err := deadlineIn(duration, time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	return tx.HPExpireAtFields(key, deadline, fields...)
+}
+
+// HExpireAtFields sets the deadline of the fields of the hash stored at key to
+// the Unix time t, in seconds. Fields whose deadline has passed are deleted,
+// and HFieldDeleted is returned for them.
+func (tx *Tx) HExpireAtFields(key string, t int64, fields ...string) ([]int, error) {
+	deadline, err := deadlineAt(t, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return tx.HPExpireAtFields(key, deadline, fields...)
+}
+
+// HPExpireAtFields is like HExpireAtFields, but t is in milliseconds.
+func (tx *Tx) HPExpireAtFields(key string, t int64, fields ...string) ([]int, error) {
+	if _, err := deadlineAt(t, time.Millisecond); err != nil {
+		return nil, err
+	}
+	if tx.wrongType(Hash, key) {
+		return nil, ErrWrongType
+	}
+
+	res := make([]int, 0, len(fields))
+	for _, field := range fields {
+		if !tx.HExists(key, field) {
+			res = append(res, HFieldMissing)
+			continue
+		}
+
+		var e *record
+		if t <= nowMs() {
+			e = newRecord([]byte(key), []byte(field), HashRecord, HashHDel)
+			res = append(res, HFieldDeleted)
+		} else {
+			e = newRecordWithExpire([]byte(key), []byte(field), t, HashRecord, HashHFieldExpire)
+			res = append(res, HFieldUpdated)
+		}
+		if err := tx.addRecord(e); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// HTTLFields returns the TTL in seconds of the fields of the hash stored at
+// key, HFieldNoTTL for a field without TTL, or HFieldMissing for a field that
+// does not exist.
+func (tx *Tx) HTTLFields(key string, fields ...string) []int64 {
+	res := tx.HPTTLFields(key, fields...)
+	for i, ttl := range res {
+		if ttl > 0 {
+			res[i] = ttlSeconds(ttl)
+		}
+	}
+	return res
+}
+
+// HPTTLFields is like HTTLFields, but the TTLs are in milliseconds.
+func (tx *Tx) HPTTLFields(key string, fields ...string) []int64 {
+	res := make([]int64, 0, len(fields))
+	for _, field := range fields {
+		if !tx.HExists(key, field) {
+			res = append(res, HFieldMissing)
+			continue
+		}
+
+		deadline := tx.source(Hash, key).fieldExps.HGet(key, field)
+		if deadline == nil {
+			res = append(res, HFieldNoTTL)
+			continue
+		}
+		res = append(res, deadline.(int64)-nowMs())
+	}
+	return res
+}
+
+// HPersistFields removes the TTL of the fields of the hash stored at key. It
+// returns HFieldUpdated for each field whose TTL was removed, HFieldNoTTL for
+// a field without TTL, or HFieldMissing for a field that does not exist.
+func (tx *Tx) HPersistFields(key string, fields ...string) ([]int, error) {
+	if tx.wrongType(Hash, key) {
+		return nil, ErrWrongType
+	}
+	res := make([]int, 0, len(fields))
+	for _, field := range fields {
+		if !tx.HExists(key, field) {
+			res = append(res, HFieldMissing)
+			continue
+		}
+		if tx.source(Hash, key).fieldExps.HGet(key, field) == nil {
+			res = append(res, HFieldNoTTL)
+			continue
+		}
+
+		e := newRecord([]byte(key), []byte(field), HashRecord, HashHFieldPersist)
+		if err := tx.addRecord(e); err != nil {
+			return nil, err
+		}
+		res = append(res, HFieldUpdated)
+	}
+	return res, nil
+}
@@ -3,6 +3,7 @@ package flashdb
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -149,3 +150,107 @@ func TestFlashDB_HLen(t *testing.T) {
 		return nil
 	})
 }
+
+func TestFlashDB_HashFieldTTL(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		for _, f := range []string{"a", "b", "c", "d"} {
+			_, err := tx.HSet(testKey, f, "1")
+			assert.NoError(t, err)
+		}
+
+		res, err := tx.HPExpireFields(testKey, 50, "a", "missing")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{HFieldUpdated, HFieldMissing}, res)
+		res, err = tx.HExpireFields(testKey, 100, "b", "c")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{HFieldUpdated, HFieldUpdated}, res)
+		res, err = tx.HExpireAtFields(testKey, time.Now().Unix()-1, "d")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{HFieldDeleted}, res)
+		_, err = tx.HExpireFields(testKey, 0, "b")
+		assert.Equal(t, ErrInvalidTTL, err)
+
+		// the TTL of the whole key is untouched
+		assert.Equal(t, int64(0), tx.HTTL(testKey))
+		assert.False(t, tx.HExists(testKey, "d"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		ttls := tx.HTTLFields(testKey, "b", "d")
+		assert.Equal(t, []int64{100, HFieldMissing}, ttls)
+
+		res, err := tx.HPersistFields(testKey, "b", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{HFieldUpdated, HFieldNoTTL}, res)
+
+		// setting a field clears its TTL, even to the same value
+		_, err = tx.HSet(testKey, "c", "1")
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{HFieldNoTTL}, tx.HPTTLFields(testKey, "c"))
+		_, err = tx.HExpireFields(testKey, 100, "c")
+		return err
+	})
+	assert.NoError(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	err = db.View(func(tx *Tx) error {
+		assert.ElementsMatch(t, []string{"b", "c"}, tx.HKeys(testKey))
+		assert.Equal(t, 2, tx.HLen(testKey))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// the field TTLs and the evicted fields are replayed
+	assert.NoError(t, db.Close())
+	db = getTestDB()
+	err = db.View(func(tx *Tx) error {
+		assert.ElementsMatch(t, []string{"b", "c"}, tx.HKeys(testKey))
+		assert.Equal(t, []int64{HFieldNoTTL, 100}, tx.HTTLFields(testKey, "b", "c"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// and survive a rewrite
+	assert.NoError(t, db.Rewrite())
+	assert.NoError(t, db.Close())
+	db = getTestDB()
+	defer db.Close()
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, []int64{HFieldNoTTL, 100}, tx.HTTLFields(testKey, "b", "c"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_HashFieldSweep(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.HSet(testKey, "a", "1")
+		assert.NoError(t, err)
+		_, err = tx.HSet(testKey, "b", "1")
+		assert.NoError(t, err)
+		_, err = tx.HPExpireFields(testKey, 10, "a")
+		return err
+	})
+	assert.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	n, err := db.EvictExpired()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"b"}, db.hashStore.HKeys(testKey))
+	assert.Nil(t, db.fieldExps.HGet(testKey, "a"))
+
+	// the sweeper logged the deletion
+	assert.NoError(t, db.Close())
+	db = getTestDB()
+	defer db.Close()
+	assert.Equal(t, []string{"b"}, db.hashStore.HKeys(testKey))
+}
@@ -0,0 +1,210 @@
+package flashdb
+
+// The commands in this file work on keys whatever their data type. Unless
+// Config enforces one data type per key, a key name can hold a value of each
+// data type at once, and these commands act on all of them.
+
+// Type returns the data type of the value stored at key, or an empty string if
+// the key does not exist. If the key holds values of several data types, the
+// first of String, Hash, Set, ZSet and List is returned.
+func (tx *Tx) Type(key string) DataType {
+	if types := tx.types(key); len(types) > 0 {
+		return types[0]
+	}
+	return ""
+}
+
+// ExistsAny returns how many of the keys exist, whatever their data type. A
+// key given several times is counted as many times.
+func (tx *Tx) ExistsAny(keys ...string) (n int) {
+	for _, key := range keys {
+		if len(tx.types(key)) > 0 {
+			n++
+		}
+	}
+	return
+}
+
+// Del deletes the keys, whatever their data type, along with their TTLs. It
+// returns the number of keys deleted.
+func (tx *Tx) Del(keys ...string) (n int, err error) {
+	deleted := make(map[string]bool)
+	for _, key := range keys {
+		if deleted[key] {
+			continue
+		}
+		recs := tx.delRecords(key)
+		if len(recs) == 0 {
+			continue
+		}
+		if err = tx.addRecord(recs...); err != nil {
+			return
+		}
+		deleted[key] = true
+		n++
+	}
+	return
+}
+
+// Rename renames the key src to dst, along with its TTLs. If dst already
+// exists, it is deleted first, whatever its data type. It returns ErrInvalidKey
+// if src does not exist.
+func (tx *Tx) Rename(src, dst string) error {
+	types := tx.types(src)
+	if len(types) == 0 {
+		return ErrInvalidKey
+	}
+	if src == dst {
+		return nil
+	}
+
+	recs := tx.delRecords(dst)
+	for _, dType := range types {
+		tx.source(dType, src).dumpKey(dType, src, dst, func(r *record) {
+			recs = append(recs, r)
+		})
+		recs = append(recs, evictRecord(dType, src, removedByCaller))
+	}
+	return tx.addRecord(recs...)
+}
+
+// RenameNX renames the key src to dst if dst does not exist. It returns false
+// if dst exists, and ErrInvalidKey if src does not.
+func (tx *Tx) RenameNX(src, dst string) (bool, error) {
+	if len(tx.types(src)) == 0 {
+		return false, ErrInvalidKey
+	}
+	if len(tx.types(dst)) > 0 {
+		return false, nil
+	}
+	if err := tx.Rename(src, dst); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DBSize returns the number of keys in the database. A key name holding values
+// of several data types is counted once.
+func (tx *Tx) DBSize() int {
+	names := make(map[string]bool)
+	for _, dType := range dataTypes {
+		for _, key := range tx.keys(dType) {
+			names[key] = true
+		}
+	}
+	return len(names)
+}
+
+// FlushAll deletes every key of the database. A removal record is written for
+// each key; Rewrite compacts them away.
+func (tx *Tx) FlushAll() error {
+	for _, dType := range dataTypes {
+		keys := tx.db.storeKeys(dType)
+		if tx.wc.overlay != nil {
+			keys = append(keys, tx.wc.overlay.db.storeKeys(dType)...)
+		}
+
+		seen := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if err := tx.addRecord(evictRecord(dType, key, removedByCaller)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// types returns the data types of the values stored at key. Expired values are
+// evicted as by the other reads.
+func (tx *Tx) types(key string) (types []DataType) {
+	for _, dType := range dataTypes {
+		db := tx.source(dType, key)
+		if db.hasExpired(key, dType) {
+			tx.evict(key, dType)
+			continue
+		}
+		if db.keyExists(dType, key) {
+			types = append(types, dType)
+		}
+	}
+	return
+}
+
+// delRecords returns the records deleting the values of every data type
+// stored at key.
+func (tx *Tx) delRecords(key string) (recs []*record) {
+	for _, dType := range tx.types(key) {
+		recs = append(recs, evictRecord(dType, key, removedByCaller))
+	}
+	return
+}
+
+// keys returns the keys of type dType that exist, as seen by the transaction.
+// Unlike the other reads, it does not count as an access to the keys for the
+// eviction policies.
+func (tx *Tx) keys(dType DataType) (keys []string) {
+	var o *overlay
+	if tx.wc != nil {
+		o = tx.wc.overlay
+	}
+
+	for _, key := range tx.db.storeKeys(dType) {
+		if o != nil && o.touched[overlayKey{dType, key}] {
+			continue
+		}
+		if tx.db.keyExists(dType, key) {
+			keys = append(keys, key)
+		}
+	}
+	if o != nil {
+		for k := range o.touched {
+			if k.dType == dType && o.db.keyExists(dType, k.key) {
+				keys = append(keys, k.key)
+			}
+		}
+	}
+	return
+}
+
+// storeKeys returns the keys in the store of the data type, including the
+// expired ones.
+func (db *FlashDB) storeKeys(dType DataType) []string {
+	switch dType {
+	case String:
+		return db.strStore.Keys()
+	case Hash:
+		return db.hashStore.Keys()
+	case Set:
+		return db.setStore.Keys()
+	case ZSet:
+		return db.zsetStore.Keys()
+	case List:
+		return db.listStore.Keys()
+	}
+	return nil
+}
+
+// keyExists reports whether a value of type dType that has not expired is
+// stored at key.
+func (db *FlashDB) keyExists(dType DataType, key string) bool {
+	if db.hasExpired(key, dType) {
+		return false
+	}
+	switch dType {
+	case String:
+		return db.strStore.Search([]byte(key)) != nil
+	case Hash:
+		return db.hashExists(key)
+	case Set:
+		return db.setStore.SCard(key) > 0
+	case ZSet:
+		return db.zsetStore.ZCard(key) > 0
+	case List:
+		return db.listStore.LLen(key) > 0
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package flashdb
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlashDB_TypeExistsDel(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("str", "val"))
+		_, err := tx.HSet("hash", "field", "val")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.SAdd("both", "member"))
+		_, err = tx.RPush("both", "elem")
+		return err
+	})
+	assert.NoError(t, err)
+
+	db.View(func(tx *Tx) error {
+		assert.Equal(t, String, tx.Type("str"))
+		assert.Equal(t, Hash, tx.Type("hash"))
+		assert.Equal(t, Set, tx.Type("both"))
+		assert.Equal(t, DataType(""), tx.Type("missing"))
+		assert.Equal(t, 4, tx.ExistsAny("str", "hash", "both", "missing", "str"))
+		assert.Equal(t, 3, tx.DBSize())
+		return nil
+	})
+
+	err = db.Update(func(tx *Tx) error {
+		n, err := tx.Del("hash", "both", "both", "missing")
+		assert.Equal(t, 2, n)
+		assert.Equal(t, 1, tx.DBSize())
+		return err
+	})
+	assert.NoError(t, err)
+
+	db.View(func(tx *Tx) error {
+		assert.Equal(t, 1, tx.ExistsAny("str", "hash", "both"))
+		assert.Equal(t, 0, tx.LLen("both"))
+		return nil
+	})
+}
+
+func TestFlashDB_ExpiredKeys(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("str", "val"))
+		assert.NoError(t, tx.PExpire("str", 10))
+		return tx.Set("other", "val")
+	})
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	db.View(func(tx *Tx) error {
+		assert.Equal(t, DataType(""), tx.Type("str"))
+		assert.Equal(t, 1, tx.DBSize())
+		return nil
+	})
+	err = db.Update(func(tx *Tx) error {
+		n, err := tx.Del("str")
+		assert.Equal(t, 0, n)
+		return err
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_Rename(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.SAdd("src", "a", "b"))
+		assert.NoError(t, tx.SExpire("src", 100))
+		_, err := tx.HSet("src", "field", "val")
+		assert.NoError(t, err)
+		return tx.Set("dst", "old")
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		ok, err := tx.RenameNX("src", "dst")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.NoError(t, tx.Rename("src", "dst"))
+		// the renamed key is visible within the transaction
+		assert.Equal(t, 0, tx.ExistsAny("src"))
+		assert.Equal(t, 2, tx.SCard("dst"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		return tx.Rename("missing", "dst")
+	})
+	assert.Equal(t, ErrInvalidKey, err)
+
+	check := func(tx *Tx) error {
+		assert.Equal(t, 0, tx.ExistsAny("src"))
+		assert.ElementsMatch(t, []string{"a", "b"}, tx.SMembers("dst"))
+		assert.Equal(t, "val", tx.HGet("dst", "field"))
+		assert.True(t, tx.STTL("dst") > 0)
+		assert.Equal(t, 0, tx.HLen("src"))
+
+		_, err := tx.Get("dst")
+		assert.Equal(t, ErrInvalidKey, err)
+		return nil
+	}
+	db.View(check)
+
+	// the rename is replayed from the log
+	db.Close()
+	db = getTestDB()
+	defer db.Close()
+	db.View(check)
+}
+
+func TestFlashDB_FlushAll(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("str", "val"))
+		assert.NoError(t, tx.ZAdd("zset", 1, "member"))
+		_, err := tx.LPush("list", "elem")
+		return err
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.SAdd("set", "member"))
+		assert.NoError(t, tx.FlushAll())
+		assert.Equal(t, 0, tx.DBSize())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), db.UsedMemory())
+
+	db.Close()
+	db = getTestDB()
+	defer db.Close()
+	db.View(func(tx *Tx) error {
+		assert.Equal(t, 0, tx.DBSize())
+		return nil
+	})
+}
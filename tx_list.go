@@ -0,0 +1,349 @@
+package flashdb
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+// InsertPosition tells LInsert whether to insert an element before or after
+// the pivot.
+type InsertPosition uint8
+
+const (
+	Before InsertPosition = iota
+	After
+)
+
+// ListDirection tells LMove which end of a list to pop from or push to.
+type ListDirection uint8
+
+const (
+	Left ListDirection = iota
+	Right
+)
+
+// LPush inserts the values at the head of the list stored at key, one after
+// the other, and returns the length of the list.
+func (tx *Tx) LPush(key string, values ...string) (int, error) {
+	return tx.push(key, ListLPush, values)
+}
+
+// RPush inserts the values at the tail of the list stored at key, and returns
+// the length of the list.
+func (tx *Tx) RPush(key string, values ...string) (int, error) {
+	return tx.push(key, ListRPush, values)
+}
+
+func (tx *Tx) push(key string, mark uint16, values []string) (int, error) {
+	if tx.wrongType(List, key) {
+		return 0, ErrWrongType
+	}
+	recs := make([]*record, 0, len(values))
+	for _, v := range values {
+		recs = append(recs, newRecord([]byte(key), []byte(v), ListRecord, mark))
+	}
+	if err := tx.addRecord(recs...); err != nil {
+		return 0, err
+	}
+	return tx.LLen(key), nil
+}
+
+// LPop removes and returns the first element of the list stored at key. It
+// returns ErrInvalidKey if the list is empty.
+func (tx *Tx) LPop(key string) (string, error) {
+	return tx.pop(key, 0, ListLPop)
+}
+
+// RPop removes and returns the last element of the list stored at key. It
+// returns ErrInvalidKey if the list is empty.
+func (tx *Tx) RPop(key string) (string, error) {
+	return tx.pop(key, -1, ListRPop)
+}
+
+func (tx *Tx) pop(key string, index int, mark uint16) (string, error) {
+	val, err := tx.LIndex(key, index)
+	if err != nil {
+		return "", err
+	}
+
+	e := newRecord([]byte(key), nil, ListRecord, mark)
+	if err := tx.addRecord(e); err != nil {
+		return "", err
+	}
+	return val, nil
+}
+
+// LMove pops an element from the src end of the list stored at src, pushes it
+// to the dst end of the list stored at dst, and returns it. src and dst may be
+// the same list. It returns ErrInvalidKey if the src list is empty.
+func (tx *Tx) LMove(src, dst string, from, to ListDirection) (string, error) {
+	if err := tx.CheckType(List, src, dst); err != nil {
+		return "", err
+	}
+	var val string
+	var err error
+	if from == Left {
+		val, err = tx.LPop(src)
+	} else {
+		val, err = tx.RPop(src)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if to == Left {
+		_, err = tx.LPush(dst, val)
+	} else {
+		_, err = tx.RPush(dst, val)
+	}
+	if err != nil {
+		return "", err
+	}
+	return val, nil
+}
+
+// LIndex returns the element at index in the list stored at key. Negative
+// indexes count from the tail, -1 being the last element. If the key has
+// expired, the key is evicted.
+func (tx *Tx) LIndex(key string, index int) (string, error) {
+	if tx.wrongType(List, key) {
+		return "", ErrWrongType
+	}
+	db := tx.source(List, key)
+	if db.hasExpired(key, List) {
+		tx.evict(key, List)
+		return "", ErrInvalidKey
+	}
+	if !db.listStore.LKeyExists(key) {
+		return "", ErrInvalidKey
+	}
+
+	val, ok := db.listStore.LIndex(key, index)
+	if !ok {
+		return "", ErrIndexOutOfRange
+	}
+	return val, nil
+}
+
+// LSet sets the element at index in the list stored at key to value.
+func (tx *Tx) LSet(key string, index int, value string) error {
+	if _, err := tx.LIndex(key, index); err != nil {
+		return err
+	}
+
+	e := newRecordWithValue([]byte(key), []byte(value), []byte(strconv.Itoa(index)), ListRecord, ListLSet)
+	return tx.addRecord(e)
+}
+
+// LRange returns the elements between start and stop, both inclusive, of the
+// list stored at key. Negative offsets count from the tail. If the key has
+// expired, the key is evicted.
+func (tx *Tx) LRange(key string, start, stop int) []string {
+	db := tx.source(List, key)
+	if db.hasExpired(key, List) {
+		tx.evict(key, List)
+		return nil
+	}
+
+	return db.listStore.LRange(key, start, stop)
+}
+
+// LRem removes the first count occurrences of value from the list stored at
+// key. A negative count removes them from the tail, and a zero count removes
+// every occurrence. It returns the number of removed elements.
+func (tx *Tx) LRem(key string, count int, value string) (res int, err error) {
+	if tx.wrongType(List, key) {
+		return 0, ErrWrongType
+	}
+	for _, v := range tx.LRange(key, 0, -1) {
+		if v == value {
+			res++
+		}
+	}
+	if max := absUint(count); count != 0 && uint(res) > max {
+		res = int(max)
+	}
+	if res == 0 {
+		return
+	}
+
+	e := newRecordWithValue([]byte(key), []byte(value), []byte(strconv.Itoa(count)), ListRecord, ListLRem)
+	err = tx.addRecord(e)
+	return
+}
+
+// LTrim trims the list stored at key to the elements between start and stop,
+// both inclusive. Negative offsets count from the tail.
+func (tx *Tx) LTrim(key string, start, stop int) error {
+	if tx.wrongType(List, key) {
+		return ErrWrongType
+	}
+	if !tx.LKeyExists(key) {
+		return nil
+	}
+
+	e := newRecordWithValue([]byte(key), []byte(strconv.Itoa(start)), []byte(strconv.Itoa(stop)), ListRecord, ListLTrim)
+	return tx.addRecord(e)
+}
+
+// LLen returns the length of the list stored at key. If the key has expired,
+// the key is evicted.
+func (tx *Tx) LLen(key string) int {
+	db := tx.source(List, key)
+	if db.hasExpired(key, List) {
+		tx.evict(key, List)
+		return 0
+	}
+
+	return db.listStore.LLen(key)
+}
+
+// LInsert inserts value before or after the first occurrence of pivot in the
+// list stored at key. It returns the length of the list, -1 if pivot was not
+// found, or 0 if the key does not exist.
+func (tx *Tx) LInsert(key string, pos InsertPosition, pivot, value string) (int, error) {
+	if tx.wrongType(List, key) {
+		return 0, ErrWrongType
+	}
+	vals := tx.LRange(key, 0, -1)
+	if len(vals) == 0 {
+		return 0, nil
+	}
+
+	found := false
+	for _, v := range vals {
+		if v == pivot {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return -1, nil
+	}
+
+	mark := ListLInsertBefore
+	if pos == After {
+		mark = ListLInsertAfter
+	}
+	e := newRecordWithValue([]byte(key), []byte(value), []byte(pivot), ListRecord, mark)
+	if err := tx.addRecord(e); err != nil {
+		return 0, err
+	}
+	return len(vals) + 1, nil
+}
+
+// LKeyExists returns if the key exists. If the key has expired, the key is
+// evicted.
+func (tx *Tx) LKeyExists(key string) (ok bool) {
+	db := tx.source(List, key)
+	if db.hasExpired(key, List) {
+		tx.evict(key, List)
+		return
+	}
+
+	return db.listStore.LKeyExists(key)
+}
+
+// LClear clears the list stored at key.
+func (tx *Tx) LClear(key string) (err error) {
+	if tx.wrongType(List, key) {
+		return ErrWrongType
+	}
+	if !tx.LKeyExists(key) {
+		return ErrInvalidKey
+	}
+
+	e := newRecord([]byte(key), nil, ListRecord, ListLClear)
+	return tx.addRecord(e)
+}
+
+// LExpire sets expired time for the key in list.
+func (tx *Tx) LExpire(key string, duration int64) (err error) {
+	deadline, err := deadlineIn(duration, time.Second)
+	if err != nil {
+		return
+	}
+	return tx.LPExpireAt(key, deadline)
+}
+
+// LPExpire is like LExpire, but duration is in milliseconds.
+func (tx *Tx) LPExpire(key string, duration int64) (err error) {
+	deadline, err := deadlineIn(duration, time.Millisecond)
+	if err != nil {
+		return
+	}
+	return tx.LPExpireAt(key, deadline)
+}
+
+// LExpireAt sets the deadline of the key in list to the Unix time t, in
+// seconds. A deadline in the past expires the key.
+func (tx *Tx) LExpireAt(key string, t int64) (err error) {
+	deadline, err := deadlineAt(t, time.Second)
+	if err != nil {
+		return
+	}
+	return tx.LPExpireAt(key, deadline)
+}
+
+// LPExpireAt is like LExpireAt, but t is in milliseconds.
+func (tx *Tx) LPExpireAt(key string, t int64) (err error) {
+	if tx.wrongType(List, key) {
+		return ErrWrongType
+	}
+	if _, err = deadlineAt(t, time.Millisecond); err != nil {
+		return
+	}
+	if !tx.LKeyExists(key) {
+		return ErrInvalidKey
+	}
+
+	e := newRecordWithExpire([]byte(key), nil, t, ListRecord, ListLExpire)
+	return tx.addRecord(e)
+}
+
+// LTTL returns time to live for the key in list.
+func (tx *Tx) LTTL(key string) (ttl int64) {
+	return ttlSeconds(tx.LPTTL(key))
+}
+
+// LPTTL returns the time to live of the key in list in milliseconds.
+func (tx *Tx) LPTTL(key string) (ttl int64) {
+	db := tx.source(List, key)
+	if db.hasExpired(key, List) {
+		tx.evict(key, List)
+		return
+	}
+
+	return db.pttl(List, key)
+}
+
+// LPersist removes the TTL of the key in list. It returns false if the key
+// does not exist or has no TTL.
+func (tx *Tx) LPersist(key string) (bool, error) {
+	if tx.wrongType(List, key) {
+		return false, ErrWrongType
+	}
+	if !tx.LKeyExists(key) || tx.source(List, key).getTTL(List, key) == nil {
+		return false, nil
+	}
+
+	e := newRecord([]byte(key), nil, ListRecord, ListLPersist)
+	if err := tx.addRecord(e); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// absUint returns the absolute value of n, which does not overflow for
+// math.MinInt.
+func absUint(n int) uint {
+	if n < 0 {
+		return uint(-(n + 1)) + 1
+	}
+	return uint(n)
+}
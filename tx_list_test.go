@@ -0,0 +1,205 @@
+package flashdb
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlashDB_ListPushPop(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		n, err := tx.RPush(testKey, "b", "c")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		n, err = tx.LPush(testKey, "a", "z")
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		assert.Equal(t, []string{"z", "a", "b", "c"}, tx.LRange(testKey, 0, -1))
+
+		val, err := tx.LPop(testKey)
+		assert.NoError(t, err)
+		assert.Equal(t, "z", val)
+
+		val, err = tx.RPop(testKey)
+		assert.NoError(t, err)
+		assert.Equal(t, "c", val)
+		assert.Equal(t, 2, tx.LLen(testKey))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		for i := 0; i < 2; i++ {
+			_, err := tx.LPop(testKey)
+			assert.NoError(t, err)
+		}
+		_, err := tx.LPop(testKey)
+		assert.Equal(t, ErrInvalidKey, err)
+		assert.False(t, tx.LKeyExists(testKey))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_ListIndexSet(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.RPush(testKey, "a", "b", "c")
+		assert.NoError(t, err)
+
+		val, err := tx.LIndex(testKey, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, "c", val)
+
+		_, err = tx.LIndex(testKey, 3)
+		assert.Equal(t, ErrIndexOutOfRange, err)
+		_, err = tx.LIndex("missing", 0)
+		assert.Equal(t, ErrInvalidKey, err)
+
+		assert.NoError(t, tx.LSet(testKey, 1, "B"))
+		assert.Equal(t, ErrIndexOutOfRange, tx.LSet(testKey, 5, "x"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"a", "B", "c"}, tx.LRange(testKey, 0, -1))
+		assert.Equal(t, []string{"B", "c"}, tx.LRange(testKey, -2, 10))
+		assert.Empty(t, tx.LRange(testKey, 2, 1))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_ListRemTrimInsert(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.RPush(testKey, "x", "a", "x", "b", "x")
+		assert.NoError(t, err)
+
+		n, err := tx.LRem(testKey, -2, "x")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []string{"x", "a", "b"}, tx.LRange(testKey, 0, -1))
+
+		n, err = tx.LInsert(testKey, Before, "b", "c")
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+		n, err = tx.LInsert(testKey, After, "b", "d")
+		assert.NoError(t, err)
+		assert.Equal(t, 5, n)
+		n, err = tx.LInsert(testKey, After, "missing", "d")
+		assert.NoError(t, err)
+		assert.Equal(t, -1, n)
+
+		return tx.LTrim(testKey, 1, -2)
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"a", "c", "b"}, tx.LRange(testKey, 0, -1))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// the count of math.MinInt has no positive counterpart
+	err = db.Update(func(tx *Tx) error {
+		n, err := tx.LRem(testKey, math.MinInt, "c")
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []string{"a", "b"}, tx.LRange(testKey, 0, -1))
+		return err
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_ListExpire(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.Equal(t, ErrInvalidKey, tx.LExpire(testKey, 100))
+		_, err := tx.RPush(testKey, "a")
+		assert.NoError(t, err)
+		assert.Equal(t, ErrInvalidTTL, tx.LExpire(testKey, 0))
+		return tx.LExpire(testKey, 100)
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		ttl := tx.LTTL(testKey)
+		assert.True(t, ttl > 0 && ttl <= 100)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_ListLoad(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.RPush(testKey, "a", "x", "b", "c", "d")
+		assert.NoError(t, err)
+		_, err = tx.LPush(testKey, "z")
+		assert.NoError(t, err)
+		_, err = tx.RPop(testKey)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.LSet(testKey, 0, "Z"))
+		_, err = tx.LRem(testKey, 0, "x")
+		assert.NoError(t, err)
+		_, err = tx.LInsert(testKey, After, "a", "y")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.LTrim(testKey, 0, 3))
+
+		_, err = tx.RPush("cleared", "a")
+		assert.NoError(t, err)
+		return tx.LExpire(testKey, 100)
+	})
+	assert.NoError(t, err)
+	err = db.Update(func(tx *Tx) error {
+		return tx.LClear("cleared")
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	db = getTestDB()
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"Z", "a", "y", "b"}, tx.LRange(testKey, 0, -1))
+		assert.True(t, tx.LTTL(testKey) > 0)
+		assert.False(t, tx.LKeyExists("cleared"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// the rewritten log rebuilds the same list
+	assert.NoError(t, db.Rewrite())
+	assert.NoError(t, db.Close())
+
+	db = getTestDB()
+	defer db.Close()
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"Z", "a", "y", "b"}, tx.LRange(testKey, 0, -1))
+		assert.True(t, tx.LTTL(testKey) > 0)
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,196 @@
+package flashdb
+
+// overlayKey identifies a key of a data type in the overlay.
+type overlayKey struct {
+	dType DataType
+	key   string
+}
+
+// overlay holds the keys written by a read/write transaction with the pending
+// records applied to them, so that reads within the transaction see its own
+// writes. The stores of the overlay hold the changes to the keys, layered over
+// the stores of the database (see layer.go); a string and the TTL of a key are
+// copied the first time the key is written to. The memory of the overlay
+// counts the memory added by the records, for freeMemory.
+type overlay struct {
+	db      *FlashDB // stores layered over those of the database.
+	touched map[overlayKey]bool
+
+	hashes    *hashLayer
+	fieldExps *fieldExpLayer
+	sets      *setLayer
+	zsets     *zsetLayer
+	lists     *listLayer
+}
+
+func newOverlay(base *FlashDB) *overlay {
+	o := &overlay{
+		touched:   make(map[overlayKey]bool),
+		hashes:    newHashLayer(base.hashStore),
+		fieldExps: newFieldExpLayer(base.fieldExps),
+		sets:      newSetLayer(base.setStore),
+		zsets:     newZSetLayer(base.zsetStore),
+		lists:     newListLayer(base.listStore),
+	}
+	o.db = &FlashDB{
+		config:    base.config,
+		strStore:  newStrStore(),
+		hashStore: o.hashes,
+		setStore:  o.sets,
+		zsetStore: o.zsets,
+		listStore: o.lists,
+		exps:      newExpiry(),
+		fieldExps: o.fieldExps,
+		mem:       newMemory(),
+	}
+	return o
+}
+
+// recordDataType returns the data type of the records with type t.
+func recordDataType(t uint16) DataType {
+	switch t {
+	case StringRecord:
+		return String
+	case HashRecord:
+		return Hash
+	case SetRecord:
+		return Set
+	case ZSetRecord:
+		return ZSet
+	case ListRecord:
+		return List
+	}
+	return ""
+}
+
+// apply applies the record to the overlay. The keys of the record must have
+// been touched by the transaction.
+func (o *overlay) apply(r *record) error {
+	return o.db.loadRecord(r)
+}
+
+// recordKeys returns the keys written by the record.
+func recordKeys(r *record) []string {
+	if r.getType() == SetRecord && r.getMark() == SetSMove {
+		// the value of an SMove record is the destination key
+		return []string{string(r.meta.key), string(r.meta.value)}
+	}
+	return []string{string(r.meta.key)}
+}
+
+// addKey adds the key to the overlay, copying its TTL from src, or reading
+// it as empty if clear is set.
+func (o *overlay) addKey(src *FlashDB, dType DataType, key string, clear bool) {
+	k := overlayKey{dType, key}
+	if o.touched[k] {
+		return
+	}
+	o.touched[k] = true
+
+	switch dType {
+	case String:
+		if val := src.strStore.Search([]byte(key)); val != nil && !clear {
+			o.db.strStore.Insert([]byte(key), val)
+		}
+	case Hash:
+		o.hashes.touch(key, clear)
+		o.fieldExps.touch(key, clear)
+	case Set:
+		o.sets.touch(key, clear)
+	case ZSet:
+		o.zsets.touch(key, clear)
+	case List:
+		o.lists.touch(key, clear)
+	}
+
+	if clear {
+		return
+	}
+	if size := src.mem.size(dType, key); size > 0 {
+		o.db.mem.seed(dType, key, size)
+	}
+	if ttl := src.getTTL(dType, key); ttl != nil {
+		o.db.setTTL(dType, key, ttl.(int64))
+	}
+}
+
+// source returns the database to read key from: the overlay if the
+// transaction has written to the key, and the database otherwise, in which
+// case the access to the key is recorded for the eviction policies. The
+// reads of the sweeper are not recorded.
+func (tx *Tx) source(dType DataType, key string) *FlashDB {
+	db := tx.lookup(dType, key)
+	if db == tx.db && !tx.sweeping {
+		tx.db.mem.access(dType, key)
+	}
+	return db
+}
+
+// lookup is source without recording the access, for the reads made on
+// behalf of the transaction rather than the user.
+func (tx *Tx) lookup(dType DataType, key string) *FlashDB {
+	if tx.wc != nil && tx.wc.overlay != nil && tx.wc.overlay.touched[overlayKey{dType, key}] {
+		return tx.wc.overlay.db
+	}
+	return tx.db
+}
+
+// touch adds the key to the overlay of the transaction before it is written
+// to. A key that has expired in the database is read as empty: its removal
+// is queued, so that the records written to it apply to an empty key on commit
+// as they do in the overlay.
+func (tx *Tx) touch(dType DataType, key string) {
+	if tx.wc.overlay == nil {
+		tx.wc.overlay = newOverlay(tx.db)
+	}
+	o := tx.wc.overlay
+	k := overlayKey{dType, key}
+	if o.touched[k] {
+		return
+	}
+
+	if tx.db.hasExpired(key, dType) {
+		o.addKey(tx.db, dType, key, true)
+		tx.wc.commitItems = append(tx.wc.commitItems, evictRecord(dType, key, removedExpired))
+		return
+	}
+	o.addKey(tx.db, dType, key, false)
+}
+
+// evict removes the expired key when the transaction commits. Expired keys
+// are only removed by read/write transactions; read-only transactions leave
+// them to the sweeper and read them as missing.
+//
+// Reads ignore the error, which only comes from the overlay, as the key is
+// read as missing either way.
+func (tx *Tx) evict(key string, dType DataType) error {
+	if !tx.writable {
+		return nil
+	}
+	if tx.wc.overlay == nil || !tx.wc.overlay.touched[overlayKey{dType, key}] {
+		tx.touch(dType, key)
+		return nil
+	}
+	return tx.addRecord(evictRecord(dType, key, removedExpired))
+}
+
+// evictFields removes the expired fields of the hash stored at key when the
+// transaction commits. Like evict, it does nothing in a read-only
+// transaction.
+func (tx *Tx) evictFields(key string) error {
+	if !tx.writable {
+		return nil
+	}
+	db := tx.lookup(Hash, key)
+	for _, field := range db.fieldExps.HKeys(key) {
+		if !db.fieldExpired(key, field) || !db.hashStore.HExists(key, field) {
+			continue
+		}
+		r := newRecord([]byte(key), []byte(field), HashRecord, HashHDel)
+		r.cause = removedExpired
+		if err := tx.addRecord(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package flashdb
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTx_ReadOwnWritesString(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("a", "1"))
+		val, err := tx.Get("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", val)
+		assert.True(t, tx.Exists("a"))
+
+		assert.NoError(t, tx.Expire("a", 100))
+		assert.True(t, tx.TTL("a") > 0)
+
+		assert.NoError(t, tx.Delete("a"))
+		_, err = tx.Get("a")
+		assert.Error(t, err)
+		assert.False(t, tx.Exists("a"))
+		return tx.Set("b", "2")
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		assert.False(t, tx.Exists("a"))
+		val, err := tx.Get("b")
+		assert.NoError(t, err)
+		assert.Equal(t, "2", val)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestTx_ReadOwnWritesHash(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.HSet("h", "f1", "v1")
+		return err
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		_, err := tx.HSet("h", "f2", "v2")
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", tx.HGet("h", "f2"))
+		assert.Equal(t, "v1", tx.HGet("h", "f1"))
+		assert.Equal(t, 2, tx.HLen("h"))
+
+		_, err = tx.HDel("h", "f1")
+		assert.NoError(t, err)
+		assert.False(t, tx.HExists("h", "f1"))
+		assert.Equal(t, []string{"f2"}, tx.HKeys("h"))
+
+		assert.NoError(t, tx.HClear("h"))
+		assert.False(t, tx.HKeyExists("h"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestTx_ReadOwnWritesSet(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.SAdd("s1", "a", "b"))
+		assert.True(t, tx.SIsMember("s1", "a"))
+		assert.Equal(t, 2, tx.SCard("s1"))
+
+		assert.NoError(t, tx.SMove("s1", "s2", "a"))
+		assert.False(t, tx.SIsMember("s1", "a"))
+		assert.True(t, tx.SIsMember("s2", "a"))
+		assert.ElementsMatch(t, []string{"a", "b"}, tx.SUnion("s1", "s2"))
+		assert.Equal(t, []string{"b"}, tx.SDiff("s1", "s2"))
+
+		_, err := tx.SRem("s1", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, tx.SCard("s1"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"a"}, tx.SMembers("s2"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestTx_ReadOwnWritesZSet(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.ZAdd("z", 2, "b"))
+		assert.NoError(t, tx.ZAdd("z", 1, "a"))
+		ok, score := tx.ZScore("z", "a")
+		assert.True(t, ok)
+		assert.Equal(t, float64(1), score)
+		assert.Equal(t, []interface{}{"a", "b"}, tx.ZRange("z", 0, -1))
+
+		ok, err := tx.ZRem("z", "a")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 1, tx.ZCard("z"))
+
+		assert.NoError(t, tx.ZClear("z"))
+		assert.False(t, tx.ZKeyExists("z"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestTx_RollbackDiscardsOverlay(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.SAdd("s1", "a"))
+		return tx.ZAdd("z", 1, "a")
+	})
+	assert.NoError(t, err)
+
+	errRollback := errors.New("rollback")
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.SMove("s1", "s2", "a"))
+		_, err := tx.ZRem("z", "a")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Set("k", "v"))
+		return errRollback
+	})
+	assert.Equal(t, errRollback, err)
+
+	err = db.View(func(tx *Tx) error {
+		assert.True(t, tx.SIsMember("s1", "a"))
+		assert.False(t, tx.SKeyExists("s2"))
+		ok, _ := tx.ZScore("z", "a")
+		assert.True(t, ok)
+		assert.False(t, tx.Exists("k"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestTx_ReadOwnWritesList(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.RPush("l", "a", "b", "c", "d")
+		return err
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		_, err := tx.LPush("l", "y", "z")
+		assert.NoError(t, err)
+		_, err = tx.RPush("l", "e")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"z", "y", "a", "b", "c", "d", "e"}, tx.LRange("l", 0, -1))
+		assert.Equal(t, []string{"y", "a", "b"}, tx.LRange("l", 1, 3))
+		val, err := tx.LIndex("l", -1)
+		assert.NoError(t, err)
+		assert.Equal(t, "e", val)
+
+		val, err = tx.LPop("l")
+		assert.NoError(t, err)
+		assert.Equal(t, "z", val)
+		assert.NoError(t, tx.LTrim("l", 2, -2))
+		assert.Equal(t, []string{"b", "c", "d"}, tx.LRange("l", 0, -1))
+
+		assert.NoError(t, tx.LSet("l", 1, "x"))
+		_, err = tx.RPush("l", "f")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b", "x", "d", "f"}, tx.LRange("l", 0, -1))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"b", "x", "d", "f"}, tx.LRange("l", 0, -1))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestTx_OverlayDoesNotCopyKeys(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	const n = 10000
+	err := db.Update(func(tx *Tx) error {
+		for i := 0; i < n; i++ {
+			if _, err := tx.RPush("l", "elem"); err != nil {
+				return err
+			}
+			if _, err := tx.HSet("h", strconv.Itoa(i), "val"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		_, err := tx.RPush("l", "last")
+		assert.NoError(t, err)
+		_, err = tx.HSet("h", "new", "val")
+		assert.NoError(t, err)
+
+		// only the changes are held by the transaction
+		o := tx.wc.overlay
+		assert.Equal(t, []string{"last"}, o.lists.keys["l"].tail)
+		assert.Len(t, o.hashes.keys["h"].fields, 1)
+
+		assert.Equal(t, n+1, tx.LLen("l"))
+		val, err := tx.LIndex("l", -1)
+		assert.NoError(t, err)
+		assert.Equal(t, "last", val)
+		assert.Equal(t, n+1, tx.HLen("h"))
+		assert.Equal(t, "val", tx.HGet("h", "0"))
+		return errors.New("rollback")
+	})
+	assert.Error(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		assert.Equal(t, n, tx.LLen("l"))
+		assert.False(t, tx.HExists("h", "new"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
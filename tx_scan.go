@@ -0,0 +1,259 @@
+package flashdb
+
+import (
+	"errors"
+	"strconv"
+)
+
+// DefaultScanCount is the number of elements returned by a scan call when
+// ScanOptions.Count is not set.
+const DefaultScanCount = 10
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorTypeShift is the position of the data type, as an index into
+// dataTypes, in the cursor of Scan. The bits below it hold the number of keys
+// of the data type left to scan, or 0 at the start of the data type.
+const cursorTypeShift = 56
+
+// ScanOptions configures Scan, HScan, SScan and ZScan.
+type ScanOptions struct {
+	Match string   // glob-style pattern of the elements, as in KEYS, any if empty
+	Count int      // hint of the number of elements returned per call
+	Type  DataType // data type of the keys, any if empty; only used by Scan
+}
+
+// Scan returns the next keys of the database from cursor, and the cursor to
+// pass to the next call. A key name holding several data types is returned
+// once.
+//
+// As in Redis, a scan returns every element present for the whole scan at
+// least once, and may return an element more than once; elements added or
+// removed during the scan may or may not be returned. Elements are returned in
+// no particular order. The cursor is "0" at the start and at the end of a
+// scan, and a decimal number that fits in 64 bits otherwise.
+//
+// Each call goes through about opts.Count elements, whatever the size of the
+// keyspace or of the key, and no lock is held between calls. Matching elements
+// against opts.Match happens after that, so a call may return fewer elements,
+// or none, before the end of the scan.
+func (tx *Tx) Scan(cursor string, opts ScanOptions) (string, []string, error) {
+	t, left, err := decodeCursor(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+	if opts.Type != "" {
+		i := dataTypeIndex(opts.Type)
+		switch {
+		case i < 0:
+			return "0", nil, nil
+		case cursor == "0":
+			t = i
+		case t != i:
+			return "", nil, ErrInvalidCursor
+		}
+	}
+	if t >= len(dataTypes) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	var keys []string
+	count := scanCount(opts)
+	for {
+		dType := dataTypes[t]
+		page, next := tx.db.mem.scan(dType, left, count)
+		count -= len(page)
+		for _, key := range page {
+			if tx.scannedKey(dType, key, opts) {
+				keys = append(keys, key)
+			}
+		}
+		if next > 0 {
+			return encodeCursor(t, next), keys, nil
+		}
+
+		t, left = t+1, -1
+		if opts.Type != "" || t == len(dataTypes) {
+			return "0", append(keys, tx.overlayKeys(opts)...), nil
+		}
+		if count <= 0 {
+			return encodeCursor(t, 0), keys, nil
+		}
+	}
+}
+
+// scannedKey reports whether Scan returns the key of type dType: a key name
+// holding several data types is returned for the first of them in dataTypes.
+func (tx *Tx) scannedKey(dType DataType, key string, opts ScanOptions) bool {
+	if opts.Match != "" && !globMatch(opts.Match, key) {
+		return false
+	}
+	if !tx.hasKey(dType, key) {
+		return false
+	}
+	if opts.Type != "" {
+		return true
+	}
+	for _, other := range dataTypes {
+		if other == dType {
+			return true
+		}
+		if tx.hasKey(other, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// overlayKeys returns the keys created by the transaction that are not in
+// the database yet, which Scan returns at the end of the scan.
+func (tx *Tx) overlayKeys(opts ScanOptions) (keys []string) {
+	if tx.wc == nil || tx.wc.overlay == nil {
+		return nil
+	}
+	for k := range tx.wc.overlay.touched {
+		if opts.Type != "" && k.dType != opts.Type || tx.db.mem.has(k.dType, k.key) {
+			continue
+		}
+		if tx.scannedKey(k.dType, k.key, opts) {
+			keys = append(keys, k.key)
+		}
+	}
+	return
+}
+
+// HScan returns the next fields of the hash stored at key from cursor, each
+// followed by its value, and the cursor to pass to the next call.
+func (tx *Tx) HScan(key, cursor string, opts ScanOptions) (string, []string, error) {
+	if tx.wrongType(Hash, key) {
+		return "", nil, ErrWrongType
+	}
+	left, err := decodeElemCursor(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+	db := tx.hash(key)
+	if db == nil {
+		return "0", nil, nil
+	}
+
+	fields, next := db.hashStore.scan(key, left, scanCount(opts))
+	res := make([]string, 0, 2*len(fields))
+	for _, field := range fields {
+		if opts.Match != "" && !globMatch(opts.Match, field) || db.fieldExpired(key, field) {
+			continue
+		}
+		if val := db.hashStore.HGet(key, field); val != nil {
+			res = append(res, field, toString(val))
+		}
+	}
+	return encodeCursor(0, next), res, nil
+}
+
+// SScan returns the next members of the set stored at key from cursor, and the
+// cursor to pass to the next call.
+func (tx *Tx) SScan(key, cursor string, opts ScanOptions) (string, []string, error) {
+	if tx.wrongType(Set, key) {
+		return "", nil, ErrWrongType
+	}
+	left, err := decodeElemCursor(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+	db := tx.source(Set, key)
+	if db.hasExpired(key, Set) {
+		tx.evict(key, Set)
+		return "0", nil, nil
+	}
+
+	members, next := db.setStore.scan(key, left, scanCount(opts))
+	return encodeCursor(0, next), matching(members, opts), nil
+}
+
+// ZScan returns the next members of the sorted set stored at key from cursor,
+// each followed by its score, and the cursor to pass to the next call.
+func (tx *Tx) ZScan(key, cursor string, opts ScanOptions) (string, []interface{}, error) {
+	if tx.wrongType(ZSet, key) {
+		return "", nil, ErrWrongType
+	}
+	left, err := decodeElemCursor(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+	db := tx.source(ZSet, key)
+	if db.hasExpired(key, ZSet) {
+		tx.evict(key, ZSet)
+		return "0", nil, nil
+	}
+
+	members, next := db.zsetStore.scan(key, left, scanCount(opts))
+	res := make([]interface{}, 0, 2*len(members))
+	for _, member := range matching(members, opts) {
+		if ok, score := db.zsetStore.ZScore(key, member); ok {
+			res = append(res, member, score)
+		}
+	}
+	return encodeCursor(0, next), res, nil
+}
+
+// scanCount returns the number of elements a scan call goes through.
+func scanCount(opts ScanOptions) int {
+	if opts.Count <= 0 {
+		return DefaultScanCount
+	}
+	return opts.Count
+}
+
+// matching returns the elements that match opts.Match, in place.
+func matching(elems []string, opts ScanOptions) []string {
+	if opts.Match == "" {
+		return elems
+	}
+	res := elems[:0]
+	for _, elem := range elems {
+		if globMatch(opts.Match, elem) {
+			res = append(res, elem)
+		}
+	}
+	return res
+}
+
+// encodeCursor returns the cursor of the data type at index t in dataTypes,
+// with left elements of it left to scan.
+func encodeCursor(t, left int) string {
+	return strconv.FormatUint(uint64(t)<<cursorTypeShift|uint64(left), 10)
+}
+
+// decodeCursor returns the index in dataTypes of the data type of the cursor,
+// and the number of elements of it left to scan, or -1 at its start.
+func decodeCursor(cursor string) (int, int, error) {
+	n, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	t, left := int(n>>cursorTypeShift), int(n&(1<<cursorTypeShift-1))
+	if left == 0 {
+		left = -1
+	}
+	return t, left, nil
+}
+
+// decodeElemCursor returns the number of elements left to scan of the cursor
+// of HScan, SScan or ZScan, or -1 at the start of the scan.
+func decodeElemCursor(cursor string) (int, error) {
+	t, left, err := decodeCursor(cursor)
+	if err != nil || t != 0 {
+		return 0, ErrInvalidCursor
+	}
+	return left, nil
+}
+
+// dataTypeIndex returns the index of the data type in dataTypes, or -1.
+func dataTypeIndex(dType DataType) int {
+	for i, t := range dataTypes {
+		if t == dType {
+			return i
+		}
+	}
+	return -1
+}
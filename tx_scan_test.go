@@ -0,0 +1,218 @@
+package flashdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scanAll scans from the start with fn, calling between after each call, and
+// returns the elements in the order they were returned.
+func scanAll(t *testing.T, db *FlashDB, fn func(tx *Tx, cursor string) (string, []string, error), between func()) (elems []string) {
+	cursor := "0"
+	for {
+		var page []string
+		err := db.View(func(tx *Tx) (err error) {
+			cursor, page, err = fn(tx, cursor)
+			return
+		})
+		assert.NoError(t, err)
+		elems = append(elems, page...)
+		if cursor == "0" {
+			return
+		}
+		between()
+	}
+}
+
+func TestFlashDB_Scan(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	var keys []string
+	err := db.Update(func(tx *Tx) error {
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("key:%02d", i)
+			keys = append(keys, key)
+			if err := tx.Set(key, "val"); err != nil {
+				return err
+			}
+		}
+		// a name holding two data types is returned once
+		assert.NoError(t, tx.SAdd("key:05", "member"))
+		return tx.ZAdd("zset", 1, "member")
+	})
+	assert.NoError(t, err)
+
+	opts := ScanOptions{Match: "key:*", Count: 3}
+	scanKeys := func(tx *Tx, cursor string) (string, []string, error) {
+		return tx.Scan(cursor, opts)
+	}
+	assert.ElementsMatch(t, keys, scanAll(t, db, scanKeys, func() {}))
+
+	// the keys present for the whole scan are returned, whatever is written
+	// between the calls
+	n := 0
+	got := scanAll(t, db, scanKeys, func() {
+		n++
+		db.Update(func(tx *Tx) error {
+			tx.Set(fmt.Sprintf("key:%02d:new", n), "val")
+			_, err := tx.Del(fmt.Sprintf("key:%02d", 20-n))
+			return err
+		})
+	})
+	for _, key := range keys[:20-n] {
+		assert.Contains(t, got, key)
+	}
+
+	db.View(func(tx *Tx) error {
+		next, keys, err := tx.Scan("0", ScanOptions{Type: ZSet})
+		assert.NoError(t, err)
+		assert.Equal(t, "0", next)
+		assert.Equal(t, []string{"zset"}, keys)
+
+		_, _, err = tx.Scan("abc", ScanOptions{})
+		assert.Equal(t, ErrInvalidCursor, err)
+		return nil
+	})
+}
+
+func TestFlashDB_ScanElements(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.SAdd("set", "", "a", "b", "c"))
+		assert.NoError(t, tx.ZAdd("zset", 2, "a"))
+		assert.NoError(t, tx.ZAdd("zset", 1, "b"))
+		_, err := tx.HSet("hash", "f1", "v1")
+		assert.NoError(t, err)
+		_, err = tx.HSet("hash", "f2", "v2")
+		return err
+	})
+	assert.NoError(t, err)
+
+	members := scanAll(t, db, func(tx *Tx, cursor string) (string, []string, error) {
+		return tx.SScan("set", cursor, ScanOptions{Count: 1})
+	}, func() {})
+	assert.ElementsMatch(t, []string{"", "a", "b", "c"}, members)
+
+	db.View(func(tx *Tx) error {
+		next, vals, err := tx.HScan("hash", "0", ScanOptions{Match: "f2"})
+		assert.NoError(t, err)
+		assert.Equal(t, "0", next)
+		assert.Equal(t, []string{"f2", "v2"}, vals)
+
+		next, zvals, err := tx.ZScan("zset", "0", ScanOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "0", next)
+		assert.Len(t, zvals, 4)
+		for i := 0; i+1 < len(zvals); i += 2 {
+			_, score := tx.ZScore("zset", zvals[i].(string))
+			assert.Equal(t, score, zvals[i+1])
+		}
+
+		next, vals, err = tx.SScan("missing", "0", ScanOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "0", next)
+		assert.Empty(t, vals)
+		return nil
+	})
+}
+
+func TestFlashDB_ScanLargeKeys(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	const n = 1000
+	err := db.Update(func(tx *Tx) error {
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("a long key name, so that the cursor would be long if it held it:%04d", i)
+			if err := tx.Set(key, "val"); err != nil {
+				return err
+			}
+			if err := tx.SAdd("set", key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// each call goes through Count elements, and the cursor stays short
+	calls := 0
+	keys := scanAll(t, db, func(tx *Tx, cursor string) (string, []string, error) {
+		calls++
+		next, keys, err := tx.Scan(cursor, ScanOptions{Count: 100, Type: String})
+		assert.True(t, len(next) <= 20)
+		assert.Len(t, keys, 100)
+		return next, keys, err
+	}, func() {})
+	assert.Len(t, keys, n)
+	assert.Equal(t, n/100, calls)
+
+	// members removed during the scan move the last ones in their place,
+	// which may return them twice but does not miss the others
+	removed := make(map[string]bool)
+	members := scanAll(t, db, func(tx *Tx, cursor string) (string, []string, error) {
+		return tx.SScan("set", cursor, ScanOptions{Count: 50})
+	}, func() {
+		db.Update(func(tx *Tx) error {
+			for _, member := range tx.SRandMember("set", 5) {
+				removed[member] = true
+				tx.SRem("set", member)
+			}
+			return nil
+		})
+	})
+	seen := make(map[string]bool)
+	for _, member := range members {
+		seen[member] = true
+	}
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("a long key name, so that the cursor would be long if it held it:%04d", i)
+		assert.True(t, seen[key] || removed[key], key)
+	}
+}
+
+func TestTx_ScanOwnWrites(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		_, err := tx.HSet("hash", "f1", "v1")
+		assert.NoError(t, err)
+		_, err = tx.HSet("hash", "f2", "v2")
+		assert.NoError(t, err)
+		return tx.Set("a", "val")
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("b", "val"))
+		_, err := tx.Del("a")
+		assert.NoError(t, err)
+		_, err = tx.HDel("hash", "f1")
+		assert.NoError(t, err)
+		_, err = tx.HSet("hash", "f3", "v3")
+		assert.NoError(t, err)
+
+		next, keys, err := tx.Scan("0", ScanOptions{Count: 100})
+		assert.NoError(t, err)
+		assert.Equal(t, "0", next)
+		assert.ElementsMatch(t, []string{"b", "hash"}, keys)
+
+		next, vals, err := tx.HScan("hash", "0", ScanOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "0", next)
+		assert.ElementsMatch(t, []string{"f2", "v2", "f3", "v3"}, vals)
+		return nil
+	})
+	assert.NoError(t, err)
+}
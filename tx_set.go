@@ -7,35 +7,39 @@ import (
 // SAdd adds one or more members to the set stored at key. If a member exists at
 // key, it is skipped.
 func (tx *Tx) SAdd(key string, members ...string) (err error) {
+	if tx.wrongType(Set, key) {
+		return ErrWrongType
+	}
+	recs := make([]*record, 0, len(members))
 	for _, m := range members {
-		exist := tx.db.setStore.SIsMember(key, m)
-		if !exist {
-			e := newRecord([]byte(key), []byte(m), SetRecord, SetSAdd)
-			tx.addRecord(e)
+		if !tx.SIsMember(key, m) {
+			recs = append(recs, newRecord([]byte(key), []byte(m), SetRecord, SetSAdd))
 		}
 	}
-	return
+	return tx.addRecord(recs...)
 }
 
 // SIsMember checks the member is a member of set stored at key. If the key has
 // expired, the key is evicted.
 func (tx *Tx) SIsMember(key string, member string) bool {
-	if tx.db.hasExpired(key, Set) {
-		tx.db.evict(key, Set)
+	db := tx.source(Set, key)
+	if db.hasExpired(key, Set) {
+		tx.evict(key, Set)
 		return false
 	}
-	return tx.db.setStore.SIsMember(key, member)
+	return db.setStore.SIsMember(key, member)
 }
 
 // SRandMember returns random elements stored at key. If the key has expired,
 // the key is evicted.
 func (tx *Tx) SRandMember(key string, count int) (values []string) {
-	if tx.db.hasExpired(key, Set) {
-		tx.db.evict(key, Set)
+	db := tx.source(Set, key)
+	if db.hasExpired(key, Set) {
+		tx.evict(key, Set)
 		return nil
 	}
 
-	vals := tx.db.setStore.SRandMember(key, count)
+	vals := db.setStore.SRandMember(key, count)
 	for _, v := range vals {
 		values = append(values, toString(v))
 	}
@@ -46,14 +50,20 @@ func (tx *Tx) SRandMember(key string, count int) (values []string) {
 // number of removed members from the set. If the key has expired, the key
 // is evicted.
 func (tx *Tx) SRem(key string, members ...string) (res int, err error) {
-	if tx.db.hasExpired(key, Set) {
-		tx.db.evict(key, Set)
+	if tx.wrongType(Set, key) {
+		return 0, ErrWrongType
+	}
+	db := tx.source(Set, key)
+	if db.hasExpired(key, Set) {
+		tx.evict(key, Set)
 		return
 	}
 
 	for _, m := range members {
 		e := newRecord([]byte(key), []byte(m), SetRecord, SetSRem)
-		tx.addRecord(e)
+		if err = tx.addRecord(e); err != nil {
+			return
+		}
 		res++
 	}
 	return
@@ -62,42 +72,49 @@ func (tx *Tx) SRem(key string, members ...string) (res int, err error) {
 // SMove moves a member from src to dst.  If both keys have expired, the key is
 // evicted.
 func (tx *Tx) SMove(src, dst string, member string) error {
-	if tx.db.hasExpired(src, Set) {
-		tx.db.evict(src, Hash)
-		return ErrExpiredKey
+	if err := tx.CheckType(Set, src, dst); err != nil {
+		return err
 	}
-	if tx.db.hasExpired(dst, Set) {
-		tx.db.evict(dst, Hash)
-		return ErrExpiredKey
+	for _, key := range []string{src, dst} {
+		db := tx.source(Set, key)
+		if db.hasExpired(key, Set) {
+			tx.evict(key, Set)
+			return ErrExpiredKey
+		}
 	}
 
-	ok := tx.db.setStore.SMove(src, dst, member)
-	if ok {
-		e := newRecordWithValue([]byte(src), []byte(member), []byte(dst), SetRecord, SetSMove)
-		tx.addRecord(e)
+	e := newRecordWithValue([]byte(src), []byte(member), []byte(dst), SetRecord, SetSMove)
+	if err := tx.db.checkRecord(e); err != nil {
+		return err
 	}
-	return nil
+
+	if !tx.SIsMember(src, member) {
+		return nil
+	}
+	return tx.addRecord(e)
 }
 
 // SCard returns the cardinality of the set stored at key. If the key has expired,
 // the key is evicted.
 func (tx *Tx) SCard(key string) int {
-	if tx.db.hasExpired(key, Set) {
-		tx.db.evict(key, Set)
+	db := tx.source(Set, key)
+	if db.hasExpired(key, Set) {
+		tx.evict(key, Set)
 		return 0
 	}
-	return tx.db.setStore.SCard(key)
+	return db.setStore.SCard(key)
 }
 
 // SMembers returns the members stored at key. If the key has expired, the key
 // is evicted.
 func (tx *Tx) SMembers(key string) (values []string) {
-	if tx.db.hasExpired(key, Set) {
-		tx.db.evict(key, Set)
+	db := tx.source(Set, key)
+	if db.hasExpired(key, Set) {
+		tx.evict(key, Set)
 		return
 	}
 
-	vals := tx.db.setStore.SMembers(key)
+	vals := db.setStore.SMembers(key)
 	for _, v := range vals {
 		values = append(values, toString(v))
 	}
@@ -107,18 +124,14 @@ func (tx *Tx) SMembers(key string) (values []string) {
 // SUnion returns the members of the set resulting from union of all the given
 // keys. The members' type is string. If any key has expired, the key is evicted.
 func (tx *Tx) SUnion(keys ...string) (values []string) {
-	var activeKeys []string
+	seen := make(map[string]bool)
 	for _, k := range keys {
-		if tx.db.hasExpired(k, Set) {
-			tx.db.evict(k, Hash)
-			continue
+		for _, v := range tx.SMembers(k) {
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
 		}
-		activeKeys = append(activeKeys, k)
-	}
-
-	vals := tx.db.setStore.SUnion(activeKeys...)
-	for _, v := range vals {
-		values = append(values, toString(v))
 	}
 	return
 }
@@ -126,71 +139,123 @@ func (tx *Tx) SUnion(keys ...string) (values []string) {
 // SDiff returns the members if the set resulting from difference between the
 // first and all the remaining keys. If any key has expired, the key is evicted.
 func (tx *Tx) SDiff(keys ...string) (values []string) {
-	var activeKeys []string
-	for _, k := range keys {
-		if tx.db.hasExpired(k, Set) {
-			tx.db.evict(k, Hash)
-			continue
-		}
-		activeKeys = append(activeKeys, k)
+	if len(keys) == 0 {
+		return
 	}
 
-	vals := tx.db.setStore.SDiff(activeKeys...)
-	for _, v := range vals {
-		values = append(values, toString(v))
+	excluded := make(map[string]bool)
+	for _, k := range keys[1:] {
+		for _, v := range tx.SMembers(k) {
+			excluded[v] = true
+		}
+	}
+	for _, v := range tx.SMembers(keys[0]) {
+		if !excluded[v] {
+			values = append(values, v)
+		}
 	}
 	return
 }
 
 // SKeyExists returns if the key exists.
 func (tx *Tx) SKeyExists(key string) (ok bool) {
-	if tx.db.hasExpired(key, Set) {
-		tx.db.evict(key, Set)
+	db := tx.source(Set, key)
+	if db.hasExpired(key, Set) {
+		tx.evict(key, Set)
 
 		return
 	}
 
-	ok = tx.db.setStore.SKeyExists(key)
+	ok = db.setStore.SKeyExists(key)
 	return
 }
 
 // SClear clear the specified key in set.
 func (tx *Tx) SClear(key string) (err error) {
+	if tx.wrongType(Set, key) {
+		return ErrWrongType
+	}
 	if !tx.SKeyExists(key) {
 		return ErrInvalidKey
 	}
 
 	e := newRecord([]byte(key), nil, SetRecord, SetSClear)
-	tx.addRecord(e)
-	return
+	return tx.addRecord(e)
 }
 
 // SExpire set expired time for the key in set.
 func (tx *Tx) SExpire(key string, duration int64) (err error) {
-	if duration <= 0 {
-		return ErrInvalidTTL
+	deadline, err := deadlineIn(duration, time.Second)
+	if err != nil {
+		return
+	}
+	return tx.SPExpireAt(key, deadline)
+}
+
+// SPExpire is like SExpire, but duration is in milliseconds.
+func (tx *Tx) SPExpire(key string, duration int64) (err error) {
+	deadline, err := deadlineIn(duration, time.Millisecond)
+	if err != nil {
+		return
+	}
+	return tx.SPExpireAt(key, deadline)
+}
+
+// SExpireAt sets the deadline of the key in set to the Unix time t, in
+// seconds. A deadline in the past expires the key.
+func (tx *Tx) SExpireAt(key string, t int64) (err error) {
+	deadline, err := deadlineAt(t, time.Second)
+	if err != nil {
+		return
+	}
+	return tx.SPExpireAt(key, deadline)
+}
+
+// SPExpireAt is like SExpireAt, but t is in milliseconds.
+func (tx *Tx) SPExpireAt(key string, t int64) (err error) {
+	if tx.wrongType(Set, key) {
+		return ErrWrongType
+	}
+	if _, err = deadlineAt(t, time.Millisecond); err != nil {
+		return
 	}
 	if !tx.SKeyExists(key) {
 		return ErrInvalidKey
 	}
 
-	ttl := time.Now().Unix() + duration
-	e := newRecordWithExpire([]byte(key), nil, ttl, SetRecord, SetSExpire)
-	tx.addRecord(e)
-	return
+	e := newRecordWithExpire([]byte(key), nil, t, SetRecord, SetSExpire)
+	return tx.addRecord(e)
 }
 
 // STTL return time to live for the key in set.
 func (tx *Tx) STTL(key string) (ttl int64) {
-	if tx.db.hasExpired(key, Set) {
-		tx.db.evict(key, Set)
+	return ttlSeconds(tx.SPTTL(key))
+}
+
+// SPTTL returns the time to live of the key in set in milliseconds.
+func (tx *Tx) SPTTL(key string) (ttl int64) {
+	db := tx.source(Set, key)
+	if db.hasExpired(key, Set) {
+		tx.evict(key, Set)
 		return
 	}
 
-	deadline := tx.db.getTTL(Set, key)
-	if deadline == nil {
-		return
+	return db.pttl(Set, key)
+}
+
+// SPersist removes the TTL of the key in set. It returns false if the key
+// does not exist or has no TTL.
+func (tx *Tx) SPersist(key string) (bool, error) {
+	if tx.wrongType(Set, key) {
+		return false, ErrWrongType
+	}
+	if !tx.SKeyExists(key) || tx.source(Set, key).getTTL(Set, key) == nil {
+		return false, nil
 	}
 
-	return deadline.(int64) - time.Now().Unix()
+	e := newRecord([]byte(key), nil, SetRecord, SetSPersist)
+	if err := tx.addRecord(e); err != nil {
+		return false, err
+	}
+	return true, nil
 }
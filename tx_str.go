@@ -1,15 +1,35 @@
 package flashdb
 
 import (
+	"errors"
+	"math"
+	"strconv"
 	"time"
 )
 
-// Set saves a key-value pair.
-func (tx *Tx) Set(key string, value string) error {
-	e := newRecord([]byte(key), []byte(value), StringRecord, StringSet)
-	tx.addRecord(e)
+var (
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+	ErrNotFloat   = errors.New("value is not a valid float")
+	ErrOverflow   = errors.New("increment or decrement would overflow")
+
+	ErrWrongArgs      = errors.New("wrong number of arguments")
+	ErrInvalidOptions = errors.New("invalid options")
+)
 
-	return nil
+// GetExOptions set the TTL of the key read by GetEx. At most one of them may
+// be set, and the TTL is left as is if none is.
+type GetExOptions struct {
+	Expire    int64 // TTL in seconds
+	PExpire   int64 // TTL in milliseconds
+	ExpireAt  int64 // deadline in Unix seconds
+	PExpireAt int64 // deadline in Unix milliseconds
+	Persist   bool  // remove the TTL
+}
+
+// Set saves a key-value pair. Any TTL of the key is removed.
+func (tx *Tx) Set(key string, value string) error {
+	e := newRecord([]byte(key), []byte(value), StringRecord, StringSetClearTTL)
+	return tx.addRecord(e)
 }
 
 // SetEx sets key-value pair with given duration time for expiration.
@@ -18,87 +38,526 @@ func (tx *Tx) SetEx(key string, value string, duration int64) (err error) {
 		return ErrInvalidTTL
 	}
 
-	ttl := time.Now().Unix() + duration
-	e := newRecordWithExpire([]byte(key), nil, ttl, StringRecord, StringExpire)
-	tx.addRecord(e)
-
+	_, err = tx.SetWithOptions(key, value, SetOptions{Expire: duration})
 	return
 }
 
-// Get returns value of the given key. It may return error if something goes wrong.
-func (tx *Tx) Get(key string) (val string, err error) {
-	val, err = tx.get(key)
+// SetOptions are the options of SetWithOptions. At most one of NX and XX may
+// be set, and at most one of Expire, PExpire, ExpireAt, PExpireAt and KeepTTL.
+// If none of the latter is set, any TTL of the key is removed.
+type SetOptions struct {
+	NX bool // only set the key if it does not exist
+	XX bool // only set the key if it exists
+
+	Expire    int64 // TTL in seconds
+	PExpire   int64 // TTL in milliseconds
+	ExpireAt  int64 // deadline in Unix seconds
+	PExpireAt int64 // deadline in Unix milliseconds
+	KeepTTL   bool  // keep the TTL of the key
+
+	Get bool // return the old value
+}
+
+// SetResult is the outcome of SetWithOptions.
+type SetResult struct {
+	Set     bool   // the key was set
+	Existed bool   // the key existed before, only reported with Get
+	Old     string // the old value, only reported with Get
+}
+
+// SetWithOptions sets key to value as configured by opts. The value and its
+// TTL are written to the log as a single record.
+func (tx *Tx) SetWithOptions(key string, value string, opts SetOptions) (res SetResult, err error) {
+	deadline, err := opts.deadline()
 	if err != nil {
 		return
 	}
 
+	old, err := tx.get(key)
+	exists := err == nil
+	if err != nil && err != ErrInvalidKey && err != ErrExpiredKey {
+		return
+	}
+	err = nil
+	if opts.Get {
+		res.Existed, res.Old = exists, old
+	}
+	if (opts.NX && exists) || (opts.XX && !exists) {
+		return
+	}
+
+	var e *record
+	switch {
+	case deadline > 0:
+		e = newRecordWithExpire([]byte(key), []byte(value), deadline, StringRecord, StringSetEx)
+	case opts.KeepTTL:
+		e = newRecord([]byte(key), []byte(value), StringRecord, StringSet)
+	default:
+		e = newRecord([]byte(key), []byte(value), StringRecord, StringSetClearTTL)
+	}
+	if err = tx.addRecord(e); err != nil {
+		return
+	}
+	res.Set = true
 	return
 }
 
+// deadline validates the options and returns the deadline they set, or 0 if
+// they set none.
+func (o SetOptions) deadline() (int64, error) {
+	if o.NX && o.XX {
+		return 0, ErrInvalidOptions
+	}
+	return optionDeadline(o.Expire, o.PExpire, o.ExpireAt, o.PExpireAt, o.KeepTTL)
+}
+
+// optionDeadline returns the deadline set by one of the expire options of
+// SetOptions and GetExOptions, or 0 if none is set. other tells whether an
+// option excluding them is set, like KeepTTL.
+func optionDeadline(expire, pExpire, expireAt, pExpireAt int64, other bool) (deadline int64, err error) {
+	opts := []struct {
+		val  int64
+		unit time.Duration
+		at   bool
+	}{
+		{expire, time.Second, false},
+		{pExpire, time.Millisecond, false},
+		{expireAt, time.Second, true},
+		{pExpireAt, time.Millisecond, true},
+	}
+
+	n := 0
+	if other {
+		n++
+	}
+	var errTTL error
+	for _, o := range opts {
+		if o.val == 0 {
+			continue
+		}
+		n++
+		if o.at {
+			deadline, err = deadlineAt(o.val, o.unit)
+		} else {
+			deadline, err = deadlineIn(o.val, o.unit)
+		}
+		if err != nil {
+			errTTL = err
+		}
+	}
+	if n > 1 {
+		return 0, ErrInvalidOptions
+	}
+	return deadline, errTTL
+}
+
+// Get returns value of the given key. It may return error if something goes
+// wrong. With Config.StrictTypes, it returns ErrWrongType if the key holds a
+// value of another data type.
+func (tx *Tx) Get(key string) (val string, err error) {
+	return tx.get(key)
+}
+
 // Delete deletes the given key.
 func (tx *Tx) Delete(key string) error {
+	if tx.wrongType(String, key) {
+		return ErrWrongType
+	}
 	e := newRecord([]byte(key), nil, StringRecord, StringRem)
-	tx.addRecord(e)
-
-	return nil
+	return tx.addRecord(e)
 }
 
 // Expire adds a expiration time period to the given key.
 func (tx *Tx) Expire(key string, duration int64) (err error) {
-	if duration <= 0 {
-		return ErrInvalidTTL
+	deadline, err := deadlineIn(duration, time.Second)
+	if err != nil {
+		return
 	}
+	return tx.PExpireAt(key, deadline)
+}
 
-	if _, err = tx.get(key); err != nil {
+// PExpire is like Expire, but duration is in milliseconds.
+func (tx *Tx) PExpire(key string, duration int64) (err error) {
+	deadline, err := deadlineIn(duration, time.Millisecond)
+	if err != nil {
 		return
 	}
+	return tx.PExpireAt(key, deadline)
+}
 
-	ttl := time.Now().Unix() + duration
-	e := newRecordWithExpire([]byte(key), nil, ttl, StringRecord, StringExpire)
-	tx.addRecord(e)
+// ExpireAt sets the deadline of the given key to the Unix time t, in seconds.
+// A deadline in the past expires the key.
+func (tx *Tx) ExpireAt(key string, t int64) (err error) {
+	deadline, err := deadlineAt(t, time.Second)
+	if err != nil {
+		return
+	}
+	return tx.PExpireAt(key, deadline)
+}
 
-	return
+// PExpireAt is like ExpireAt, but t is in milliseconds.
+func (tx *Tx) PExpireAt(key string, t int64) (err error) {
+	if _, err = deadlineAt(t, time.Millisecond); err != nil {
+		return
+	}
+	if _, err = tx.get(key); err != nil {
+		return
+	}
+
+	e := newRecordWithExpire([]byte(key), nil, t, StringRecord, StringExpire)
+	return tx.addRecord(e)
 }
 
 // TTL returns remaining time of the expiration.
 func (tx *Tx) TTL(key string) (ttl int64) {
-	deadline := tx.db.getTTL(String, key)
-	if deadline == nil {
+	return ttlSeconds(tx.PTTL(key))
+}
+
+// PTTL returns remaining time of the expiration in milliseconds.
+func (tx *Tx) PTTL(key string) (ttl int64) {
+	db := tx.source(String, key)
+	if db.getTTL(String, key) == nil {
 		return
 	}
 
-	if tx.db.hasExpired(key, String) {
-		tx.db.evict(key, String)
+	if db.hasExpired(key, String) {
+		tx.evict(key, String)
 		return
 	}
 
-	return deadline.(int64) - time.Now().Unix()
+	return db.pttl(String, key)
+}
+
+// Persist removes the TTL of the given key. It returns false if the key does
+// not exist or has no TTL.
+func (tx *Tx) Persist(key string) (bool, error) {
+	if _, err := tx.get(key); err != nil {
+		if err == ErrInvalidKey || err == ErrExpiredKey {
+			return false, nil
+		}
+		return false, err
+	}
+	if tx.source(String, key).getTTL(String, key) == nil {
+		return false, nil
+	}
+
+	e := newRecord([]byte(key), nil, StringRecord, StringPersist)
+	if err := tx.addRecord(e); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // Exists checks the given key whether exists. Also, if the key is expired,
 // the key is evicted and return false.
 func (tx *Tx) Exists(key string) bool {
-	_, err := tx.db.strStore.get(key)
+	_, err := tx.get(key)
+	return err == nil
+}
+
+// MGet returns the values of the keys. The value of a key that does not exist
+// is nil, and a string otherwise.
+func (tx *Tx) MGet(keys ...string) []interface{} {
+	vals := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		val, err := tx.get(key)
+		if err != nil {
+			vals = append(vals, nil)
+			continue
+		}
+		vals = append(vals, val)
+	}
+	return vals
+}
+
+// MSet sets the given keys to their values, like Set. pairs holds each key
+// followed by its value.
+func (tx *Tx) MSet(pairs ...string) error {
+	if len(pairs)%2 != 0 {
+		return ErrWrongArgs
+	}
+
+	recs := make([]*record, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		recs = append(recs, newRecord([]byte(pairs[i]), []byte(pairs[i+1]), StringRecord, StringSetClearTTL))
+	}
+	return tx.addRecord(recs...)
+}
+
+// SetNX sets key to value only if the key does not exist. It returns whether
+// the key was set.
+func (tx *Tx) SetNX(key string, value string) (bool, error) {
+	if tx.Exists(key) {
+		return false, nil
+	}
+	if err := tx.Set(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetSet sets key to value and returns the old value, and whether there was
+// one. Any TTL of the key is removed.
+func (tx *Tx) GetSet(key string, value string) (old string, ok bool, err error) {
+	old, err = tx.get(key)
+	ok = err == nil
+	if err = tx.Set(key, value); err != nil {
+		return "", false, err
+	}
+	return
+}
+
+// GetDel returns the value of key and deletes the key.
+func (tx *Tx) GetDel(key string) (val string, err error) {
+	if val, err = tx.get(key); err != nil {
+		return
+	}
+	err = tx.Delete(key)
+	return
+}
+
+// GetEx returns the value of key and sets or removes its TTL as given by opts.
+func (tx *Tx) GetEx(key string, opts GetExOptions) (val string, err error) {
+	deadline, err := optionDeadline(opts.Expire, opts.PExpire, opts.ExpireAt, opts.PExpireAt, opts.Persist)
 	if err != nil {
-		if err == ErrExpiredKey {
-			tx.db.evict(key, String)
+		return
+	}
+
+	if val, err = tx.get(key); err != nil {
+		return
+	}
+
+	var e *record
+	switch {
+	case deadline > 0:
+		e = newRecordWithExpire([]byte(key), nil, deadline, StringRecord, StringExpire)
+	case opts.Persist:
+		if tx.source(String, key).getTTL(String, key) == nil {
+			return
 		}
-		return false
+		e = newRecord([]byte(key), nil, StringRecord, StringPersist)
+	default:
+		return
 	}
+	err = tx.addRecord(e)
+	return
+}
+
+// Append appends value to the value of key, and returns the length of the new
+// value. A missing key is created. Only the appended part is written to the
+// log.
+func (tx *Tx) Append(key string, value string) (int, error) {
+	val, err := tx.get(key)
+	if err != nil && err != ErrInvalidKey && err != ErrExpiredKey {
+		return 0, err
+	}
+	n := len(val) + len(value)
+	if err := tx.checkValueSize(n); err != nil {
+		return 0, err
+	}
+
+	e := newRecord([]byte(key), []byte(value), StringRecord, StringAppend)
+	if err := tx.addRecord(e); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// GetRange returns the substring of the value of key between the start and
+// end byte offsets, both inclusive. Negative offsets count from the end.
+func (tx *Tx) GetRange(key string, start, end int) string {
+	val, err := tx.get(key)
+	if err != nil {
+		return ""
+	}
+
+	n := len(val)
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= n {
+		end = n - 1
+	}
+	if start > end {
+		return ""
+	}
+	return val[start : end+1]
+}
+
+// SetRange overwrites the value of key with value, starting at the byte
+// offset, and returns the length of the new value. The value is padded with
+// zero bytes if it is shorter than offset.
+func (tx *Tx) SetRange(key string, offset int, value string) (int, error) {
+	if offset < 0 {
+		return 0, ErrIndexOutOfRange
+	}
+	val, err := tx.get(key)
+	if err != nil && err != ErrInvalidKey && err != ErrExpiredKey {
+		return 0, err
+	}
+	if value == "" {
+		// nothing to write, and a missing key is not created.
+		return len(val), nil
+	}
+	// checked before adding up offset, which may be close to MaxInt
+	if err := tx.db.config.checkRange(offset, len(value)); err != nil {
+		return 0, err
+	}
+
+	n := len(val)
+	if offset+len(value) > n {
+		n = offset + len(value)
+	}
+	if err := tx.checkValueSize(n); err != nil {
+		return 0, err
+	}
+
+	e := newRecordWithValue([]byte(key), []byte(value), []byte(strconv.Itoa(offset)), StringRecord, StringSetRange)
+	if err := tx.addRecord(e); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
 
-	return true
+// StrLen returns the length of the value of key.
+func (tx *Tx) StrLen(key string) int {
+	val, _ := tx.get(key)
+	return len(val)
+}
+
+// checkValueSize checks the size of a value built up by Append or SetRange.
+func (tx *Tx) checkValueSize(n int) error {
+	if n > math.MaxUint32 {
+		return &SizeLimitError{Err: ErrValueTooLarge, Size: math.MaxUint32, Limit: tx.db.config.MaxValueSize}
+	}
+	return checkSize(ErrValueTooLarge, uint32(n), tx.db.config.MaxValueSize)
+}
+
+// setRange overwrites val with s at offset, padding val with zero bytes.
+func setRange(val string, offset int, s string) string {
+	if n := offset + len(s); n > len(val) {
+		val += string(make([]byte, n-len(val)))
+	}
+	return val[:offset] + s + val[offset+len(s):]
+}
+
+// Incr increments the integer value of key by one, and returns the new value.
+// A missing key is set to 0 before the operation.
+func (tx *Tx) Incr(key string) (int64, error) {
+	return tx.IncrBy(key, 1)
+}
+
+// Decr decrements the integer value of key by one, and returns the new value.
+func (tx *Tx) Decr(key string) (int64, error) {
+	return tx.IncrBy(key, -1)
+}
+
+// DecrBy decrements the integer value of key by delta, and returns the new
+// value.
+func (tx *Tx) DecrBy(key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return tx.IncrBy(key, -delta)
+}
+
+// IncrBy increments the integer value of key by delta, and returns the new
+// value. It returns ErrNotInteger if the value is not an integer, and
+// ErrOverflow if the result does not fit in an int64. Only the delta is
+// written to the log.
+func (tx *Tx) IncrBy(key string, delta int64) (int64, error) {
+	val, err := tx.getNumber(key)
+	if err != nil {
+		return 0, err
+	}
+	res, err := incrBy(val, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	e := newRecord([]byte(key), []byte(strconv.FormatInt(delta, 10)), StringRecord, StringIncrBy)
+	if err := tx.addRecord(e); err != nil {
+		return 0, err
+	}
+	return res, nil
+}
+
+// IncrByFloat increments the float value of key by delta, and returns the new
+// value. It returns ErrNotFloat if the value is not a float, or if the result
+// is NaN or infinite.
+func (tx *Tx) IncrByFloat(key string, delta float64) (float64, error) {
+	val, err := tx.getNumber(key)
+	if err != nil {
+		return 0, err
+	}
+	res, err := incrByFloat(val, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	e := newRecord([]byte(key), []byte(float64ToStr(delta)), StringRecord, StringIncrByFloat)
+	if err := tx.addRecord(e); err != nil {
+		return 0, err
+	}
+	return res, nil
+}
+
+// getNumber returns the value of key, or "0" if the key does not exist.
+func (tx *Tx) getNumber(key string) (string, error) {
+	val, err := tx.get(key)
+	if err == ErrInvalidKey || err == ErrExpiredKey {
+		return "0", nil
+	}
+	return val, err
+}
+
+// incrBy adds delta to the integer in val.
+func incrBy(val string, delta int64) (int64, error) {
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	return n + delta, nil
+}
+
+// incrByFloat adds delta to the float in val.
+func incrByFloat(val string, delta float64) (float64, error) {
+	f, err := strToFloat64(val)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrNotFloat
+	}
+	res := f + delta
+	if math.IsNaN(res) || math.IsInf(res, 0) {
+		return 0, ErrNotFloat
+	}
+	return res, nil
 }
 
 // get is a helper method for retrieving value of the given key from the database.
+// With Config.StrictTypes, it returns ErrWrongType if the key holds a value of
+// another data type, which the callers treating a missing key as empty pass on.
 func (tx *Tx) get(key string) (val string, err error) {
-	v, err := tx.db.strStore.get(key)
+	db := tx.source(String, key)
+	v, err := db.strStore.get(key)
 	if err != nil {
+		if err == ErrInvalidKey && tx.wrongType(String, key) {
+			return "", ErrWrongType
+		}
 		return "", err
 	}
 
 	// Check if the key is expired.
-	if tx.db.hasExpired(key, String) {
-		tx.db.evict(key, String)
+	if db.hasExpired(key, String) {
+		tx.evict(key, String)
 		return "", ErrExpiredKey
 	}
 
@@ -1,8 +1,13 @@
 package flashdb
 
 import (
+	"errors"
+	"math"
 	"os"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -47,6 +52,186 @@ func TestFlashDB_SetEx(t *testing.T) {
 	}
 }
 
+func TestFlashDB_SetWithOptions(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		res, err := tx.SetWithOptions("foo", "1", SetOptions{XX: true})
+		assert.NoError(t, err)
+		assert.False(t, res.Set)
+
+		res, err = tx.SetWithOptions("foo", "1", SetOptions{NX: true, Expire: 100})
+		assert.NoError(t, err)
+		assert.True(t, res.Set)
+		res, err = tx.SetWithOptions("foo", "2", SetOptions{NX: true, Get: true})
+		assert.NoError(t, err)
+		assert.Equal(t, SetResult{Existed: true, Old: "1"}, res)
+
+		// KEEPTTL keeps the TTL, a plain set clears it.
+		res, err = tx.SetWithOptions("foo", "3", SetOptions{XX: true, KeepTTL: true, Get: true})
+		assert.NoError(t, err)
+		assert.Equal(t, SetResult{Set: true, Existed: true, Old: "1"}, res)
+		assert.True(t, tx.TTL("foo") > 0)
+		_, err = tx.SetWithOptions("bar", "1", SetOptions{ExpireAt: time.Now().Unix() + 100})
+		assert.NoError(t, err)
+		_, err = tx.SetWithOptions("bar", "2", SetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), tx.TTL("bar"))
+
+		_, err = tx.SetWithOptions("foo", "x", SetOptions{NX: true, XX: true})
+		assert.Equal(t, ErrInvalidOptions, err)
+		_, err = tx.SetWithOptions("foo", "x", SetOptions{Expire: 1, KeepTTL: true})
+		assert.Equal(t, ErrInvalidOptions, err)
+		_, err = tx.SetWithOptions("foo", "x", SetOptions{Expire: -1})
+		assert.Equal(t, ErrInvalidTTL, err)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// The value and the TTL survive a reload.
+	assert.NoError(t, db.Close())
+	db = getTestDB()
+	defer db.Close()
+	err = db.View(func(tx *Tx) error {
+		val, err := tx.Get("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, "3", val)
+		ttl := tx.TTL("foo")
+		assert.True(t, ttl > 0 && ttl <= 100)
+		val, err = tx.Get("bar")
+		assert.NoError(t, err)
+		assert.Equal(t, "2", val)
+		assert.Equal(t, int64(0), tx.TTL("bar"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_SetExLoad(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		return tx.SetEx("foo", "bar", 100)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&db.logCount))
+
+	assert.NoError(t, db.Close())
+	db = getTestDB()
+	defer db.Close()
+	err = db.View(func(tx *Tx) error {
+		val, err := tx.Get("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", val)
+		ttl := tx.TTL("foo")
+		assert.True(t, ttl > 0 && ttl <= 100)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_PExpire(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("short", "1"))
+		assert.NoError(t, tx.Set("at", "1"))
+		assert.NoError(t, tx.Set("pat", "1"))
+		assert.Equal(t, ErrInvalidTTL, tx.PExpire("short", 0))
+		assert.Equal(t, ErrInvalidTTL, tx.ExpireAt("short", -1))
+		assert.Equal(t, ErrInvalidKey, tx.PExpire("missing", 100))
+
+		assert.NoError(t, tx.PExpire("short", 50))
+		assert.NoError(t, tx.ExpireAt("at", time.Now().Unix()+100))
+		return tx.PExpireAt("pat", time.Now().UnixMilli()+1500)
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		pttl := tx.PTTL("short")
+		assert.True(t, pttl > 0 && pttl <= 50)
+		assert.Equal(t, int64(1), tx.TTL("short"))
+		ttl := tx.TTL("at")
+		assert.True(t, ttl > 98 && ttl <= 100)
+		assert.Equal(t, int64(2), tx.TTL("pat"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	err = db.View(func(tx *Tx) error {
+		assert.False(t, tx.Exists("short"))
+		assert.Equal(t, int64(0), tx.PTTL("short"))
+		assert.True(t, tx.Exists("pat"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_Persist(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("str", "1"))
+		_, err := tx.HSet("hash", "a", "1")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.SAdd("set", "a"))
+		assert.NoError(t, tx.ZAdd("zset", 1, "a"))
+		_, err = tx.RPush("list", "a")
+		assert.NoError(t, err)
+
+		assert.NoError(t, tx.Expire("str", 100))
+		assert.NoError(t, tx.HExpire("hash", 100))
+		assert.NoError(t, tx.SExpire("set", 100))
+		assert.NoError(t, tx.ZExpire("zset", 100))
+		return tx.LExpire("list", 100)
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		for _, persist := range []func(string) (bool, error){tx.Persist, tx.HPersist, tx.SPersist, tx.ZPersist, tx.LPersist} {
+			ok, err := persist("missing")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		}
+
+		persists := map[string]func(string) (bool, error){
+			"str": tx.Persist, "hash": tx.HPersist, "set": tx.SPersist, "zset": tx.ZPersist, "list": tx.LPersist,
+		}
+		for key, persist := range persists {
+			ok, err := persist(key)
+			assert.NoError(t, err)
+			assert.True(t, ok, key)
+		}
+
+		// the key has no TTL anymore
+		ok, err := tx.Persist("str")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// the removal is replayed
+	assert.NoError(t, db.Close())
+	db = getTestDB()
+	defer db.Close()
+	err = db.View(func(tx *Tx) error {
+		for _, ttl := range []int64{tx.TTL("str"), tx.HTTL("hash"), tx.STTL("set"), tx.ZTTL("zset"), tx.LTTL("list")} {
+			assert.Equal(t, int64(0), ttl)
+		}
+		assert.True(t, tx.Exists("str"))
+		assert.True(t, tx.LKeyExists("list"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
 func TestFlashDB_Delete(t *testing.T) {
 	db := getTestDB()
 	defer db.Close()
@@ -98,3 +283,262 @@ func TestFlashDB_TTL(t *testing.T) {
 	}
 
 }
+
+func TestFlashDB_Incr(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		n, err := tx.Incr("counter")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		n, err = tx.IncrBy("counter", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(11), n)
+
+		n, err = tx.DecrBy("counter", 3)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(8), n)
+
+		n, err = tx.Decr("counter")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), n)
+
+		// the pending increments are visible in the same transaction
+		val, err := tx.Get("counter")
+		assert.NoError(t, err)
+		assert.Equal(t, "7", val)
+
+		f, err := tx.IncrByFloat("float", 1.5)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.5, f)
+		f, err = tx.IncrByFloat("counter", 0.25)
+		assert.NoError(t, err)
+		assert.Equal(t, 7.25, f)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// one record per increment, holding only the delta
+	assert.Equal(t, uint64(6), atomic.LoadUint64(&db.logCount))
+	assert.NoError(t, db.Close())
+
+	db = getTestDB()
+	defer db.Close()
+	err = db.View(func(tx *Tx) error {
+		val, err := tx.Get("counter")
+		assert.NoError(t, err)
+		assert.Equal(t, "7.25", val)
+		val, err = tx.Get("float")
+		assert.NoError(t, err)
+		assert.Equal(t, "1.5", val)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_IncrErrors(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("str", "abc"))
+		_, err := tx.Incr("str")
+		assert.Equal(t, ErrNotInteger, err)
+		_, err = tx.IncrByFloat("str", 1)
+		assert.Equal(t, ErrNotFloat, err)
+
+		assert.NoError(t, tx.Set("float", "1.5"))
+		_, err = tx.Incr("float")
+		assert.Equal(t, ErrNotInteger, err)
+
+		assert.NoError(t, tx.Set("max", "9223372036854775807"))
+		_, err = tx.Incr("max")
+		assert.Equal(t, ErrOverflow, err)
+		_, err = tx.DecrBy("min", math.MinInt64)
+		assert.Equal(t, ErrOverflow, err)
+
+		_, err = tx.IncrByFloat("float", math.Inf(1))
+		assert.Equal(t, ErrNotFloat, err)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		val, err := tx.Get("max")
+		assert.NoError(t, err)
+		assert.Equal(t, "9223372036854775807", val)
+		assert.False(t, tx.Exists("min"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_SetClearsTTL(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("foo", "1"))
+		assert.NoError(t, tx.Expire("foo", 100))
+		assert.True(t, tx.TTL("foo") > 0)
+
+		assert.NoError(t, tx.Set("foo", "2"))
+		assert.Equal(t, int64(0), tx.TTL("foo"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_MGetMSet(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.Equal(t, ErrWrongArgs, tx.MSet("a", "1", "b"))
+		assert.NoError(t, tx.MSet("a", "1", "b", "2"))
+		assert.Equal(t, []interface{}{"1", nil, "2"}, tx.MGet("a", "missing", "b"))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_SetNXGetSet(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		ok, err := tx.SetNX("lock", "owner1")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = tx.SetNX("lock", "owner2")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.NoError(t, tx.Expire("lock", 100))
+		old, ok, err := tx.GetSet("lock", "owner3")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "owner1", old)
+		assert.Equal(t, int64(0), tx.TTL("lock"))
+
+		_, ok, err = tx.GetSet("new", "v")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_GetDelGetEx(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("a", "1"))
+		val, err := tx.GetDel("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", val)
+		assert.False(t, tx.Exists("a"))
+		_, err = tx.GetDel("a")
+		assert.Equal(t, ErrInvalidKey, err)
+
+		assert.NoError(t, tx.Set("b", "2"))
+		val, err = tx.GetEx("b", GetExOptions{Expire: 100})
+		assert.NoError(t, err)
+		assert.Equal(t, "2", val)
+		assert.True(t, tx.TTL("b") > 0)
+
+		_, err = tx.GetEx("b", GetExOptions{Persist: true})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), tx.TTL("b"))
+
+		_, err = tx.GetEx("b", GetExOptions{Expire: 1, Persist: true})
+		assert.Equal(t, ErrInvalidOptions, err)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_AppendSetRange(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		n, err := tx.Append("s", "Hello")
+		assert.NoError(t, err)
+		assert.Equal(t, 5, n)
+		assert.NoError(t, tx.Expire("s", 100))
+		n, err = tx.Append("s", " World")
+		assert.NoError(t, err)
+		assert.Equal(t, 11, n)
+
+		n, err = tx.SetRange("s", 6, "Redis")
+		assert.NoError(t, err)
+		assert.Equal(t, 11, n)
+		assert.Equal(t, "Hello Redis", tx.GetRange("s", 0, -1))
+		assert.Equal(t, "Redis", tx.GetRange("s", -5, 100))
+		assert.Equal(t, "", tx.GetRange("s", 5, 2))
+		assert.Equal(t, 11, tx.StrLen("s"))
+
+		n, err = tx.SetRange("pad", 3, "x")
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+
+		_, err = tx.SetRange("s", -1, "x")
+		assert.Equal(t, ErrIndexOutOfRange, err)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	db = getTestDB()
+	defer db.Close()
+	err = db.View(func(tx *Tx) error {
+		val, err := tx.Get("s")
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello Redis", val)
+		// APPEND and SETRANGE keep the TTL
+		assert.True(t, tx.TTL("s") > 0)
+
+		val, err = tx.Get("pad")
+		assert.NoError(t, err)
+		assert.Equal(t, "\x00\x00\x00x", val)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFlashDB_AppendSizeLimit(t *testing.T) {
+	config := testConfig()
+	config.MaxValueSize = 8
+	db, err := New(config)
+	assert.NoError(t, err)
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err = db.Update(func(tx *Tx) error {
+		_, err := tx.Append("s", "12345")
+		assert.NoError(t, err)
+		_, err = tx.Append("s", "6789")
+		assert.True(t, errors.Is(err, ErrValueTooLarge))
+		_, err = tx.SetRange("s", 8, "x")
+		assert.True(t, errors.Is(err, ErrValueTooLarge))
+
+		// an offset close to MaxInt does not overflow the size check
+		_, err = tx.SetRange("s", math.MaxInt64, "x")
+		assert.True(t, errors.Is(err, ErrValueTooLarge))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// nor can such a record be replayed from the log
+	r := newRecordWithValue([]byte("s"), []byte("x"), []byte(strconv.Itoa(math.MaxInt64)), StringRecord, StringSetRange)
+	assert.True(t, errors.Is(db.loadRecord(r), ErrValueTooLarge))
+}
@@ -1,6 +1,10 @@
 package flashdb
 
 import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
 	"github.com/arriqaaq/aol"
 )
 
@@ -14,14 +18,37 @@ type Tx struct {
 	db       *FlashDB        // the underlying database.
 	writable bool            // when false mutable operations fail.
 	wc       *txWriteContext // context for writable transactions.
+	sweeping bool            // reads of the sweeper are not key accesses.
 }
 
-func (tx *Tx) addRecord(r *record) {
-	tx.wc.commitItems = append(tx.wc.commitItems, r)
+// addRecord queues records to be committed, and applies them to the overlay
+// so that they are visible to reads in the same transaction. If any record is
+// over the size limits in the config, or creates a key of the wrong type with
+// Config.StrictTypes, none of them are queued.
+func (tx *Tx) addRecord(recs ...*record) error {
+	for _, r := range recs {
+		if err := tx.db.checkRecord(r); err != nil {
+			return err
+		}
+	}
+	if err := tx.checkTypes(recs); err != nil {
+		return err
+	}
+	for _, r := range recs {
+		for _, key := range recordKeys(r) {
+			tx.touch(recordDataType(r.getType()), key)
+		}
+		if err := tx.wc.overlay.apply(r); err != nil {
+			return err
+		}
+	}
+	tx.wc.commitItems = append(tx.wc.commitItems, recs...)
+	return nil
 }
 
 type txWriteContext struct {
 	commitItems []*record // details for committing tx.
+	overlay     *overlay  // keys written by the tx, with its records applied.
 }
 
 // lock locks the database based on the transaction type.
@@ -96,39 +123,73 @@ func (db *FlashDB) Begin(writable bool) (*Tx, error) {
 
 // Commit writes all changes to disk.
 // An error is returned when a write error occurs, or when a Commit() is called
-// from a read-only transaction.
+// from a read-only transaction. The commit is atomic: when it fails, none of
+// the changes are written to disk or applied to the database.
 func (tx *Tx) Commit() error {
 	if tx.db == nil {
 		return ErrTxClosed
 	} else if !tx.writable {
 		return ErrTxNotWritable
 	}
-	var err error
-	if tx.db.persist && (len(tx.wc.commitItems) > 0) && tx.writable {
+
+	err := tx.commit()
+	if err != nil {
+		tx.rollback()
+	} else {
+		// wake up the clients blocked on the lists pushed to, and tell the
+		// subscribers about the changes, including the pops served to the
+		// clients, now that they are durable.
+		served := tx.db.serveBlocked(tx.wc.commitItems)
+		tx.db.notify(tx.wc.commitItems)
+		tx.db.notify(served)
+	}
+	// Unlock the database and allow for another writable transaction.
+	tx.unlock()
+	// Clear the db field to disable this transaction from future use.
+	tx.db = nil
+	return err
+}
+
+// commit validates the records of the transaction, writes them to the log
+// and applies them to the database. Every record is validated and encoded
+// before anything is written, so applying them cannot fail half way.
+func (tx *Tx) commit() error {
+	if len(tx.wc.commitItems) == 0 {
+		return nil
+	}
+	if err := tx.freeMemory(); err != nil {
+		return err
+	}
+
+	recs := make([][]byte, 0, len(tx.wc.commitItems))
+	for _, r := range tx.wc.commitItems {
+		if err := tx.db.validateRecord(r); err != nil {
+			return err
+		}
+		rec, err := r.encode()
+		if err != nil {
+			return err
+		}
+		recs = append(recs, rec)
+	}
+
+	if tx.db.persist {
 		batch := new(aol.Batch)
-		// Each committed record is written to disk
-		for _, r := range tx.wc.commitItems {
-			rec, err := r.encode()
-			if err != nil {
-				return err
-			}
+		for _, rec := range recs {
 			batch.Write(rec)
 		}
 		// If this operation fails then the write did failed and we must
 		// rollback.
-		err = tx.db.log.WriteBatch(batch)
-		if err != nil {
-			tx.rollback()
+		if err := tx.db.log.WriteBatch(batch); err != nil {
+			return err
 		}
+		atomic.AddUint64(&tx.db.logCount, uint64(len(recs)))
+		// keep the records for a log rewrite running in the background.
+		tx.db.rewrite.append(recs...)
 	}
 
 	// apply all commands
-	err = tx.buildRecords(tx.wc.commitItems)
-	// Unlock the database and allow for another writable transaction.
-	tx.unlock()
-	// Clear the db field to disable this transaction from future use.
-	tx.db = nil
-	return err
+	return tx.buildRecords(tx.wc.commitItems)
 }
 
 // View executes a function within a managed read-only transaction.
@@ -170,6 +231,7 @@ func (tx *Tx) Rollback() error {
 // Intended to be called from Commit() and Rollback().
 func (tx *Tx) rollback() {
 	tx.wc.commitItems = nil
+	tx.wc.overlay = nil
 }
 
 func (tx *Tx) buildRecords(recs []*record) (err error) {
@@ -183,7 +245,66 @@ func (tx *Tx) buildRecords(recs []*record) (err error) {
 			err = tx.db.buildSetRecord(r)
 		case ZSetRecord:
 			err = tx.db.buildZsetRecord(r)
+		case ListRecord:
+			err = tx.db.buildListRecord(r)
+		}
+		if err != nil {
+			return
 		}
 	}
 	return
 }
+
+// validateRecord checks that r can be applied to the database, so that a
+// commit fails before any of its records are written or applied, and that a
+// record read from the log cannot break the stores.
+func (db *FlashDB) validateRecord(r *record) error {
+	if len(r.meta.key) == 0 {
+		return fmt.Errorf("%w: empty key", ErrInvalidEntry)
+	}
+
+	switch r.getType() {
+	case StringRecord:
+		switch r.getMark() {
+		case StringIncrBy:
+			if _, err := strconv.ParseInt(string(r.meta.member), 10, 64); err != nil {
+				return fmt.Errorf("%w: invalid increment %q", ErrInvalidEntry, r.meta.member)
+			}
+		case StringIncrByFloat:
+			if _, err := strToFloat64(string(r.meta.member)); err != nil {
+				return fmt.Errorf("%w: invalid increment %q", ErrInvalidEntry, r.meta.member)
+			}
+		case StringSetRange:
+			n, err := strconv.Atoi(string(r.meta.value))
+			if err != nil || n < 0 {
+				return fmt.Errorf("%w: invalid offset %q", ErrInvalidEntry, r.meta.value)
+			}
+			if err := db.config.checkRange(n, len(r.meta.member)); err != nil {
+				return err
+			}
+		}
+	case HashRecord, SetRecord:
+	case ZSetRecord:
+		if r.getMark() == ZSetZAdd {
+			if _, err := strToFloat64(string(r.meta.value)); err != nil {
+				return fmt.Errorf("%w: invalid score %q", ErrInvalidEntry, r.meta.value)
+			}
+		}
+	case ListRecord:
+		var nums [][]byte
+		switch r.getMark() {
+		case ListLSet, ListLRem:
+			nums = [][]byte{r.meta.value}
+		case ListLTrim:
+			nums = [][]byte{r.meta.member, r.meta.value}
+		}
+		for _, n := range nums {
+			if _, err := strconv.Atoi(string(n)); err != nil {
+				return fmt.Errorf("%w: invalid index %q", ErrInvalidEntry, n)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown record type %d", ErrInvalidEntry, r.getType())
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package flashdb
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/arriqaaq/aol"
+	"github.com/stretchr/testify/assert"
+)
+
+// commitState returns what a failed commit must leave untouched.
+func commitState(t *testing.T, db *FlashDB) (val string, members []string, logCount uint64) {
+	err := db.View(func(tx *Tx) error {
+		val, _ = tx.Get("a")
+		members = tx.SMembers("s")
+		return nil
+	})
+	assert.NoError(t, err)
+	return val, members, atomic.LoadUint64(&db.logCount)
+}
+
+func TestTx_CommitValidateFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		rec  *record
+	}{
+		{"invalid score", newRecordWithValue([]byte("z"), []byte("m"), []byte("x"), ZSetRecord, ZSetZAdd)},
+		{"empty key", newRecord(nil, []byte("v"), StringRecord, StringSet)},
+		{"unknown type", newRecord([]byte("k"), []byte("v"), 42, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := getTestDB()
+			defer os.RemoveAll(tmpDir)
+
+			err := db.Update(func(tx *Tx) error {
+				return tx.Set("a", "1")
+			})
+			assert.NoError(t, err)
+			val, members, logCount := commitState(t, db)
+
+			err = db.Update(func(tx *Tx) error {
+				assert.NoError(t, tx.Set("a", "2"))
+				assert.NoError(t, tx.SAdd("s", "m"))
+				// bypass addRecord, so that the record is only caught on commit
+				tx.wc.commitItems = append(tx.wc.commitItems, tt.rec)
+				return nil
+			})
+			assert.True(t, errors.Is(err, ErrInvalidEntry))
+
+			gotVal, gotMembers, gotLogCount := commitState(t, db)
+			assert.Equal(t, val, gotVal)
+			assert.Equal(t, members, gotMembers)
+			assert.Equal(t, logCount, gotLogCount)
+
+			// nothing reached the log either
+			assert.NoError(t, db.Close())
+			db = getTestDB()
+			defer db.Close()
+			gotVal, gotMembers, _ = commitState(t, db)
+			assert.Equal(t, "1", gotVal)
+			assert.Empty(t, gotMembers)
+		})
+	}
+}
+
+func TestTx_CommitEmptyKey(t *testing.T) {
+	db := getTestDB()
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		return tx.Set("", "v")
+	})
+	assert.True(t, errors.Is(err, ErrInvalidEntry))
+
+	// the failed commit released the lock
+	err = db.Update(func(tx *Tx) error {
+		return tx.Set("a", "1")
+	})
+	assert.NoError(t, err)
+}
+
+func TestTx_CommitWriteFailure(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		return tx.Set("a", "1")
+	})
+	assert.NoError(t, err)
+	val, members, logCount := commitState(t, db)
+
+	// make the write to the log fail
+	assert.NoError(t, db.log.Close())
+
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("a", "2"))
+		return tx.SAdd("s", "m")
+	})
+	assert.Equal(t, aol.ErrClosed, err)
+
+	gotVal, gotMembers, gotLogCount := commitState(t, db)
+	assert.Equal(t, val, gotVal)
+	assert.Equal(t, members, gotMembers)
+	assert.Equal(t, logCount, gotLogCount)
+}
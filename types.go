@@ -0,0 +1,163 @@
+package flashdb
+
+import "sort"
+
+// TypeConflict is a key name holding values of several data types, which
+// Config.StrictTypes does not allow for new keys.
+type TypeConflict struct {
+	Key   string
+	Types []DataType
+}
+
+// TypeConflicts returns the key names holding values of several data types,
+// sorted by name. It is meant to be checked before turning Config.StrictTypes
+// on for an existing database.
+func (db *FlashDB) TypeConflicts() []TypeConflict {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	types := make(map[string][]DataType)
+	for _, dType := range dataTypes {
+		for _, key := range db.storeKeys(dType) {
+			if db.keyExists(dType, key) {
+				types[key] = append(types[key], dType)
+			}
+		}
+	}
+
+	var conflicts []TypeConflict
+	for key, t := range types {
+		if len(t) > 1 {
+			conflicts = append(conflicts, TypeConflict{Key: key, Types: t})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Key < conflicts[j].Key
+	})
+	return conflicts
+}
+
+// checkTypes fails with ErrWrongType if, with Config.StrictTypes, one of the
+// records creates a key whose name holds a value of another data type. The
+// records are checked in order, so that a record clearing a key makes way for
+// the records after it, as in Rename.
+func (tx *Tx) checkTypes(recs []*record) error {
+	if !tx.db.config.StrictTypes {
+		return nil
+	}
+
+	// whether the records checked so far have created or cleared a key
+	batch := make(map[overlayKey]bool)
+	has := func(dType DataType, key string) bool {
+		if ok, found := batch[overlayKey{dType, key}]; found {
+			return ok
+		}
+		return tx.hasKey(dType, key)
+	}
+
+	for _, r := range recs {
+		dType := recordDataType(r.getType())
+		if isClearRecord(r) {
+			batch[overlayKey{dType, string(r.meta.key)}] = false
+			continue
+		}
+		key, ok := createdKey(r)
+		if !ok || has(dType, key) {
+			continue
+		}
+		for _, other := range dataTypes {
+			if other != dType && has(other, key) {
+				return ErrWrongType
+			}
+		}
+		batch[overlayKey{dType, key}] = true
+	}
+	return nil
+}
+
+// hasKey reports whether a value of type dType that has not expired is stored
+// at key, as seen by the transaction. Unlike the other reads, it does not
+// count as an access to the key.
+func (tx *Tx) hasKey(dType DataType, key string) bool {
+	if tx.wc != nil && tx.wc.overlay != nil && tx.wc.overlay.touched[overlayKey{dType, key}] {
+		return tx.wc.overlay.db.keyExists(dType, key)
+	}
+	return tx.db.keyExists(dType, key)
+}
+
+// CheckType returns ErrWrongType if, with Config.StrictTypes, one of the keys
+// holds a value of a data type other than dType, and none of type dType. The
+// typed commands returning an error check their keys already; it is meant for
+// the reads that return an empty result instead.
+func (tx *Tx) CheckType(dType DataType, keys ...string) error {
+	for _, key := range keys {
+		if tx.wrongType(dType, key) {
+			return ErrWrongType
+		}
+	}
+	return nil
+}
+
+// wrongType reports whether, with Config.StrictTypes, the key holds a value of
+// a data type other than dType, and none of type dType. A key name holding
+// several data types in an existing log can still be read and written as each
+// of them.
+func (tx *Tx) wrongType(dType DataType, key string) bool {
+	if !tx.db.config.StrictTypes || tx.hasKey(dType, key) {
+		return false
+	}
+	for _, other := range dataTypes {
+		if other != dType && tx.hasKey(other, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// createdKey returns the key that the record creates if it does not exist.
+func createdKey(r *record) (string, bool) {
+	key := string(r.meta.key)
+	switch r.getType() {
+	case StringRecord:
+		switch r.getMark() {
+		case StringSet, StringSetClearTTL, StringSetEx, StringIncrBy, StringIncrByFloat, StringAppend, StringSetRange:
+			return key, true
+		}
+	case HashRecord:
+		return key, r.getMark() == HashHSet
+	case SetRecord:
+		switch r.getMark() {
+		case SetSAdd:
+			return key, true
+		case SetSMove:
+			// the value of an SMove record is the destination key
+			return string(r.meta.value), true
+		}
+	case ZSetRecord:
+		return key, r.getMark() == ZSetZAdd
+	case ListRecord:
+		switch r.getMark() {
+		case ListLPush, ListRPush:
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// isClearRecord reports whether the record removes its key, as the records
+// returned by evictRecord do.
+func isClearRecord(r *record) bool {
+	switch r.getType() {
+	case StringRecord:
+		return r.getMark() == StringRem
+	case HashRecord:
+		return r.getMark() == HashHClear
+	case SetRecord:
+		return r.getMark() == SetSClear
+	case ZSetRecord:
+		return r.getMark() == ZSetZClear
+	case ListRecord:
+		return r.getMark() == ListLClear
+	}
+	return false
+}
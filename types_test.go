@@ -0,0 +1,207 @@
+package flashdb
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlashDB_StrictTypes(t *testing.T) {
+	config := testConfig()
+	config.StrictTypes = true
+	db, err := New(config)
+	assert.NoError(t, err)
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("str", "val"))
+		return tx.SAdd("set", "a", "b")
+	})
+	assert.NoError(t, err)
+
+	err = db.Update(func(tx *Tx) error {
+		_, err := tx.HSet("str", "field", "val")
+		return err
+	})
+	assert.Equal(t, ErrWrongType, err)
+
+	err = db.Update(func(tx *Tx) error {
+		return tx.SMove("set", "str", "a")
+	})
+	assert.Equal(t, ErrWrongType, err)
+
+	err = db.Update(func(tx *Tx) error {
+		// writes to a key of the same type are allowed
+		assert.NoError(t, tx.SAdd("set", "c"))
+		assert.NoError(t, tx.Set("str", "other"))
+
+		// a key of another type is created once the name is free
+		_, err := tx.Del("str")
+		assert.NoError(t, err)
+		_, err = tx.HSet("str", "field", "val")
+		assert.NoError(t, err)
+
+		// renaming over a key of another type replaces it
+		return tx.Rename("set", "str")
+	})
+	assert.NoError(t, err)
+
+	db.View(func(tx *Tx) error {
+		assert.Equal(t, Set, tx.Type("str"))
+		assert.Equal(t, 0, tx.HLen("str"))
+		_, err := tx.Get("str")
+		assert.Equal(t, ErrWrongType, err)
+		_, err = tx.Get("missing")
+		assert.Equal(t, ErrInvalidKey, err)
+		return nil
+	})
+}
+
+func TestFlashDB_StrictTypesReadWrite(t *testing.T) {
+	config := testConfig()
+	config.StrictTypes = true
+	db, err := New(config)
+	assert.NoError(t, err)
+	defer db.Close()
+	defer os.RemoveAll(tmpDir)
+
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("str", "val"))
+		_, err := tx.HSet("hash", "field", "val")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.SAdd("set", "member"))
+		assert.NoError(t, tx.ZAdd("zset", 1, "member"))
+		_, err = tx.RPush("list", "elem")
+		return err
+	})
+	assert.NoError(t, err)
+
+	// a read and a write that does not create the key, for each data type,
+	// on a key of another type
+	ops := map[string]func(tx *Tx) error{
+		"Get": func(tx *Tx) error {
+			_, err := tx.Get("list")
+			return err
+		},
+		"Expire": func(tx *Tx) error {
+			return tx.Expire("hash", 100)
+		},
+		"HScan": func(tx *Tx) error {
+			_, _, err := tx.HScan("str", "0", ScanOptions{})
+			return err
+		},
+		"HGetAll": func(tx *Tx) error {
+			return tx.CheckType(Hash, "str")
+		},
+		"HDel": func(tx *Tx) error {
+			_, err := tx.HDel("set", "field")
+			return err
+		},
+		"HExpire": func(tx *Tx) error {
+			return tx.HExpire("list", 100)
+		},
+		"SScan": func(tx *Tx) error {
+			_, _, err := tx.SScan("zset", "0", ScanOptions{})
+			return err
+		},
+		"SRem": func(tx *Tx) error {
+			_, err := tx.SRem("str", "member")
+			return err
+		},
+		"ZScan": func(tx *Tx) error {
+			_, _, err := tx.ZScan("set", "0", ScanOptions{})
+			return err
+		},
+		"ZRem": func(tx *Tx) error {
+			_, err := tx.ZRem("hash", "member")
+			return err
+		},
+		"LIndex": func(tx *Tx) error {
+			_, err := tx.LIndex("zset", 0)
+			return err
+		},
+		"LPop": func(tx *Tx) error {
+			_, err := tx.LPop("set")
+			return err
+		},
+		"LRem": func(tx *Tx) error {
+			_, err := tx.LRem("str", 0, "elem")
+			return err
+		},
+		"LMove": func(tx *Tx) error {
+			_, err := tx.LMove("list", "str", Left, Right)
+			return err
+		},
+	}
+	for name, op := range ops {
+		assert.Equal(t, ErrWrongType, db.Update(op), name)
+	}
+
+	db.View(func(tx *Tx) error {
+		// the reads without an error return an empty result
+		assert.Empty(t, tx.HGetAll("str"))
+		assert.Empty(t, tx.LRange("hash", 0, -1))
+
+		assert.NoError(t, tx.CheckType(List, "list", "missing"))
+		assert.Equal(t, ErrWrongType, tx.CheckType(List, "list", "set"))
+		return nil
+	})
+
+	_, _, err = db.BLPop(context.Background(), 0, "str")
+	assert.Equal(t, ErrWrongType, err)
+
+	// the keys are left as they were
+	db.View(func(tx *Tx) error {
+		assert.Equal(t, []string{"elem"}, tx.LRange("list", 0, -1))
+		assert.Equal(t, 1, tx.SCard("set"))
+		return nil
+	})
+}
+
+func TestFlashDB_TypeConflicts(t *testing.T) {
+	db := getTestDB()
+	defer os.RemoveAll(tmpDir)
+
+	err := db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("b", "val"))
+		assert.NoError(t, tx.SAdd("b", "member"))
+		assert.NoError(t, tx.Set("a", "val"))
+		_, err := tx.LPush("a", "elem")
+		assert.NoError(t, err)
+		return tx.Set("c", "val")
+	})
+	assert.NoError(t, err)
+	db.Close()
+
+	var conflicts []TypeConflict
+	config := testConfig()
+	config.StrictTypes = true
+	config.OnTypeConflict = func(c TypeConflict) {
+		conflicts = append(conflicts, c)
+	}
+	db, err = New(config)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	expected := []TypeConflict{
+		{Key: "a", Types: []DataType{String, List}},
+		{Key: "b", Types: []DataType{String, Set}},
+	}
+	assert.Equal(t, expected, conflicts)
+	assert.Equal(t, expected, db.TypeConflicts())
+
+	// the names in conflict can still be written to, and deleted
+	err = db.Update(func(tx *Tx) error {
+		assert.NoError(t, tx.Set("a", "other"))
+		val, err := tx.LIndex("a", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "elem", val)
+		_, err = tx.Del("a", "b")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, db.TypeConflicts())
+}